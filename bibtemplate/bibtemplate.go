@@ -0,0 +1,208 @@
+// Package bibtemplate runs user-supplied text/template and html/template
+// templates over a bibliography.
+//
+// The template is executed with a *Bibliography, a template-friendly view of
+// a bibtex.BibTex: entries expose their cite key, type and fields as plain
+// strings. Funcs provides helper functions for common tasks such as parsing
+// names, decoding TeX, sorting and grouping entries:
+//
+//	{{range groupBy "year" (sortBy "-year" .Entries)}}
+//	<h2>{{.Key}}</h2>
+//	{{range .Entries}}<p>{{range names (field "author" .)}}{{.Last}} {{end}}
+//	<i>{{unicode .Fields.title}}</i> {{with field "doi" .}}doi:{{.}}{{end}}</p>
+//	{{end}}{{end}}
+package bibtemplate // import "github.com/nickng/bibtex/bibtemplate"
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/nickng/bibtex"
+)
+
+// Bibliography is the data passed to a template.
+type Bibliography struct {
+	Entries   []*Entry          // Entries in file order.
+	Preambles []string          // Preamble contents.
+	Strings   map[string]string // @string macros by name.
+}
+
+// Entry is a template-friendly view of a bibtex.BibEntry.
+//
+// Field names are lowercased and values have @string macros expanded but
+// keep their TeX encoding; use the unicode function to decode them.
+type Entry struct {
+	Key    string            // Cite key.
+	Type   string            // Entry type, e.g. "article".
+	Fields map[string]string // Field values by lowercased name.
+
+	Entry *bibtex.BibEntry // The underlying entry.
+}
+
+// Field returns the value of the named field (case-insensitive), or "".
+func (e *Entry) Field(name string) string {
+	return e.Fields[strings.ToLower(name)]
+}
+
+// Group is a run of entries sharing the same value, as returned by groupBy.
+type Group struct {
+	Key     string
+	Entries []*Entry
+}
+
+// NewBibliography converts bib to its template view.
+func NewBibliography(bib *bibtex.BibTex) *Bibliography {
+	b := &Bibliography{
+		Entries: make([]*Entry, len(bib.Entries)),
+		Strings: make(map[string]string, len(bib.StringVar)),
+	}
+	for i, entry := range bib.Entries {
+		b.Entries[i] = NewEntry(entry)
+	}
+	for _, preamble := range bib.Preambles {
+		b.Preambles = append(b.Preambles, preamble.String())
+	}
+	for key, v := range bib.StringVar {
+		b.Strings[key] = v.String()
+	}
+	return b
+}
+
+// NewEntry converts entry to its template view.
+func NewEntry(entry *bibtex.BibEntry) *Entry {
+	e := &Entry{
+		Key:    entry.CiteName,
+		Type:   entry.Type,
+		Fields: make(map[string]string, len(entry.Fields)),
+		Entry:  entry,
+	}
+	for name, value := range entry.Fields {
+		e.Fields[strings.ToLower(name)] = value.String()
+	}
+	return e
+}
+
+// Funcs are the helper functions available to templates:
+//
+//	names s           parse a name list into []bibtex.Name, decoded to Unicode
+//	unicode s         decode TeX in s to Unicode
+//	year e            the year of entry e, from its year or date field
+//	field name e      the value of a field of entry e, or ""
+//	sortBy name es    a copy of es sorted by a field ("-name" for descending)
+//	groupBy name es   es grouped by a field, as []Group in first-seen order
+//
+// The field names "key" and "type" refer to the cite key and entry type in
+// sortBy and groupBy, and "year" uses the year function.
+var Funcs = map[string]any{
+	"names":   names,
+	"unicode": bibtex.DecodeTeX,
+	"year":    year,
+	"field":   field,
+	"sortBy":  sortBy,
+	"groupBy": groupBy,
+}
+
+// New returns a new text/template with Funcs installed.
+func New(name string) *texttemplate.Template {
+	return texttemplate.New(name).Funcs(Funcs)
+}
+
+// NewHTML returns a new html/template with Funcs installed.
+func NewHTML(name string) *htmltemplate.Template {
+	return htmltemplate.New(name).Funcs(Funcs)
+}
+
+// Template is a parsed text/template or html/template.
+type Template interface {
+	Execute(w io.Writer, data any) error
+}
+
+// Execute applies t to bib and writes the output to w.
+func Execute(w io.Writer, t Template, bib *bibtex.BibTex) error {
+	return t.Execute(w, NewBibliography(bib))
+}
+
+func names(s string) []bibtex.Name {
+	names := bibtex.ParseNames(s)
+	for i, n := range names {
+		names[i] = bibtex.Name{
+			First: bibtex.DecodeTeX(n.First),
+			Von:   bibtex.DecodeTeX(n.Von),
+			Last:  bibtex.DecodeTeX(n.Last),
+			Jr:    bibtex.DecodeTeX(n.Jr),
+		}
+	}
+	return names
+}
+
+func year(e *Entry) string {
+	if y := e.Field("year"); y != "" {
+		return bibtex.DecodeTeX(y)
+	}
+	date := e.Field("date")
+	if i := strings.IndexAny(date, "-/"); i >= 0 {
+		date = date[:i]
+	}
+	return date
+}
+
+func field(name string, e *Entry) string {
+	return e.Field(name)
+}
+
+// value returns the value of e used by sortBy and groupBy.
+func value(name string, e *Entry) string {
+	switch strings.ToLower(name) {
+	case "key":
+		return e.Key
+	case "type":
+		return e.Type
+	case "year":
+		return year(e)
+	}
+	return bibtex.DecodeTeX(e.Field(name))
+}
+
+func sortBy(name string, entries []*Entry) []*Entry {
+	name, desc := strings.CutPrefix(name, "-")
+	sorted := append([]*Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := value(name, sorted[i]), value(name, sorted[j])
+		if desc {
+			a, b = b, a
+		}
+		return less(a, b)
+	})
+	return sorted
+}
+
+// less compares numerically if both a and b are numbers, and
+// case-insensitively otherwise.
+func less(a, b string) bool {
+	x, errx := strconv.Atoi(a)
+	y, erry := strconv.Atoi(b)
+	if errx == nil && erry == nil {
+		return x < y
+	}
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+func groupBy(name string, entries []*Entry) []Group {
+	var groups []Group
+	index := make(map[string]int)
+	for _, e := range entries {
+		key := value(name, e)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, Group{Key: key})
+		}
+		groups[i].Entries = append(groups[i].Entries, e)
+	}
+	return groups
+}
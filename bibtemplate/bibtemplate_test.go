@@ -0,0 +1,87 @@
+package bibtemplate
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nickng/bibtex"
+)
+
+func testBib(t *testing.T) *bibtex.BibTex {
+	bib, err := bibtex.Parse(strings.NewReader(`
+@article{knuth84, author = {Knuth, Donald E.}, title = {Literate Programming}, year = 1984, doi = {10.1093/comjnl/27.2.97}}
+@book{goedel31, author = {G{\"o}del, Kurt and Escher, M. C.}, title = {{\"U}ber formal unentscheidbare S{\"a}tze}, date = {1931-01}}
+@article{knuth77, author = {Donald E. Knuth}, title = {Fast Pattern Matching}, year = 1977}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bib
+}
+
+func TestExecute(t *testing.T) {
+	tmpl, err := New("test").Parse(`{{range groupBy "year" (sortBy "-year" .Entries)}}{{.Key}}:{{range .Entries}} {{.Key}}{{end}}
+{{end}}{{range sortBy "key" .Entries}}{{range names (field "author" .)}}{{.Last}};{{end}} {{unicode .Fields.title}}{{with field "DOI" .}} doi:{{.}}{{end}}
+{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Execute(&buf, tmpl, testBib(t)); err != nil {
+		t.Fatal(err)
+	}
+	want := `1984: knuth84
+1977: knuth77
+1931: goedel31
+Gödel;Escher; Über formal unentscheidbare Sätze
+Knuth; Fast Pattern Matching
+Knuth; Literate Programming doi:10.1093/comjnl/27.2.97
+`
+	if got := buf.String(); want != got {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestExecuteHTML(t *testing.T) {
+	tmpl, err := NewHTML("test").Parse(`{{range .Entries}}<li id="{{.Key}}">{{unicode .Fields.title}} ({{year .}})</li>{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib := bibtex.NewBibTex()
+	entry := bibtex.NewBibEntry("misc", "amp")
+	entry.AddField("title", bibtex.NewBibConst(`Tom \& <Jerry>`))
+	entry.AddField("year", bibtex.NewBibConst("1940"))
+	bib.AddEntry(entry)
+	var buf bytes.Buffer
+	if err := Execute(&buf, tmpl, bib); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `<li id="amp">Tom &amp; &lt;Jerry&gt; (1940)</li>`, buf.String(); want != got {
+		t.Errorf("want %s but got %s", want, got)
+	}
+}
+
+func TestExamples(t *testing.T) {
+	f, err := os.Open("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bib, err := bibtex.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := NewBibliography(bib)
+	if want, got := len(bib.Entries), len(data.Entries); want != got {
+		t.Errorf("expected %d entries but got %d", want, got)
+	}
+	total := 0
+	for _, g := range groupBy("type", data.Entries) {
+		total += len(g.Entries)
+	}
+	if want, got := len(bib.Entries), total; want != got {
+		t.Errorf("expected %d grouped entries but got %d", want, got)
+	}
+}
@@ -58,10 +58,11 @@ func NewBibComposite(s BibString) *BibComposite {
 	return comp.Append(s)
 }
 
-// Append adds a BibString to the composite
+// Append adds a BibString to the end of the composite. It modifies c in
+// place and returns c.
 func (c *BibComposite) Append(s BibString) *BibComposite {
-	comp := append(*c, s)
-	return &comp
+	*c = append(*c, s)
+	return c
 }
 
 func (c *BibComposite) String() string {
@@ -79,14 +80,7 @@ func (c *BibComposite) RawString() string {
 		if i > 0 {
 			buf.WriteString(" # ")
 		}
-		switch comp := comp.(type) {
-		case *BibConst:
-			buf.WriteString(comp.RawString())
-		case *BibVar:
-			buf.WriteString(comp.RawString())
-		case *BibComposite:
-			buf.WriteString(comp.RawString())
-		}
+		buf.WriteString(comp.RawString())
 	}
 	return buf.String()
 }
@@ -120,6 +114,12 @@ type prettyStringConfig struct {
 	// priority controls the order in which fields are printed. Keys with lower values are printed earlier.
 	//See keyOrderToPriorityMap
 	priority map[string]int
+	// format formats a field value.
+	format func(BibString) string
+	// casing changes the case of title fields, see WithTitleCasing.
+	casing Casing
+	// protector braces words of title fields, see WithCaseProtection.
+	protector *caseProtector
 }
 
 // keyOrderToPriorityMap is a helper function for WithKeyOrder, converting the user facing key order slice
@@ -133,7 +133,10 @@ func keyOrderToPriorityMap(keyOrder []string) map[string]int {
 	return priority
 }
 
-var defaultPrettyStringConfig = prettyStringConfig{priority: keyOrderToPriorityMap([]string{"title", "author", "url"})}
+var defaultPrettyStringConfig = prettyStringConfig{
+	priority: keyOrderToPriorityMap([]string{"title", "author", "url"}),
+	format:   expandedFormat,
+}
 
 // PrettyStringOpt allows to change the pretty print format for BibEntry and BibTex
 type PrettyStringOpt func(config *prettyStringConfig)
@@ -167,15 +170,19 @@ func (entry *BibEntry) prettyStringAppend(buf *bytes.Buffer, config prettyString
 	// Write fields.
 	tw := tabwriter.NewWriter(buf, 1, 4, 1, ' ', 0)
 	for _, key := range keys {
-		value := entry.Fields[key].String()
-		format := stringformat(value)
-		fmt.Fprintf(tw, "    %s\t=\t"+format+",\n", key, value)
+		fmt.Fprintf(tw, "    %s\t=\t%s,\n", key, config.format(config.caseField(key, entry.Fields[key])))
 	}
 	tw.Flush()
 	buf.WriteString("}\n")
 
 }
 
+// expandedFormat formats a value with its string variables expanded.
+func expandedFormat(s BibString) string {
+	value := s.String()
+	return fmt.Sprintf(stringformat(value), value)
+}
+
 // PrettyString pretty prints a BibEntry
 func (entry *BibEntry) PrettyString(options ...PrettyStringOpt) string {
 	config := defaultPrettyStringConfig
@@ -229,22 +236,23 @@ type BibTex struct {
 	// A list of default BibVars that are implicitly
 	// defined and can be used without defining
 	defaultVars map[string]string
+
+	// Whether lookups of default vars leave StringVar unchanged, see
+	// WithoutImplicitStringVars.
+	hideDefaultVars bool
+
+	// Position of the first entry with each cite key, see Entry.
+	index map[string]int
+	// Length of Entries when index was last updated.
+	indexed int
 }
 
 // NewBibTex creates a new BibTex data structure.
 func NewBibTex() *BibTex {
-	// Sets up some default vars
-	months := map[string]time.Month{
-		"jan": 1, "feb": 2, "mar": 3,
-		"apr": 4, "may": 5, "jun": 6,
-		"jul": 7, "aug": 8, "sep": 9,
-		"oct": 10, "nov": 11, "dec": 12,
-	}
-
+	// Sets up some default vars, see WithMonthNames for other languages.
 	defaultVars := make(map[string]string)
-	for mth, month := range months {
-		// TODO(nickng): i10n of month name in user's local language
-		defaultVars[mth] = month.String()
+	for i, mth := range monthMacros {
+		defaultVars[mth] = time.Month(i + 1).String()
 	}
 
 	return &BibTex{
@@ -264,6 +272,12 @@ func (bib *BibTex) AddPreamble(p BibString) {
 // AddEntry adds an entry to the BibTeX data structure.
 func (bib *BibTex) AddEntry(entry *BibEntry) {
 	bib.Entries = append(bib.Entries, entry)
+	if bib.index != nil && bib.indexed == len(bib.Entries)-1 {
+		if _, ok := bib.index[entry.CiteName]; !ok {
+			bib.index[entry.CiteName] = len(bib.Entries) - 1
+		}
+		bib.indexed++
+	}
 }
 
 // AddStringVar adds a new string var (if does not exist).
@@ -288,6 +302,9 @@ func (bib *BibTex) GetStringVar(key string) *BibVar {
 // and use them even though it hasn't been defined in the bib.
 func (bib *BibTex) getDefaultVar(key string) (*BibVar, bool) {
 	if v, ok := bib.defaultVars[key]; ok {
+		if bib.hideDefaultVars {
+			return &BibVar{Key: key, Value: NewBibConst(v)}, true
+		}
 		// if found, add this to the BibTex
 		bib.StringVar[key] = &BibVar{Key: key, Value: NewBibConst(v)}
 		return bib.StringVar[key], true
@@ -350,6 +367,12 @@ func stringformat(v string) string {
 		return "{%s}"
 	}
 
+	// BibTeX has no escapes, so strings that %q would escape (such as
+	// newlines and backslashes) are also brace quoted.
+	if strconv.Quote(v) != `"`+v+`"` {
+		return "{%s}"
+	}
+
 	// Default to quoted string.
 	return "%q"
 }
@@ -2,6 +2,7 @@
 package bibtex
 
 import (
+	"context"
 	"io"
 )
 
@@ -9,8 +10,6 @@ type bibTag struct {
 	key string
 	val BibString
 }
-
-var bib *BibTex // Only for holding current bib
 %}
 
 %union {
@@ -36,15 +35,15 @@ var bib *BibTex // Only for holding current bib
 top : bibtex { }
     ;
 
-bibtex : /* empty */          { $$ = NewBibTex(); bib = $$ }
+bibtex : /* empty */          { $$ = bibtexlex.(*lexer).newBibTex() }
        | bibtex bibentry      { $$ = $1; $$.AddEntry($2) }
        | bibtex commententry  { $$ = $1 }
        | bibtex stringentry   { $$ = $1; $$.AddStringVar($2.key, $2.val) }
        | bibtex preambleentry { $$ = $1; $$.AddPreamble($2) }
        ;
 
-bibentry : tATSIGN tBAREIDENT tLBRACE tBAREIDENT tCOMMA tags tRBRACE { $$ = NewBibEntry($2, $4); for _, t := range $6 { $$.AddField(t.key, t.val) } }
-         | tATSIGN tBAREIDENT tLPAREN tBAREIDENT tCOMMA tags tRPAREN { $$ = NewBibEntry($2, $4); for _, t := range $6 { $$.AddField(t.key, t.val) } }
+bibentry : tATSIGN tBAREIDENT tLBRACE tBAREIDENT tCOMMA tags tRBRACE { $$ = bibtexlex.(*lexer).newBibEntry($2, $4, $6) }
+         | tATSIGN tBAREIDENT tLPAREN tBAREIDENT tCOMMA tags tRPAREN { $$ = bibtexlex.(*lexer).newBibEntry($2, $4, $6) }
          ;
 
 commententry : tATSIGN tCOMMENT tCOMMENTBODY { }
@@ -59,9 +58,9 @@ preambleentry : tATSIGN tPREAMBLE tLBRACE longstring tRBRACE { $$ = $4 }
               ;
 
 longstring :                  tIDENT     { $$ = NewBibConst($1) }
-           |                  tBAREIDENT { $$ = bib.GetStringVar($1) }
+           |                  tBAREIDENT { $$ = bibtexlex.(*lexer).stringVar($1) }
            | longstring tPOUND tIDENT     { $$ = NewBibComposite($1); $$.(*BibComposite).Append(NewBibConst($3))}
-           | longstring tPOUND tBAREIDENT { $$ = NewBibComposite($1); $$.(*BibComposite).Append(bib.GetStringVar($3)) }
+           | longstring tPOUND tBAREIDENT { $$ = NewBibComposite($1); $$.(*BibComposite).Append(bibtexlex.(*lexer).stringVar($3)) }
            ;
 
 tag : /* empty */                { }
@@ -76,14 +75,33 @@ tags : tag            { if $1 != nil { $$ = []*bibTag{$1}; } }
 
 // Parse is the entry point to the bibtex parser.
 func Parse(r io.Reader) (*BibTex, error) {
-	l := newLexer(r)
+	return ParseWithOptions(r)
+}
+
+// ParseWithOptions parses a bib file like Parse, configured by options.
+//
+// By default, parsing stops at the first error: a syntax error, an unknown
+// macro or an exceeded limit. With WithLenientParsing, ParseWithOptions
+// instead skips the items that fail to parse and returns the remaining
+// bibliography together with the errors of the skipped items.
+func ParseWithOptions(r io.Reader, options ...ParseOpt) (*BibTex, error) {
+	return ParseContext(context.Background(), r, options...)
+}
+
+// ParseContext parses a bib file like ParseWithOptions. Between items, it
+// stops with the error of ctx when ctx is done, and reports the progress to
+// the callback of WithProgress.
+func ParseContext(ctx context.Context, r io.Reader, options ...ParseOpt) (*BibTex, error) {
+	config := newParseConfig(options...)
+	config.ctx = ctx
+	if config.mode == lenientMode {
+		return parseLenient(r, config)
+	}
+	l := newLexer(r, config)
 	bibtexParse(l)
-	switch {
-	case len(l.Errors) > 0: // Non-yacc errors
-		return nil, l.Errors[0]
-	case len(l.ParseErrors) > 0:
-		return nil, l.ParseErrors[0]
-	default:
-		return bib, nil
+	if err := l.err(); err != nil {
+		return nil, err
 	}
+	l.progress()
+	return l.newBibTex(), nil
 }
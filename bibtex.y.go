@@ -8,6 +8,7 @@ import __yyfmt__ "fmt"
 //line bibtex.y:2
 
 import (
+	"context"
 	"io"
 )
 
@@ -16,9 +17,7 @@ type bibTag struct {
 	val BibString
 }
 
-var bib *BibTex // Only for holding current bib
-
-//line bibtex.y:16
+//line bibtex.y:15
 type bibtexSymType struct {
 	yys      int
 	bibtex   *BibTex
@@ -73,20 +72,39 @@ const bibtexEofCode = 1
 const bibtexErrCode = 2
 const bibtexInitialStackSize = 16
 
-//line bibtex.y:75
+//line bibtex.y:74
 
 // Parse is the entry point to the bibtex parser.
 func Parse(r io.Reader) (*BibTex, error) {
-	l := newLexer(r)
+	return ParseWithOptions(r)
+}
+
+// ParseWithOptions parses a bib file like Parse, configured by options.
+//
+// By default, parsing stops at the first error: a syntax error, an unknown
+// macro or an exceeded limit. With WithLenientParsing, ParseWithOptions
+// instead skips the items that fail to parse and returns the remaining
+// bibliography together with the errors of the skipped items.
+func ParseWithOptions(r io.Reader, options ...ParseOpt) (*BibTex, error) {
+	return ParseContext(context.Background(), r, options...)
+}
+
+// ParseContext parses a bib file like ParseWithOptions. Between items, it
+// stops with the error of ctx when ctx is done, and reports the progress to
+// the callback of WithProgress.
+func ParseContext(ctx context.Context, r io.Reader, options ...ParseOpt) (*BibTex, error) {
+	config := newParseConfig(options...)
+	config.ctx = ctx
+	if config.mode == lenientMode {
+		return parseLenient(r, config)
+	}
+	l := newLexer(r, config)
 	bibtexParse(l)
-	switch {
-	case len(l.Errors) > 0: // Non-yacc errors
-		return nil, l.Errors[0]
-	case len(l.ParseErrors) > 0:
-		return nil, l.ParseErrors[0]
-	default:
-		return bib, nil
+	if err := l.err(); err != nil {
+		return nil, err
 	}
+	l.progress()
+	return l.newBibTex(), nil
 }
 
 //line yacctab:1
@@ -501,130 +519,123 @@ bibtexdefault:
 
 	case 1:
 		bibtexDollar = bibtexS[bibtexpt-1 : bibtexpt+1]
-//line bibtex.y:36
+//line bibtex.y:35
 		{
 		}
 	case 2:
 		bibtexDollar = bibtexS[bibtexpt-0 : bibtexpt+1]
-//line bibtex.y:39
+//line bibtex.y:38
 		{
-			bibtexVAL.bibtex = NewBibTex()
-			bib = bibtexVAL.bibtex
+			bibtexVAL.bibtex = bibtexlex.(*lexer).newBibTex()
 		}
 	case 3:
 		bibtexDollar = bibtexS[bibtexpt-2 : bibtexpt+1]
-//line bibtex.y:40
+//line bibtex.y:39
 		{
 			bibtexVAL.bibtex = bibtexDollar[1].bibtex
 			bibtexVAL.bibtex.AddEntry(bibtexDollar[2].bibentry)
 		}
 	case 4:
 		bibtexDollar = bibtexS[bibtexpt-2 : bibtexpt+1]
-//line bibtex.y:41
+//line bibtex.y:40
 		{
 			bibtexVAL.bibtex = bibtexDollar[1].bibtex
 		}
 	case 5:
 		bibtexDollar = bibtexS[bibtexpt-2 : bibtexpt+1]
-//line bibtex.y:42
+//line bibtex.y:41
 		{
 			bibtexVAL.bibtex = bibtexDollar[1].bibtex
 			bibtexVAL.bibtex.AddStringVar(bibtexDollar[2].bibtag.key, bibtexDollar[2].bibtag.val)
 		}
 	case 6:
 		bibtexDollar = bibtexS[bibtexpt-2 : bibtexpt+1]
-//line bibtex.y:43
+//line bibtex.y:42
 		{
 			bibtexVAL.bibtex = bibtexDollar[1].bibtex
 			bibtexVAL.bibtex.AddPreamble(bibtexDollar[2].strings)
 		}
 	case 7:
 		bibtexDollar = bibtexS[bibtexpt-7 : bibtexpt+1]
-//line bibtex.y:46
+//line bibtex.y:45
 		{
-			bibtexVAL.bibentry = NewBibEntry(bibtexDollar[2].strval, bibtexDollar[4].strval)
-			for _, t := range bibtexDollar[6].bibtags {
-				bibtexVAL.bibentry.AddField(t.key, t.val)
-			}
+			bibtexVAL.bibentry = bibtexlex.(*lexer).newBibEntry(bibtexDollar[2].strval, bibtexDollar[4].strval, bibtexDollar[6].bibtags)
 		}
 	case 8:
 		bibtexDollar = bibtexS[bibtexpt-7 : bibtexpt+1]
-//line bibtex.y:47
+//line bibtex.y:46
 		{
-			bibtexVAL.bibentry = NewBibEntry(bibtexDollar[2].strval, bibtexDollar[4].strval)
-			for _, t := range bibtexDollar[6].bibtags {
-				bibtexVAL.bibentry.AddField(t.key, t.val)
-			}
+			bibtexVAL.bibentry = bibtexlex.(*lexer).newBibEntry(bibtexDollar[2].strval, bibtexDollar[4].strval, bibtexDollar[6].bibtags)
 		}
 	case 9:
 		bibtexDollar = bibtexS[bibtexpt-3 : bibtexpt+1]
-//line bibtex.y:50
+//line bibtex.y:49
 		{
 		}
 	case 10:
 		bibtexDollar = bibtexS[bibtexpt-7 : bibtexpt+1]
-//line bibtex.y:53
+//line bibtex.y:52
 		{
 			bibtexVAL.bibtag = &bibTag{key: bibtexDollar[4].strval, val: bibtexDollar[6].strings}
 		}
 	case 11:
 		bibtexDollar = bibtexS[bibtexpt-7 : bibtexpt+1]
-//line bibtex.y:54
+//line bibtex.y:53
 		{
 			bibtexVAL.bibtag = &bibTag{key: bibtexDollar[4].strval, val: bibtexDollar[6].strings}
 		}
 	case 12:
 		bibtexDollar = bibtexS[bibtexpt-5 : bibtexpt+1]
-//line bibtex.y:57
+//line bibtex.y:56
 		{
 			bibtexVAL.strings = bibtexDollar[4].strings
 		}
 	case 13:
 		bibtexDollar = bibtexS[bibtexpt-5 : bibtexpt+1]
-//line bibtex.y:58
+//line bibtex.y:57
 		{
 			bibtexVAL.strings = bibtexDollar[4].strings
 		}
 	case 14:
 		bibtexDollar = bibtexS[bibtexpt-1 : bibtexpt+1]
-//line bibtex.y:61
+//line bibtex.y:60
 		{
 			bibtexVAL.strings = NewBibConst(bibtexDollar[1].strval)
 		}
 	case 15:
 		bibtexDollar = bibtexS[bibtexpt-1 : bibtexpt+1]
-//line bibtex.y:62
+//line bibtex.y:61
 		{
-			bibtexVAL.strings = bib.GetStringVar(bibtexDollar[1].strval)
+			bibtexVAL.strings = bibtexlex.(*lexer).stringVar(bibtexDollar[1].strval)
 		}
 	case 16:
 		bibtexDollar = bibtexS[bibtexpt-3 : bibtexpt+1]
-//line bibtex.y:63
+//line bibtex.y:62
 		{
 			bibtexVAL.strings = NewBibComposite(bibtexDollar[1].strings)
 			bibtexVAL.strings.(*BibComposite).Append(NewBibConst(bibtexDollar[3].strval))
 		}
 	case 17:
 		bibtexDollar = bibtexS[bibtexpt-3 : bibtexpt+1]
-//line bibtex.y:64
+//line bibtex.y:63
 		{
 			bibtexVAL.strings = NewBibComposite(bibtexDollar[1].strings)
-			bibtexVAL.strings.(*BibComposite).Append(bib.GetStringVar(bibtexDollar[3].strval))
+			bibtexVAL.strings.(*BibComposite).Append(bibtexlex.(*lexer).stringVar(bibtexDollar[3].strval))
 		}
 	case 18:
 		bibtexDollar = bibtexS[bibtexpt-0 : bibtexpt+1]
-//line bibtex.y:67
+//line bibtex.y:66
 		{
 		}
 	case 19:
 		bibtexDollar = bibtexS[bibtexpt-3 : bibtexpt+1]
-//line bibtex.y:68
+//line bibtex.y:67
 		{
 			bibtexVAL.bibtag = &bibTag{key: bibtexDollar[1].strval, val: bibtexDollar[3].strings}
 		}
 	case 20:
 		bibtexDollar = bibtexS[bibtexpt-1 : bibtexpt+1]
-//line bibtex.y:71
+//line bibtex.y:70
 		{
 			if bibtexDollar[1].bibtag != nil {
 				bibtexVAL.bibtags = []*bibTag{bibtexDollar[1].bibtag}
@@ -632,7 +643,7 @@ bibtexdefault:
 		}
 	case 21:
 		bibtexDollar = bibtexS[bibtexpt-3 : bibtexpt+1]
-//line bibtex.y:72
+//line bibtex.y:71
 		{
 			if bibtexDollar[3].bibtag == nil {
 				bibtexVAL.bibtags = bibtexDollar[1].bibtags
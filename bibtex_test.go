@@ -2,10 +2,12 @@ package bibtex
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -158,7 +160,7 @@ func TestPrettyStringRoundTrip(t *testing.T) {
 		}
 
 		// Parse into BibTeX.
-		bib, err = Parse(bytes.NewReader(b))
+		bib, err := Parse(bytes.NewReader(b))
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -191,6 +193,58 @@ func TestUnexpectedAtSign(t *testing.T) {
 	}
 }
 
+func TestParseTrailingComma(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`@article{a, title = {A},}
+Text between entries.
+@misc{b, title = {B},
+}
+More text.
+@misc{c, title = {C}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bib.Entries) != 3 {
+		t.Errorf("expected 3 entries but got %d", len(bib.Entries))
+	}
+}
+
+func TestParseConcatenation(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`@string{b = "B"}
+@article{x, title = "a" # b # "c"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	title := bib.Entries[0].Fields["title"]
+	if want, got := "aBc", title.String(); want != got {
+		t.Errorf("expected title %q but got %q", want, got)
+	}
+
+	comp := NewBibComposite(NewBibConst("a"))
+	comp.Append(NewBibConst("b"))
+	if want, got := 2, len(*comp); want != got {
+		t.Errorf("expected Append to extend the composite to %d parts but got %d", want, got)
+	}
+}
+
+func TestPrettyStringQuoting(t *testing.T) {
+	entry := NewBibEntry("misc", "q")
+	entry.AddField("title", NewBibConst("Plain title"))
+	entry.AddField("note", NewBibConst("Two\nlines with \\relax"))
+	entry.AddField("howpublished", NewBibConst(`Say "hi"`))
+	s := entry.PrettyString()
+	for _, want := range []string{`"Plain title"`, "{Two\nlines with \\relax}", `{Say "hi"}`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in\n%s", want, s)
+		}
+	}
+	bib, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEntriesEqual(t, entry, bib.Entries[0])
+}
+
 func AssertEntryListsEqual(t *testing.T, a, b []*BibEntry) {
 	t.Helper()
 
@@ -268,3 +322,1391 @@ func TestBibEntry_PrettyStringCustomOrder(t *testing.T) {
 	}
 
 }
+
+func TestDecodeTeX(t *testing.T) {
+	tests := []struct{ tex, want string }{
+		{`G{\"o}del`, "Gödel"},
+		{`Stra\ss e`, "Straße"},
+		{`\'{E}cole \c{c}a {\'\i}`, "École ça í"},
+		{`\emph{Hello}~World -- again`, "Hello World – again"},
+		{"{\\aa}ngstr\\\"om\n  units", "ångström units"},
+		{`$\alpha$-helix \& more`, "α-helix & more"},
+	}
+	for _, tt := range tests {
+		if got := DecodeTeX(tt.tex); got != tt.want {
+			t.Errorf("DecodeTeX(%q) = %q, want %q", tt.tex, got, tt.want)
+		}
+	}
+	if want, got := "Godel", ASCIIFold(`G{\"o}del`); want != got {
+		t.Errorf("ASCIIFold: want %q but got %q", want, got)
+	}
+}
+
+func TestParseNames(t *testing.T) {
+	tests := []struct {
+		names string
+		want  []Name
+	}{
+		{"Donald E. Knuth", []Name{{First: "Donald E.", Last: "Knuth"}}},
+		{"Ludwig van Beethoven and Doe, Jane", []Name{
+			{First: "Ludwig", Von: "van", Last: "Beethoven"},
+			{First: "Jane", Last: "Doe"},
+		}},
+		{"van der Waals, J. D.", []Name{{First: "J. D.", Von: "van der", Last: "Waals"}}},
+		{"Ford, Jr., Henry AND others", []Name{{First: "Henry", Last: "Ford", Jr: "Jr."}, {Last: "others"}}},
+		{"{Barnes and Noble}", []Name{{Last: "{Barnes and Noble}"}}},
+		{`Charles Louis Xavier Joseph de la Vall{\'e}e Poussin`, []Name{
+			{First: "Charles Louis Xavier Joseph", Von: "de la", Last: `Vall{\'e}e Poussin`},
+		}},
+	}
+	for _, tt := range tests {
+		got := ParseNames(tt.names)
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseNames(%q) = %#v, want %#v", tt.names, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseNames(%q)[%d] = %#v, want %#v", tt.names, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@article{knuth84, author = {Knuth, Donald E.}, title = {Literate Programming}, year = 1984, keywords = {programming}}
+@article{knuth21, author = {Knuth, Donald E.}, title = {Draft notes}, date = {2021-03}, keywords = {draft}}
+@book{goedel31, author = {G{\"o}del, Kurt}, title = {{\"U}ber formal unentscheidbare S{\"a}tze}, year = 1931}
+@inbook{escher, author = {Escher, M. C.}, title = {Drawing Hands}, year = 2022, doi = {10.1/x}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{``, "knuth84 knuth21 goedel31 escher"},
+		{`type:article AND year>=2020 AND author:"Knuth"`, "knuth21"},
+		{`type:article AND NOT keywords~"dra+ft"`, "knuth84"},
+		{`type:book`, "goedel31"},
+		{`title~"^draft"`, "knuth21"},
+		{`author:Godel OR author:"Gödel"`, "goedel31"},
+		{`title="über formal unentscheidbare sätze"`, "goedel31"},
+		{`has:doi`, "escher"},
+		{`year<1984 || (key:escher !has:keywords)`, "goedel31 escher"},
+		{`programming`, "knuth84"},
+		{`year>=1984 year<=2021`, "knuth84 knuth21"},
+	}
+	for _, tt := range tests {
+		filtered, err := bib.Filter(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		var keys []string
+		for _, entry := range filtered.Entries {
+			keys = append(keys, entry.CiteName)
+		}
+		if got := strings.Join(keys, " "); tt.want != got {
+			t.Errorf("%s: want %q but got %q", tt.query, tt.want, got)
+		}
+	}
+	for _, query := range []string{`(type:article`, `year>=`, `title:"open`, `title~"("`, `AND`} {
+		if _, err := bib.Filter(query); !errors.Is(err, ErrQuery) {
+			t.Errorf("%s: expected ErrQuery but got %v", query, err)
+		}
+	}
+	filtered, err := bib.Filter(`type:book`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered.AddStringVar("acm", NewBibConst("ACM"))
+	filtered.AddPreamble(NewBibConst("x"))
+	if _, ok := bib.StringVar["acm"]; ok || len(bib.Preambles) != 0 {
+		t.Errorf("expected macros and preambles of the filtered copy to be separate")
+	}
+	hidden, err := ParseWithOptions(strings.NewReader(`@misc{m, month = jan}`), WithoutImplicitStringVars())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filtered, err = hidden.Filter(``); err != nil {
+		t.Fatal(err)
+	}
+	filtered.GetStringVar("jan")
+	if _, ok := filtered.StringVar["jan"]; ok {
+		t.Errorf("expected the filtered copy to keep implicit string variables hidden")
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@article{knuth84, author = {Knuth, Donald E.}, title = {Literate Programming}, journal = {The Computer Journal}, year = 1984, doi = {10.1093/comjnl/27.2.97}}
+@article{Knuth1984, author = {Donald Knuth}, title = {{L}iterate programming.}, year = 1984}
+@misc{lp, title = {Literate Programming (preprint)}, doi = {https://doi.org/10.1093/COMJNL/27.2.97}}
+@book{taocp1, title = {The Art of Computer Programming}, isbn = {0-201-89683-4}, year = 1997}
+@book{taocp1b, title = {TAOCP, Vol. 1}, isbn = {978-0-201-89683-1}, year = 1997}
+@article{baez, author = {Baez, John}, title = {Higher-Dimensional Algebra V}, eprint = {math/0307200v3}, eprinttype = {arxiv}}
+@online{baez2, author = {Baez, John}, title = {HDA5}, url = {https://arxiv.org/abs/math/0307200}}
+@article{other, author = {Knuth, Donald E.}, title = {Literate Programming}, year = 1984, doi = {10.1/other}}
+@article{knuth92, author = {Knuth, Donald E.}, title = {Literate Programming}, year = 1992}
+@misc{anon1, title = {Anonymous}, year = 2000}
+@misc{anon2, title = {Anonymous.}, year = 2000}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := FindDuplicates(bib)
+	var got []string
+	for _, g := range groups {
+		var keys []string
+		for _, entry := range g.Entries {
+			keys = append(keys, entry.CiteName)
+		}
+		got = append(got, fmt.Sprintf("%s %.2f", strings.Join(keys, ","), g.Confidence))
+	}
+	want := []string{
+		"knuth84,Knuth1984,lp 0.90",
+		"taocp1,taocp1b 0.95",
+		"baez,baez2 0.95",
+	}
+	if strings.Join(want, "\n") != strings.Join(got, "\n") {
+		t.Errorf("want:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := NewBibEntry("article", "knuth84")
+	a.AddField("Author", NewBibConst("Knuth, D. E."))
+	a.AddField("title", NewBibConst("Literate Programming"))
+	a.AddField("year", NewBibConst("1984"))
+	b := NewBibEntry("misc", "lp")
+	b.AddField("author", NewBibConst("Knuth, Donald E."))
+	b.AddField("title", NewBibConst("{L}iterate programming"))
+	b.AddField("doi", NewBibConst("10.1093/comjnl/27.2.97"))
+	b.AddField("pages", NewBibConst("97--111"))
+	a.AddField("pages", NewBibConst("97-111"))
+	b.AddField("year", NewBibConst(" 1984"))
+	tests := []struct {
+		policy MergePolicy
+		want   string
+	}{
+		{PreferLonger, "Author=Knuth, Donald E.;doi=10.1093/comjnl/27.2.97;pages=97--111;title=Literate Programming;year=1984"},
+		{PreferFirst, "Author=Knuth, D. E.;doi=10.1093/comjnl/27.2.97;pages=97-111;title=Literate Programming;year=1984"},
+		{KeepBoth, "Author=Knuth, D. E.;doi=10.1093/comjnl/27.2.97;note=author: Knuth, Donald E.; pages: 97--111;pages=97-111;title=Literate Programming;year=1984"},
+	}
+	for _, tt := range tests {
+		merged := Merge(a, b, tt.policy)
+		if merged.Type != "article" || merged.CiteName != "knuth84" {
+			t.Errorf("policy %d: expected @article{knuth84} but got @%s{%s}", tt.policy, merged.Type, merged.CiteName)
+		}
+		var fields []string
+		for name, value := range merged.Fields {
+			fields = append(fields, name+"="+value.String())
+		}
+		sort.Strings(fields)
+		if got := strings.Join(fields, ";"); tt.want != got {
+			t.Errorf("policy %d: want %q but got %q", tt.policy, tt.want, got)
+		}
+	}
+	a.CiteName = "knuth 84"
+	if merged := Merge(a, b, PreferFirst); merged.CiteName != "knuth 84" {
+		t.Errorf("expected cite key %q but got %q", "knuth 84", merged.CiteName)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, err := Parse(strings.NewReader(`
+@string{tcs = {Theoretical Computer Science}}
+@string{old = {Unused}}
+@article{knuth84, author = {Knuth, Donald E.}, title = {Literate Programming}, year = 1984, month = jan}
+@book{taocp, author = {Knuth, Donald E.}, title = {The Art of Computer Programming}, year = 1968}
+@misc{gone, title = {Removed}}
+@article{lp, title = {Linear Programming}, doi = {10.1/lp}, journal = tcs}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := Parse(strings.NewReader(`
+@string{tcs = {Theor. Comput. Sci.}}
+@article{lp2023, journal = tcs, doi = {10.1/LP}, title = {Linear Programming}}
+@article{knuth84, title = {Literate Programming}, YEAR = 1984, author = {Knuth, Donald E.}, month = jan}
+@article{knuth68, author = {Knuth, Donald E.}, title = {The Art of Computer Programming.}, year = 1968, volume = 1}
+@misc{fresh, title = {Added}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Diff(old, new)
+	want := `- @string{old} = {Unused}
+- @string{tcs} = {Theoretical Computer Science}
++ @string{tcs} = {Theor. Comput. Sci.}
+- @misc{gone}
+    - title = {Removed}
++ @misc{fresh}
+    + title = {Added}
+~ @article{lp -> lp2023}
+    - doi = {10.1/lp}
+    + doi = {10.1/LP}
+    - journal = {Theoretical Computer Science}
+    + journal = {Theor. Comput. Sci.}
+~ @book -> @article{taocp -> knuth68}
+    - title = {The Art of Computer Programming}
+    + title = {The Art of Computer Programming.}
+    + volume = {1}
+`
+	if got := d.String(); want != got {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if d := Diff(old, old); !d.Empty() {
+		t.Errorf("expected no differences but got:\n%s", d)
+	}
+	emptied, err := Parse(strings.NewReader(`
+@string{tcs = {}}
+@string{old = {Unused}}
+@article{knuth84, author = {Knuth, Donald E.}, title = {Literate Programming}, year = 1984, month = jan, note = {}}
+@book{taocp, author = {Knuth, Donald E.}, title = {}, year = 1968}
+@misc{gone, title = {Removed}}
+@article{lp, title = {Linear Programming}, doi = {10.1/lp}, journal = tcs}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = Diff(old, emptied)
+	want = `- @string{tcs} = {Theoretical Computer Science}
++ @string{tcs} = {}
+~ @article{knuth84}
+    + note = {}
+~ @book{taocp}
+    - title = {The Art of Computer Programming}
+    + title = {}
+~ @article{lp}
+    - journal = {Theoretical Computer Science}
+    + journal = {}
+`
+	if got := d.String(); want != got {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if c := d.Changed[0].Fields[0]; c.Old != nil || c.New == nil || *c.New != "" {
+		t.Errorf("expected an added empty note but got %+v", c)
+	}
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`@string{tcs = {Theoretical Computer Science}}
+@preamble{"\newcommand\noop[1]"}
+@article{a, journal = tcs # { (TCS)}, year = 1984, month = jan, title = {{T}itle}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(bib); err != nil {
+		t.Fatal(err)
+	}
+	want := `@string{tcs = {Theoretical Computer Science}}
+@preamble{"\newcommand\noop[1]"}
+
+@article{a,
+    title   = {{T}itle},
+    journal = tcs # { (TCS)},
+    month   = jan,
+    year    = 1984,
+}
+`
+	if got := buf.String(); want != got {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	bib2, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEntryListsEqual(t, bib.Entries, bib2.Entries)
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	parse := func(s string) *BibTex {
+		bib, err := Parse(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bib
+	}
+	base := parse(`@string{tcs = {TCS}}
+@article{a, title = {A}, year = 2000}
+@article{b, title = {B}, year = 2001}
+@article{c, title = {C}}
+@article{d, title = {D}}
+`)
+	ours := parse(`@string{tcs = {Theor. Comput. Sci.}}
+@article{a, title = {A, revised}, year = 2000}
+@article{b, title = {B}, year = 2001, doi = {10.1/b}}
+@article{d, title = {D}, note = {ours}}
+@article{o, title = {Ours}}
+`)
+	theirs := parse(`@string{tcs = {TCS}}
+@article{a, title = {A}, year = 2002}
+@article{b, title = {B}, year = 2001, doi = {10.2/b}}
+@article{c, title = {C}}
+@article{t, title = {Theirs}}
+`)
+	merged, conflicts := ThreeWayMerge(base, ours, theirs)
+	var got []string
+	for _, c := range conflicts {
+		got = append(got, c.String())
+	}
+	sort.Strings(got)
+	if want := "b.doi d.mergeconflict"; strings.Join(got, " ") != want {
+		t.Errorf("expected conflicts %q but got %q", want, strings.Join(got, " "))
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf, WithKeyOrder([]string{"title", "year", "doi", "note"})).Encode(merged); err != nil {
+		t.Fatal(err)
+	}
+	want := `@string{tcs = {Theor. Comput. Sci.}}
+
+@article{a,
+    title = {A, revised},
+    year  = 2002,
+}
+
+@article{b,
+    title = {B},
+    year  = 2001,
+    doi   = {<<<<<<< ours
+{10.1/b}
+=======
+{10.2/b}
+>>>>>>> theirs},
+}
+
+@article{d,
+    title         = {D},
+    note          = {ours},
+    mergeconflict = {entry deleted in theirs},
+}
+
+@article{o,
+    title = {Ours},
+}
+
+@article{t,
+    title = {Theirs},
+}
+`
+	if got := buf.String(); want != got {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if _, err := Parse(&buf); err != nil {
+		t.Errorf("merged output does not parse: %v", err)
+	}
+}
+
+func TestThreeWayMergeText(t *testing.T) {
+	base := `% Shared bibliography.
+@string{tcs = {TCS}}
+
+@comment{Keep me.}
+@article{a, year = 2000, title = {A}}
+
+Text between entries.
+@article{b, title = {B}}
+@article{c, title = {C}}
+@misc{dup, title = {One}}
+@misc{dup, title = {Two}}
+`
+	ours := `% Shared bibliography.
+@string{tcs = {TCS}}
+
+@comment{Keep me.}
+@article{a, year = 2000, title = {A}, note = {ours}}
+
+Text between entries.
+@article{b, title = {B}}
+@article{c, title = {C}}
+@misc{dup, title = {One}}
+@misc{dup, title = {Two, ours}}
+`
+	theirs := `@string{tcs = {Theor. Comput. Sci.}}
+@string{new = {New}}
+@article{a, title = {A}, year = 2001}
+@article{b,
+  title = {B},
+}
+@article{t, title = {Theirs}}
+@misc{dup, title = {One}}
+@misc{dup, title = {Two, theirs}}
+`
+	merged, conflicts, err := ThreeWayMergeText(strings.NewReader(base), strings.NewReader(ours), strings.NewReader(theirs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].String() != "dup.mergeconflict" {
+		t.Errorf("expected conflicts [dup.mergeconflict] but got %v", conflicts)
+	}
+	want := `% Shared bibliography.
+@string{tcs = {Theor. Comput. Sci.}}
+@string{new = {New}}
+
+@comment{Keep me.}
+@article{a,
+    year  = 2001,
+    title = {A},
+    note  = {ours},
+}
+
+Text between entries.
+@article{b, title = {B}}
+
+@article{t, title = {Theirs}}
+@misc{dup, title = {One}}
+@misc{dup, title = {Two, ours}}
+@misc{dup,
+    title         = {Two, theirs},
+    mergeconflict = {duplicate cite key in theirs},
+}
+`
+	if got := string(merged); want != got {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if _, err := Parse(bytes.NewReader(merged)); err != nil {
+		t.Errorf("merged output does not parse: %v", err)
+	}
+	merged, conflicts, err = ThreeWayMergeText(strings.NewReader(base), strings.NewReader(ours), strings.NewReader(base))
+	if err != nil || len(conflicts) > 0 || string(merged) != ours {
+		t.Errorf("expected ours unchanged but got %v %v:\n%s", conflicts, err, merged)
+	}
+	merged, conflicts, err = ThreeWayMergeText(
+		strings.NewReader("@article{a, journal = jacm, year = 2000}\n"),
+		strings.NewReader("@article{a, journal = jacm, year = 2000, note = {ours}}\n"),
+		strings.NewReader("@article{a, journal = jacm, year = 2001}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `@article{a,
+    journal = jacm,
+    year    = 2001,
+    note    = {ours},
+}
+`
+	if got := string(merged); len(conflicts) > 0 || want != got {
+		t.Errorf("want:\n%s\ngot %v:\n%s", want, conflicts, got)
+	}
+}
+
+func TestKeyPattern(t *testing.T) {
+	entry := NewBibEntry("book", "junk")
+	entry.AddField("author", NewBibConst(`G{\"o}del, Kurt and Escher, M. C. and Bach, J. S.`))
+	entry.AddField("title", NewBibConst(`The {Art} of Computer Programming`))
+	entry.AddField("journal", NewBibConst(`Journal of Symbolic Logic`))
+	entry.AddField("date", NewBibConst("1979-05"))
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"[auth:lower][year][shorttitle:1]", "godel1979Art"},
+		{"[auth][shortyear]", "Godel79"},
+		{"[auth3:upper]-[year]", "GOD-1979"},
+		{"[authors]", "GodelEscherBach"},
+		{"[authors2]", "GodelEscherEtAl"},
+		{"[authEtAl]", "GodelEtAl"},
+		{"[shorttitle]", "ArtComputerProgramming"},
+		{"[veryshorttitle:lower]", "art"},
+		{"[title:abbr]", "TAOCP"},
+		{"[journal:abbr]:[title:2]", "JOSL:TheArt"},
+		{"[doi]x", "x"},
+	}
+	for _, tt := range tests {
+		p, err := CompileKeyPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		if got := p.Key(entry); tt.want != got {
+			t.Errorf("%s: want %q but got %q", tt.pattern, tt.want, got)
+		}
+	}
+	for _, pattern := range []string{"[auth", "[]", "[auth:bogus]"} {
+		if _, err := CompileKeyPattern(pattern); !errors.Is(err, ErrKeyPattern) {
+			t.Errorf("%s: expected ErrKeyPattern but got %v", pattern, err)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@article{k1, author = {Knuth, Donald E.}, year = 1984, title = {Literate Programming}}
+@article{knuth1968, author = {Knuth, Donald E.}, year = 1968, title = {Semantics of Context-Free Languages}}
+@article{k2, author = {Knuth, Donald E.}, year = 1984, title = {The TeXbook}}
+@misc{nothing, title = {No Author}, crossref = {k2}}
+@article{k3, author = {Knuth, Donald}, year = 1984, title = {Dancing Links}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := CompileKeyPattern("[auth:lower][year]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bib.Entry("k1") == nil {
+		t.Fatal("expected entry k1")
+	}
+	renamed := bib.Rekey(p)
+	if bib.Entry("knuth1984a") != bib.Entries[0] || bib.Entry("k1") != nil {
+		t.Errorf("expected the index to follow Rekey")
+	}
+	var keys []string
+	for _, entry := range bib.Entries {
+		keys = append(keys, entry.CiteName)
+	}
+	if want, got := "knuth1984a knuth1968 knuth1984b nothing knuth1984c", strings.Join(keys, " "); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+	if want, got := fmt.Sprint(map[string]string{"k1": "knuth1984a", "k2": "knuth1984b", "k3": "knuth1984c"}), fmt.Sprint(renamed); want != got {
+		t.Errorf("want %s but got %s", want, got)
+	}
+	if want, got := "knuth1984b", bib.Entries[3].Fields["crossref"].String(); want != got {
+		t.Errorf("want crossref %q but got %q", want, got)
+	}
+}
+
+func TestRenameKeys(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@inproceedings{a, crossref = {proc}, related = {b, c}}
+@article{b, xref = {proc}}
+@proceedings{proc, title = {Proceedings}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bib.Entry("proc") == nil {
+		t.Fatal("expected entry proc")
+	}
+	for _, renames := range []map[string]string{{"b": "proc"}, {"a": "x", "b": "x"}} {
+		if _, err := bib.RenameKeys(renames); !errors.Is(err, ErrDuplicateKey) {
+			t.Errorf("%v: expected ErrDuplicateKey but got %v", renames, err)
+		}
+	}
+	if n, err := bib.RenameKeys(map[string]string{"proc": "proc2020", "b": "b2"}); n != 2 || err != nil {
+		t.Errorf("expected 2 renames but got %d, %v", n, err)
+	}
+	if bib.Entry("proc2020") != bib.Entries[2] || bib.Entry("proc") != nil {
+		t.Errorf("expected the index to follow RenameKeys")
+	}
+	var got []string
+	for _, entry := range bib.Entries {
+		got = append(got, entry.CiteName)
+		for _, name := range []string{"crossref", "xref", "related"} {
+			if value, ok := entry.Fields[name]; ok {
+				got = append(got, name+"="+value.String())
+			}
+		}
+	}
+	if want := "a crossref=proc2020 related=b2, c b2 xref=proc2020 proc2020"; strings.Join(got, " ") != want {
+		t.Errorf("want %q but got %q", want, strings.Join(got, " "))
+	}
+}
+
+func TestRenameKeysText(t *testing.T) {
+	src := `% References of chapter 1.
+@comment{Keep me.}
+@InProceedings{a,
+  Crossref = "proc",
+  related  = {b,c},
+  journal  = jacm,
+}
+
+Text between entries.
+@article{b, xref = {proc}, note = {proc}}
+@proceedings{ proc , title = {Proceedings}}
+`
+	got, err := RenameKeysText(strings.NewReader(src), map[string]string{"proc": "proc2020", "b": "b2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `% References of chapter 1.
+@comment{Keep me.}
+@InProceedings{a,
+  Crossref = {proc2020},
+  related  = {b2,c},
+  journal  = jacm,
+}
+
+Text between entries.
+@article{b2, xref = {proc2020}, note = {proc}}
+@proceedings{ proc2020 , title = {Proceedings}}
+`
+	if want != string(got) {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if _, err := RenameKeysText(strings.NewReader(src), map[string]string{"a": "b"}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey but got %v", err)
+	}
+	p, err := CompileKeyPattern("[title:lower]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, renames, err := RekeyText(strings.NewReader(src), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "@article{b, xref = {proceedings}, note = {proc}}") || len(renames) != 1 {
+		t.Errorf("unexpected rekeyed text %v:\n%s", renames, got)
+	}
+}
+
+func TestSubset(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@string{acm = "ACM"}
+@string{pub = acm # " Press"}
+@string{unused = "Unused"}
+@preamble{"\newcommand{\noop}[1]{}"}
+@inproceedings{paper, title = {Paper}, crossref = {proc}}
+@proceedings{proc, title = {Proceedings}, publisher = pub, month = jan}
+@article{other, journal = unused}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subset, missing := bib.Subset([]string{"paper", "nosuchkey", "paper"})
+	if want, got := "nosuchkey", strings.Join(missing, " "); want != got {
+		t.Errorf("expected missing keys %q but got %q", want, got)
+	}
+	var keys []string
+	for _, entry := range subset.Entries {
+		keys = append(keys, entry.CiteName)
+	}
+	if want, got := "paper proc", strings.Join(keys, " "); want != got {
+		t.Errorf("expected entries %q but got %q", want, got)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(subset); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`@string{acm = {ACM}}`, `@string{pub = acm # { Press}}`, `@preamble{`} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected subset to contain %s but got\n%s", s, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "unused") || strings.Contains(buf.String(), "@string{jan") {
+		t.Errorf("expected subset without unused macros but got\n%s", buf.String())
+	}
+	if all, _ := bib.Subset([]string{"*"}); len(all.Entries) != 3 {
+		t.Errorf("expected * to select all 3 entries but got %d", len(all.Entries))
+	}
+	german, err := ParseWithOptions(strings.NewReader(`@misc{m, month = mar}`), WithMonthNames(LocalizedMonths["de"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subset, _ = german.Subset([]string{"m"})
+	var want bytes.Buffer
+	if err := NewEncoder(&want).Encode(german); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(subset); err != nil {
+		t.Fatal(err)
+	}
+	if want.String() != buf.String() {
+		t.Errorf("want:\n%s\ngot:\n%s", want.String(), buf.String())
+	}
+}
+
+func TestExpandStrings(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@string{acm = "ACM"}
+@string{pub = acm # " Press"}
+@article{a, publisher = pub, note = "By " # acm, month = jan}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib.ExpandStrings()
+	fields := bib.Entries[0].Fields
+	if want, got := BibConst("ACM Press"), fields["publisher"]; want != got {
+		t.Errorf("expected publisher %#v but got %#v", want, got)
+	}
+	if want, got := BibConst("By ACM"), fields["note"]; want != got {
+		t.Errorf("expected note %#v but got %#v", want, got)
+	}
+	if v, ok := fields["month"].(*BibVar); !ok || v.Key != "jan" {
+		t.Errorf("expected month macro to be kept but got %#v", fields["month"])
+	}
+	if want, got := "acm pub", strings.Join(bib.RemoveUnusedStrings(), " "); want != got {
+		t.Errorf("expected unused macros %q but got %q", want, got)
+	}
+}
+
+func TestCollapseStrings(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@string{tcs = "Theoretical Computer Science"}
+@article{a, journal = "Journal of the ACM", title = "Journal of the ACM"}
+@article{b, journal = "Journal of the ACM"}
+@article{c, journal = "Theoretical Computer Science"}
+@article{d, journal = "Information and Computation"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "jacm", strings.Join(bib.CollapseStrings(2), " "); want != got {
+		t.Errorf("expected new macros %q but got %q", want, got)
+	}
+	var got []string
+	for _, entry := range bib.Entries {
+		got = append(got, rawFormat(entry.Fields["journal"]))
+	}
+	if want := "jacm jacm tcs {Information and Computation}"; strings.Join(got, " ") != want {
+		t.Errorf("expected journals %q but got %q", want, strings.Join(got, " "))
+	}
+	if want, got := "{Journal of the ACM}", rawFormat(bib.Entries[0].Fields["title"]); want != got {
+		t.Errorf("expected title %q to be kept but got %q", want, got)
+	}
+}
+
+func TestApplyStrings(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@string{jacm = "Journal of the ACM"}
+@article{a, journal = jacm}
+@article{b, journal = "Theoretical  Computer Science"}
+@article{c, journal = "Information and Computation"}
+@article{d, note = "J. ACM"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abbrevs, err := Parse(strings.NewReader(`
+@string{jacm = "J. ACM"}
+@string{tcs = "Theoretical Computer Science"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, bib.ApplyStrings(abbrevs); want != got {
+		t.Errorf("expected %d changed values but got %d", want, got)
+	}
+	if _, ok := bib.Entries[3].Fields["note"].(BibConst); !ok {
+		t.Errorf("expected the note to stay constant but got %s", rawFormat(bib.Entries[3].Fields["note"]))
+	}
+	if want, got := 1, bib.ApplyStrings(abbrevs, "note"); want != got {
+		t.Errorf("expected %d changed note but got %d", want, got)
+	}
+	var got []string
+	for _, entry := range bib.Entries[:3] {
+		got = append(got, rawFormat(entry.Fields["journal"])+"="+entry.Fields["journal"].String())
+	}
+	if want := "jacm=J. ACM tcs=Theoretical Computer Science {Information and Computation}=Information and Computation"; strings.Join(got, " ") != want {
+		t.Errorf("expected journals %q but got %q", want, strings.Join(got, " "))
+	}
+}
+
+func TestTitleCasing(t *testing.T) {
+	tests := []struct {
+		title    string
+		sentence string
+		titled   string
+	}{
+		{
+			"The Art of Computer Programming",
+			"The art of computer programming",
+			"The Art of Computer Programming",
+		},
+		{
+			"a study of {ACM} papers: the case of the {\\TeX} book",
+			"A study of {ACM} papers: The case of the {\\TeX} book",
+			"A Study of {ACM} Papers: The Case of the {\\TeX} Book",
+		},
+		{
+			"Caf\\'e culture in built-in \\emph{Paris}",
+			"Caf\\'e culture in built-in \\emph{Paris}",
+			"Caf\\'e Culture in Built-In \\emph{Paris}",
+		},
+		{
+			"What is it for?",
+			"What is it for?",
+			"What Is It For?",
+		},
+	}
+	for _, tt := range tests {
+		if got := SentenceCase(tt.title); got != tt.sentence {
+			t.Errorf("SentenceCase(%q): want %q but got %q", tt.title, tt.sentence, got)
+		}
+		if got := TitleCase(tt.title); got != tt.titled {
+			t.Errorf("TitleCase(%q): want %q but got %q", tt.title, tt.titled, got)
+		}
+	}
+
+	if want, got := "Hidden {Markov} models on {GitHub} and {LaTeX} with {ACM} {3D}", ProtectCase("Hidden markov models on GitHub and LaTeX with ACM 3D", "Markov"); want != got {
+		t.Errorf("ProtectCase: want %q but got %q", want, got)
+	}
+	if want, got := "Already {GitHub}", ProtectCase("Already {GitHub}"); want != got {
+		t.Errorf("ProtectCase: want %q but got %q", want, got)
+	}
+
+	bib, err := Parse(strings.NewReader(`@article{a, title = "Hidden Markov Models on GitHub", journal = "Journal of the ACM"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf, WithTitleCasing(SentenceCase), WithCaseProtection("Markov")).Encode(bib); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"{Hidden {Markov} models on {GitHub}}", "{Journal of the ACM}"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected encoded entry to contain %s but got\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@book{a,
+  Title = {The  Art of
+           Computer Programming},
+  Pages = {1-10, 20 -- 30,45},
+  DOI = {https://doi.org/10.1000/XYZ\_1},
+  ISBN = {0-201-89683-4},
+  URL = {\url{https://example.com/a\_b\%20c}},
+  month = {March},
+}
+@book{b, isbn = {0-201-89683-5}, pages = {xi--xii}, month = 12, doi = {doi:10.1/2}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []Normalizer
+	for _, name := range DefaultNormalizers {
+		steps = append(steps, Normalizers[name])
+	}
+	err = bib.Normalize(steps...)
+	if !errors.Is(err, ErrInvalidISBN) || !strings.HasPrefix(err.Error(), "b: isbn: ") {
+		t.Errorf("expected invalid ISBN error for b but got %v", err)
+	}
+	tests := []struct {
+		entry int
+		field string
+		want  string
+	}{
+		{0, "title", "{The Art of Computer Programming}"},
+		{0, "pages", "{1--10, 20--30, 45}"},
+		{0, "doi", "{10.1000/XYZ_1}"},
+		{0, "isbn", "9780201896831"},
+		{0, "url", "{https://example.com/a_b%20c}"},
+		{0, "month", "mar"},
+		{1, "isbn", "{0-201-89683-5}"},
+		{1, "pages", "{xi--xii}"},
+		{1, "month", "dec"},
+		{1, "doi", "{10.1/2}"},
+	}
+	for _, tt := range tests {
+		value, ok := bib.Entries[tt.entry].Fields[tt.field]
+		if !ok {
+			t.Errorf("%d: expected field %s", tt.entry, tt.field)
+			continue
+		}
+		if got := rawFormat(value); got != tt.want {
+			t.Errorf("%d: expected %s = %s but got %s", tt.entry, tt.field, tt.want, got)
+		}
+	}
+	if _, ok := bib.Entries[0].Fields["Title"]; ok {
+		t.Errorf("expected field names to be lower-cased")
+	}
+
+	if err := bib.Normalize(MonthsToNumbers, NormalizeISBN); err == nil {
+		t.Errorf("expected invalid ISBN error")
+	}
+	if want, got := "3", bib.Entries[0].Fields["month"].String(); want != got {
+		t.Errorf("expected month %s but got %s", want, got)
+	}
+
+	entry := NewBibEntry("book", "c")
+	entry.AddField("isbn", NewBibConst("ISBN 0-8044-2957-X"))
+	if err := NormalizeISBN(entry); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "9780804429573", entry.Fields["isbn"].String(); want != got {
+		t.Errorf("expected ISBN %s but got %s", want, got)
+	}
+	for isbn, want := range map[string]string{
+		"ISBN-13: 978-0-306-40615-7": "9780306406157",
+		"isbn-10 0-306-40615-2":      "9780306406157",
+		"978-0-306-40615-8":          "",
+	} {
+		if got, _ := isbn13(isbn); want != got {
+			t.Errorf("%s: expected ISBN %q but got %q", isbn, want, got)
+		}
+	}
+
+	german, err := ParseWithOptions(strings.NewReader(`@misc{m, month = {March}}`), WithMonthNames(LocalizedMonths["de"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := german.Normalize(MonthsToMacros); err != nil {
+		t.Fatal(err)
+	}
+	month, ok := german.Entries[0].Fields["month"].(*BibVar)
+	if !ok || month.Key != "mar" || !german.isImplicitVar("mar", month) {
+		t.Errorf("expected the month macro of the bibliography but got %#v", german.Entries[0].Fields["month"])
+	}
+}
+
+func TestSort(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@book{e, author = {Ludwig van Beethoven}, title = {Symphonies}, year = 1808}
+@book{b, author = {Knuth, Donald E.}, title = {The {TeXbook}}, year = 1984}
+@article{d, author = {Aksın, Özge and others}, title = {Effect}, date = {2006-03}}
+@book{a, author = {Knuth, Donald E.}, title = {Algorithms}, year = 1968, volume = 10}
+@book{c, author = {Åberg, Anna}, title = {an Apple}, year = 1984, month = feb, volume = 9}
+@misc{f, title = {Untitled}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"key"}, "a b c d e f"},
+		{[]string{"-key"}, "f e d c b a"},
+		{[]string{"author", "year"}, "c d e a b f"},
+		{[]string{"-year", "title"}, "d c b a e f"},
+		{[]string{"title"}, "a c d e b f"},
+		{[]string{"type", "-key"}, "d e c b a f"},
+		{[]string{"volume", "key"}, "c a b d e f"},
+	}
+	for _, tt := range tests {
+		bib.Sort(tt.keys...)
+		var got []string
+		for _, entry := range bib.Entries {
+			got = append(got, entry.CiteName)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Sort(%v): want %q but got %q", tt.keys, tt.want, strings.Join(got, " "))
+		}
+	}
+
+	years, err := Parse(strings.NewReader(`
+@misc{a, year = 999}
+@misc{b, date = {2000-01}}
+@misc{c, year = 2001}
+@misc{d, year = 2000}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	years.Sort("-year")
+	years.Sort("year")
+	var got []string
+	for _, entry := range years.Entries {
+		got = append(got, entry.CiteName)
+	}
+	if strings.Join(got, " ") != "a d b c" {
+		t.Errorf("Sort(year): want %q but got %q", "a d b c", strings.Join(got, " "))
+	}
+}
+
+func TestStats(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@article{a, author = {Knuth, Donald E. and Lamport, Leslie}, journal = {TUGboat}, year = 1984}
+@article{b, author = {Lamport, Leslie and Knuth, Donald E. and Others}, journal = {TUGboat}, year = 1986, doi = {10.1/b}}
+@book{c, author = {Knuth, Donald E.}, title = {The {TeX}book}, year = 1984}
+@misc{d, title = {Anonymous}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "Knuth, Donald E.:3 Lamport, Leslie:2", fmtCounts(bib.Stats().Authors); want != got {
+		t.Errorf("expected authors %q but got %q", want, got)
+	}
+	s := bib.Stats()
+	tests := []struct {
+		name string
+		want string
+		got  []Count
+	}{
+		{"years", "1984:2 1986:1", s.Years},
+		{"types", "article:2 book:1 misc:1", s.Types},
+		{"venues", "TUGboat:2", s.Venues},
+		{"fields", "author:3 year:3 journal:2 title:2 doi:1", s.Fields},
+	}
+	for _, tt := range tests {
+		if got := fmtCounts(tt.got); got != tt.want {
+			t.Errorf("expected %s %q but got %q", tt.name, tt.want, got)
+		}
+	}
+	if want, got := 1, len(s.CoAuthors); want != got || s.CoAuthors[0].Count != 2 || s.CoAuthors[0].Authors != [2]string{"Knuth, Donald E.", "Lamport, Leslie"} {
+		t.Errorf("expected Knuth and Lamport to be co-authors twice but got %v", s.CoAuthors)
+	}
+	if want, got := "article", s.Completeness[0].Type; want != got {
+		t.Fatalf("expected completeness of %s first but got %s", want, got)
+	}
+	var fields []string
+	for _, f := range s.Completeness[0].Fields {
+		fields = append(fields, fmt.Sprintf("%s:%.1f", f.Name, f.Fraction))
+	}
+	if want, got := "author:1.0 journal:1.0 year:1.0 doi:0.5", strings.Join(fields, " "); want != got {
+		t.Errorf("expected article completeness %q but got %q", want, got)
+	}
+}
+
+func fmtCounts(counts []Count) string {
+	var s []string
+	for _, c := range counts {
+		s = append(s, fmt.Sprintf("%s:%d", c.Key, c.Count))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestEntryIndex(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@inproceedings{a, crossref = {proc}, Title = {A}}
+@proceedings{proc, title = {Proceedings}}
+@article{b, title = {B}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := bib.Entry("proc"); entry == nil || entry.Type != "proceedings" {
+		t.Fatalf("expected entry proc but got %v", entry)
+	}
+	if err := bib.RenameEntry("proc", "b"); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey but got %v", err)
+	}
+	if err := bib.RenameEntry("proc", "proc2020"); err != nil {
+		t.Fatal(err)
+	}
+	if bib.Entry("proc") != nil || bib.Entry("proc2020") == nil {
+		t.Errorf("expected proc to be renamed to proc2020")
+	}
+	if want, got := "proc2020", bib.Entry("a").Fields["crossref"].String(); want != got {
+		t.Errorf("expected crossref %s but got %s", want, got)
+	}
+	if err := bib.RemoveEntry("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bib.RemoveEntry("a"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey but got %v", err)
+	}
+	if entry := bib.Entry("b"); entry == nil || entry.CiteName != "b" {
+		t.Errorf("expected entry b after removal but got %v", entry)
+	}
+	if err := bib.ReplaceEntry("b", NewBibEntry("book", "proc2020")); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey but got %v", err)
+	}
+	if err := bib.ReplaceEntry("b", NewBibEntry("book", "c")); err != nil {
+		t.Fatal(err)
+	}
+	if entry := bib.Entry("c"); entry == nil || entry.Type != "book" || bib.Entry("b") != nil {
+		t.Errorf("expected b to be replaced by book c")
+	}
+
+	// Direct changes to Entries are picked up.
+	bib.Entries[0].CiteName = "renamed"
+	bib.Entries = append(bib.Entries, NewBibEntry("misc", "appended"))
+	if bib.Entry("renamed") == nil || bib.Entry("appended") == nil || bib.Entry("proc2020") != nil {
+		t.Errorf("expected index to follow direct changes")
+	}
+	if err := bib.AddUniqueEntry(NewBibEntry("misc", "appended")); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey but got %v", err)
+	}
+	bib.AddEntry(NewBibEntry("misc", "c"))
+	if err := bib.CheckKeys(); !errors.Is(err, ErrDuplicateKey) || !strings.HasSuffix(err.Error(), ": c") {
+		t.Errorf("expected ErrDuplicateKey for c but got %v", err)
+	}
+	first := bib.Entry("c")
+	if first == nil || first.Type != "book" {
+		t.Fatalf("expected the first entry c but got %v", first)
+	}
+	if err := bib.RemoveEntry("c"); err != nil {
+		t.Fatal(err)
+	}
+	if entry := bib.Entry("c"); entry == nil || entry.Type != "misc" {
+		t.Errorf("expected the second entry c after removing the first but got %v", entry)
+	}
+	if want, got := len(bib.Entries), bib.indexed; want != got {
+		t.Errorf("expected %d indexed entries but got %d", want, got)
+	}
+
+	entry := NewBibEntry("article", "x")
+	entry.AddField("Title", NewBibConst("X"))
+	entry.AddField("journal", NewBibConst("J"))
+	if err := entry.RenameField("journal", "title"); !errors.Is(err, ErrDuplicateField) {
+		t.Errorf("expected ErrDuplicateField but got %v", err)
+	}
+	if err := entry.RenameField("journal", "journaltitle"); err != nil {
+		t.Fatal(err)
+	}
+	if err := entry.RenameField("journal", "journaltitle"); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField but got %v", err)
+	}
+	if !entry.RemoveField("title") || entry.RemoveField("title") {
+		t.Errorf("expected title to be removed once")
+	}
+	if want, got := 1, len(entry.Fields); want != got || entry.Fields["journaltitle"] == nil {
+		t.Errorf("expected only journaltitle but got %v", entry.Fields)
+	}
+}
+
+func TestCloneEqual(t *testing.T) {
+	src := `
+@string{acm = "ACM"}
+@preamble{"\newcommand{\noop}[1]{}"}
+@article{a, title = {A}, publisher = acm # " Press", month = jan}
+`
+	bib, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := bib.Clone()
+	if !bib.Equal(c) {
+		t.Fatalf("expected clone to be equal")
+	}
+	c.StringVar["acm"].Value = NewBibConst("Association for Computing Machinery")
+	c.Entries[0].Fields["title"] = NewBibConst("B")
+	if want, got := "ACM Press", bib.Entries[0].Fields["publisher"].String(); want != got {
+		t.Errorf("expected original publisher %q but got %q", want, got)
+	}
+	if want, got := "Association for Computing Machinery Press", c.Entries[0].Fields["publisher"].String(); want != got {
+		t.Errorf("expected cloned publisher to use the cloned macro %q but got %q", want, got)
+	}
+	if bib.Equal(c) || bib.Entries[0].Equal(c.Entries[0]) {
+		t.Errorf("expected changed clone to differ")
+	}
+
+	entry := bib.Entries[0].Clone()
+	if !entry.Equal(bib.Entries[0]) {
+		t.Errorf("expected cloned entry to be equal")
+	}
+	entry.Fields["publisher"] = NewBibConst("ACM Press")
+	if entry.Equal(bib.Entries[0]) {
+		t.Errorf("expected a constant not to equal a macro as written")
+	}
+	if !entry.Equal(bib.Entries[0], WithExpandedStrings()) {
+		t.Errorf("expected a constant to equal a macro when expanded")
+	}
+	if !EqualString(NewBibComposite(NewBibConst("a")).Append(NewBibConst("b")), NewBibConst("ab"), WithExpandedStrings()) {
+		t.Errorf("expected expanded composite to equal constant")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	bib, err := Parse(strings.NewReader(`
+@string{acm = "ACM"}
+@string{pub = acm # " Press"}
+@article{a, publisher = pub, url = {https://example.com/a}, note = "See " # acm}
+@misc{b, howpublished = {\url{https://example.com/b}}, url = {https://example.com/b}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uses, urls []string
+	err = bib.Walk(func(loc Location, s BibString) error {
+		if v, ok := s.(*BibVar); ok && v.Key == "acm" {
+			where := "@string{" + loc.Macro + "}"
+			if loc.Entry != nil {
+				where = loc.Entry.CiteName + "." + loc.Field
+			}
+			uses = append(uses, where)
+		}
+		if loc.Entry != nil && loc.Field == "url" {
+			urls = append(urls, s.String())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "@string{pub} a.note", strings.Join(uses, " "); want != got {
+		t.Errorf("expected uses of acm %q but got %q", want, got)
+	}
+	if want, got := "https://example.com/a https://example.com/b", strings.Join(urls, " "); want != got {
+		t.Errorf("expected urls %q but got %q", want, got)
+	}
+
+	visited := 0
+	errStop := errors.New("stop")
+	err = bib.Walk(func(loc Location, s BibString) error {
+		visited++
+		if _, ok := s.(*BibComposite); ok {
+			return SkipParts
+		}
+		if loc.Entry != nil {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || visited != 4 {
+		t.Errorf("expected walk to stop at the first field after 4 nodes but got %v after %d", err, visited)
+	}
+
+	bib.Rewrite(func(loc Location, s BibString) BibString {
+		if c, ok := s.(BibConst); ok && loc.Entry != nil {
+			return BibConst(strings.ToUpper(string(c)))
+		}
+		return s
+	})
+	if want, got := `{SEE } # acm`, rawFormat(bib.Entry("a").Fields["note"]); want != got {
+		t.Errorf("expected rewritten note %s but got %s", want, got)
+	}
+	if want, got := `{ Press}`, rawFormat((*bib.StringVar["pub"].Value.(*BibComposite))[1]); want != got {
+		t.Errorf("expected macro to be kept as %s but got %s", want, got)
+	}
+	if want, got := `{SEE } # acm`, bib.Entry("a").Fields["note"].RawString(); want != got {
+		t.Errorf("expected RawString %s but got %s", want, got)
+	}
+}
+
+func TestParseMacroOptions(t *testing.T) {
+	src := `@article{a, journal = tcs, month = mar, publisher = pub}`
+	macros, err := Parse(strings.NewReader(`@string{pub = "ACM" # " Press"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib, err := ParseWithOptions(strings.NewReader(src),
+		WithMonthNames(LocalizedMonths["de"]),
+		WithMacros(PlainMacros),
+		WithMacroFile(macros),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := bib.Entries[0].Fields
+	for name, want := range map[string]string{"journal": "Theoretical Computer Science", "month": `M{\"a}rz`, "publisher": "ACM Press"} {
+		if got := fields[name].String(); got != want {
+			t.Errorf("expected %s = %q but got %q", name, want, got)
+		}
+	}
+	if want, got := 3, len(bib.StringVar); want != got {
+		t.Errorf("expected %d implicit string vars but got %d", want, got)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(bib); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "@string") {
+		t.Errorf("expected predefined macros not to be written but got\n%s", buf.String())
+	}
+
+	bib, err = ParseWithOptions(strings.NewReader(src), WithMacros(PlainMacros), WithMacroFile(macros), WithoutImplicitStringVars())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(bib.StringVar); want != got {
+		t.Errorf("expected %d string vars but got %d", want, got)
+	}
+	if want, got := "March", bib.Entries[0].Fields["month"].String(); want != got {
+		t.Errorf("expected month %q but got %q", want, got)
+	}
+	if want, got := "tcs", rawFormat(bib.Entries[0].Fields["journal"]); want != got {
+		t.Errorf("expected journal macro %q but got %q", want, got)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	if _, err := Parse(strings.NewReader(`@article{a, journal = undefined}`)); !errors.Is(err, ErrUnknownStringVar) {
+		t.Errorf("expected error %v but got %v", ErrUnknownStringVar, err)
+	}
+
+	src := `% Uploaded file
+@Article{a, Title = {A}, title = {B}}
+@article{b, journal = undefined, month = feb}
+@article{c, title = {Missing brace}
+@article{a, title = {D}}
+@comment{skipped}
+@string{x = "X"}
+@book{e, title = x}`
+	bib, err := ParseWithOptions(strings.NewReader(src), WithLenientParsing(), WithDialect(BibLaTeX))
+	if err == nil {
+		t.Error("expected error for skipped entry but got none")
+	}
+	var keys []string
+	for _, entry := range bib.Entries {
+		keys = append(keys, entry.CiteName)
+	}
+	if want, got := "a b a e", strings.Join(keys, " "); want != got {
+		t.Fatalf("expected entries %s but got %s", want, got)
+	}
+	if want, got := "B", bib.Entries[0].Fields["title"].String(); want != got {
+		t.Errorf("expected lowercased field title %q but got %q", want, got)
+	}
+	if want, got := "", bib.Entries[1].Fields["journal"].String(); want != got {
+		t.Errorf("expected undefined macro %q but got %q", want, got)
+	}
+	if want, got := "undefined", rawFormat(bib.Entries[1].Fields["journal"]); want != got {
+		t.Errorf("expected undefined macro kept as %q but got %q", want, got)
+	}
+	if want, got := "2", bib.Entries[1].Fields["month"].String(); want != got {
+		t.Errorf("expected biblatex month %q but got %q", want, got)
+	}
+	if want, got := "X", bib.Entries[3].Fields["title"].String(); want != got {
+		t.Errorf("expected macro %q but got %q", want, got)
+	}
+
+	for _, test := range []struct {
+		src     string
+		options []ParseOpt
+		err     error
+	}{
+		{`@article{a, title = {A}, title = {B}}`, []ParseOpt{WithStrictParsing()}, ErrDuplicateField},
+		{`@article{a, title = {A}} @book{a, title = {B}}`, []ParseOpt{WithStrictParsing()}, ErrDuplicateKey},
+		{`@article{a, title = {A}} @book{b, title = {B}}`, []ParseOpt{WithMaxEntries(1)}, ErrLimit},
+		{`@article{a, title = {A {B {C}}}}`, []ParseOpt{WithMaxDepth(2)}, ErrLimit},
+		{`@article{a, title = "A {B {C}}"}`, []ParseOpt{WithMaxDepth(2)}, ErrLimit},
+		{`@article{a, title = {` + strings.Repeat("A", 100) + `}}`, []ParseOpt{WithMaxEntrySize(64)}, ErrLimit},
+		{`@article{a, title = {` + strings.Repeat("A", 100) + `}}`, []ParseOpt{WithMaxEntrySize(64), WithLenientParsing()}, ErrLimit},
+	} {
+		if _, err := ParseWithOptions(strings.NewReader(test.src), test.options...); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v but got %v", test.src, test.err, err)
+		}
+	}
+	if _, err := ParseWithOptions(strings.NewReader(`@article{a, title = {A {B}}} @book{b, title = "B"}`), WithMaxDepth(2), WithMaxEntrySize(64)); err != nil {
+		t.Errorf("expected no error within limits but got %v", err)
+	}
+
+	bib, err = ParseWithOptions(strings.NewReader(`@InProceedings{Knuth  1984 , Title = {T}}`),
+		WithCiteKeySpaces(), WithEntryTypeCase(KeepCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "InProceedings/Knuth 1984", bib.Entries[0].Type+"/"+bib.Entries[0].CiteName; want != got {
+		t.Errorf("expected entry %q but got %q", want, got)
+	}
+	if _, ok := bib.Entries[0].Fields["Title"]; !ok {
+		t.Error("expected field name case to be kept")
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	src := `@article{a, title = {A}}
+@article{b, title = {B}}
+@article{c, title = {C}}
+`
+	for _, options := range [][]ParseOpt{nil, {WithLenientParsing()}} {
+		var reports []Progress
+		options := append(options, WithProgress(func(p Progress) { reports = append(reports, p) }))
+		bib, err := ParseContext(context.Background(), strings.NewReader(src), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := 3, len(bib.Entries); want != got {
+			t.Fatalf("expected %d entries but got %d", want, got)
+		}
+		last := reports[len(reports)-1]
+		if want, got := (Progress{Bytes: int64(len(src)), Entries: 3}), last; want != got {
+			t.Errorf("expected final progress %+v but got %+v", want, got)
+		}
+		for i := 1; i < len(reports); i++ {
+			if reports[i].Bytes < reports[i-1].Bytes || reports[i].Entries < reports[i-1].Entries {
+				t.Errorf("expected increasing progress but got %+v", reports)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		options = append(options, WithProgress(func(p Progress) {
+			if p.Entries == 2 {
+				cancel()
+			}
+		}))
+		if _, err := ParseContext(ctx, strings.NewReader(src), options...); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected error %v but got %v", context.Canceled, err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package bibtex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// caseFields are the fields changed by the casing options of Encoder.
+var caseFields = map[string]bool{"title": true, "subtitle": true, "titleaddon": true}
+
+// titleSmallWords are not capitalized by TitleCase, except at the start or
+// end of a title or after a colon.
+var titleSmallWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "from": true, "in": true, "into": true,
+	"nor": true, "of": true, "on": true, "or": true, "over": true,
+	"per": true, "the": true, "to": true, "via": true, "vs": true,
+	"with": true,
+}
+
+// titleToken is a word or the text between words of a title.
+type titleToken struct {
+	text  string
+	word  bool
+	start bool // First word of the title or of a part after a colon.
+	cont  bool // Continues the previous word after an accent command.
+}
+
+// titleTokens splits a TeX title into words and the text between them.
+// Braced groups and TeX commands are never words.
+func titleTokens(s string) []titleToken {
+	var tokens []titleToken
+	other := func(text string) {
+		if n := len(tokens); n > 0 && !tokens[n-1].word {
+			tokens[n-1].text += text
+			return
+		}
+		tokens = append(tokens, titleToken{text: text})
+	}
+	start, cont := true, false
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '{':
+			j, depth := i, 0
+			for ; j < len(s); j++ {
+				if s[j] == '\\' {
+					j++
+				} else if s[j] == '{' {
+					depth++
+				} else if s[j] == '}' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			j = min(j+1, len(s))
+			other(s[i:j])
+			i, start, cont = j, false, false
+		case r == '\\':
+			j := i + 1
+			for j < len(s) && isASCIILetter(s[j]) {
+				j++
+			}
+			accent := j == i+1 && j < len(s) && strings.IndexByte("'`^\"~=.", s[j]) >= 0
+			if j == i+1 && j < len(s) {
+				j++
+			}
+			wasWord := len(tokens) > 0 && tokens[len(tokens)-1].word
+			other(s[i:j])
+			i, cont = j, accent && wasWord
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			j := i + size
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, titleToken{text: s[i:j], word: true, start: start, cont: cont})
+			i, start, cont = j, false, false
+		default:
+			if r == ':' || r == '?' || r == '!' {
+				start = true
+			}
+			other(s[i : i+size])
+			i, cont = i+size, false
+		}
+	}
+	return tokens
+}
+
+func isASCIILetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+func joinTokens(tokens []titleToken) string {
+	var buf strings.Builder
+	for _, t := range tokens {
+		buf.WriteString(t.text)
+	}
+	return buf.String()
+}
+
+// SentenceCase returns title in sentence case: the first letter of the
+// title and of each part after a colon, question or exclamation mark is
+// upper case, and all other letters are lower case. Braced groups and TeX
+// commands are kept as they are, so acronyms and proper nouns must be
+// braced (see ProtectCase) to keep their case.
+func SentenceCase(title string) string {
+	tokens := titleTokens(title)
+	for i, t := range tokens {
+		if !t.word {
+			continue
+		}
+		tokens[i].text = strings.ToLower(t.text)
+		if t.start {
+			tokens[i].text = upperFirst(tokens[i].text)
+		}
+	}
+	return joinTokens(tokens)
+}
+
+// TitleCase returns title in title case: the first letter of each word is
+// upper case, except for articles, conjunctions and short prepositions
+// that are not the first or last word of the title or of a part after a
+// colon. Words with upper case letters, braced groups and TeX commands are
+// kept as they are.
+func TitleCase(title string) string {
+	tokens := titleTokens(title)
+	last := -1
+	for i, t := range tokens {
+		if t.word {
+			last = i
+		}
+	}
+	for i, t := range tokens {
+		if !t.word || t.cont || strings.ToLower(t.text) != t.text {
+			continue
+		}
+		if titleSmallWords[t.text] && !t.start && i != last && !followsHyphen(tokens, i) {
+			continue
+		}
+		tokens[i].text = upperFirst(t.text)
+	}
+	return joinTokens(tokens)
+}
+
+// followsHyphen returns true if the word tokens[i] follows a hyphen, as in
+// "Built-In".
+func followsHyphen(tokens []titleToken, i int) bool {
+	return i > 0 && strings.HasSuffix(tokens[i-1].text, "-")
+}
+
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// ProtectCase returns title with the words whose case must be kept braced:
+// acronyms and other words with upper case letters after the first (such as
+// ACM, GitHub or LaTeX), and the words of dictionary (such as proper nouns
+// like Markov), matched ignoring case and written as in dictionary. Words
+// that are already braced are kept as they are.
+func ProtectCase(title string, dictionary ...string) string {
+	return newCaseProtector(dictionary).protect(title)
+}
+
+// caseProtector braces words as ProtectCase.
+type caseProtector struct {
+	dictionary map[string]string // Lowercase word -> word.
+}
+
+func newCaseProtector(dictionary []string) *caseProtector {
+	p := &caseProtector{dictionary: make(map[string]string, len(dictionary))}
+	for _, word := range dictionary {
+		p.dictionary[strings.ToLower(word)] = word
+	}
+	return p
+}
+
+func (p *caseProtector) protect(title string) string {
+	tokens := titleTokens(title)
+	for i, t := range tokens {
+		if !t.word || t.cont || i+1 < len(tokens) && tokens[i+1].cont {
+			continue
+		}
+		if word, ok := p.dictionary[strings.ToLower(t.text)]; ok {
+			tokens[i].text = "{" + word + "}"
+		} else if hasInnerUpper(t.text) {
+			tokens[i].text = "{" + t.text + "}"
+		}
+	}
+	return joinTokens(tokens)
+}
+
+// hasInnerUpper returns true if a letter after the first of word is upper
+// case.
+func hasInnerUpper(word string) bool {
+	for i, r := range word {
+		if i > 0 && unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Casing is a change of case applied to titles by WithTitleCasing.
+type Casing func(title string) string
+
+// WithTitleCasing changes the case of the title, subtitle and titleaddon
+// fields with casing, e.g. SentenceCase or TitleCase. Words protected by
+// WithCaseProtection keep their case.
+func WithTitleCasing(casing Casing) PrettyStringOpt {
+	return func(config *prettyStringConfig) {
+		config.casing = casing
+	}
+}
+
+// WithCaseProtection braces the words of the title, subtitle and titleaddon
+// fields whose case must be kept, as ProtectCase with dictionary.
+func WithCaseProtection(dictionary ...string) PrettyStringOpt {
+	return func(config *prettyStringConfig) {
+		config.protector = newCaseProtector(dictionary)
+	}
+}
+
+// caseField returns the value of a title field with the casing options of
+// config applied to its constant parts.
+func (config prettyStringConfig) caseField(name string, value BibString) BibString {
+	if config.protector == nil && config.casing == nil || !caseFields[strings.ToLower(name)] {
+		return value
+	}
+	return mapConsts(value, func(s string) string {
+		if config.protector != nil {
+			s = config.protector.protect(s)
+		}
+		if config.casing != nil {
+			s = config.casing(s)
+		}
+		return s
+	})
+}
+
+// mapConsts returns s with fn applied to its constants. String variables
+// are kept.
+func mapConsts(s BibString, fn func(string) string) BibString {
+	return RewriteString(s, func(s BibString) BibString {
+		switch s := s.(type) {
+		case BibConst:
+			return BibConst(fn(string(s)))
+		case *BibConst:
+			return BibConst(fn(string(*s)))
+		}
+		return s
+	})
+}
@@ -0,0 +1,525 @@
+package bibtex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// KeyPattern is a compiled cite key pattern, see CompileKeyPattern.
+type KeyPattern struct {
+	parts []keyPart
+}
+
+// keyPart is literal text or a [marker:modifier...] of a key pattern.
+type keyPart struct {
+	literal   string
+	marker    string
+	modifiers []string
+}
+
+// keyStopWords are skipped by the title markers of key patterns.
+var keyStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "from": true, "in": true, "into": true,
+	"is": true, "of": true, "on": true, "or": true, "the": true, "to": true,
+	"with": true, "der": true, "die": true, "das": true, "le": true,
+	"la": true, "les": true, "un": true, "une": true,
+}
+
+// CompileKeyPattern compiles a cite key pattern such as
+// "[auth:lower][year][shorttitle:1]".
+//
+// Text outside brackets is copied to the key. A bracketed marker is
+// replaced by a value of the entry, decoded from TeX to ASCII with anything
+// but letters and digits removed:
+//
+//	auth            last name of the first author (or editor)
+//	authN           first N letters of auth
+//	authors         last names of all authors
+//	authorsN        last names of the first N authors, then "EtAl"
+//	authEtAl        auth, auth and the second author, or auth then "EtAl"
+//	year            year, or the year of the date field
+//	shortyear       last two digits of year
+//	title           all title words, capitalized
+//	shorttitle      first three title words other than stop words, capitalized
+//	veryshorttitle  first title word other than stop words
+//	FIELD           any other field, e.g. [journal]
+//
+// Markers can be followed by modifiers: lower, upper, abbr (first letter of
+// each word of a title or field) or a number, which is the number of words
+// for the title markers and the maximum length otherwise.
+func CompileKeyPattern(pattern string) (*KeyPattern, error) {
+	p := &KeyPattern{}
+	for rest := pattern; rest != ""; {
+		open := strings.IndexByte(rest, '[')
+		if open < 0 {
+			p.parts = append(p.parts, keyPart{literal: rest})
+			break
+		}
+		if open > 0 {
+			p.parts = append(p.parts, keyPart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: missing ] in %q", ErrKeyPattern, pattern)
+		}
+		fields := strings.Split(rest[open+1:open+end], ":")
+		if fields[0] == "" {
+			return nil, fmt.Errorf("%w: empty marker in %q", ErrKeyPattern, pattern)
+		}
+		for _, m := range fields[1:] {
+			switch m {
+			case "lower", "upper", "abbr":
+			default:
+				if _, err := strconv.Atoi(m); err != nil {
+					return nil, fmt.Errorf("%w: unknown modifier %q in %q", ErrKeyPattern, m, pattern)
+				}
+			}
+		}
+		p.parts = append(p.parts, keyPart{marker: fields[0], modifiers: fields[1:]})
+		rest = rest[open+end+1:]
+	}
+	return p, nil
+}
+
+// Key returns the key generated for entry, without any collision suffix.
+func (p *KeyPattern) Key(entry *BibEntry) string {
+	var buf strings.Builder
+	for _, part := range p.parts {
+		if part.marker == "" {
+			buf.WriteString(part.literal)
+			continue
+		}
+		buf.WriteString(part.expand(entry))
+	}
+	return buf.String()
+}
+
+// Rekey replaces the cite keys of all entries of bib with keys generated by
+// p, and returns a map from old to new key for the keys that changed.
+// The crossref, xref, related, xdata and entryset fields that refer to
+// renamed entries are updated.
+//
+// Entries whose generated keys collide get suffixes a, b, c, ... in
+// bibliography order. Entries for which the pattern generates an empty key
+// keep their keys.
+func (bib *BibTex) Rekey(p *KeyPattern) map[string]string {
+	keys := make([]string, len(bib.Entries))
+	count := make(map[string]int)
+	for i, entry := range bib.Entries {
+		keys[i] = p.Key(entry)
+		if keys[i] == "" {
+			keys[i] = entry.CiteName
+		}
+		count[keys[i]]++
+	}
+	taken := make(map[string]bool)
+	for key, n := range count {
+		if n == 1 {
+			taken[key] = true
+		}
+	}
+	next := make(map[string]int)
+	renamed := make(map[string]string)
+	for i, entry := range bib.Entries {
+		key := keys[i]
+		if count[key] > 1 {
+			for {
+				candidate := key + keySuffix(next[key])
+				next[key]++
+				if !taken[candidate] {
+					key = candidate
+					break
+				}
+			}
+			taken[key] = true
+		}
+		if key != entry.CiteName {
+			if _, ok := renamed[entry.CiteName]; !ok {
+				renamed[entry.CiteName] = key
+			}
+			entry.CiteName = key
+		}
+	}
+	bib.keysChanged(renamed)
+	return renamed
+}
+
+// keyReferenceFields are the fields whose values are cite keys (or
+// comma-separated lists of cite keys) of other entries.
+var keyReferenceFields = map[string]bool{
+	"crossref": true,
+	"xref":     true,
+	"related":  true,
+	"xdata":    true,
+	"entryset": true,
+}
+
+// RenameKeys renames the entries of bib by renames (old to new key), and
+// updates the crossref, xref, related, xdata and entryset fields that refer
+// to them. Keys that no entry has are ignored. It returns the number of
+// entries renamed, or an ErrDuplicateKey, renaming nothing, if a new key
+// would also be the key of another entry.
+func (bib *BibTex) RenameKeys(renames map[string]string) (int, error) {
+	owner := make(map[string]string, len(bib.Entries)) // New key -> old key.
+	for _, entry := range bib.Entries {
+		key, ok := renames[entry.CiteName]
+		if !ok {
+			key = entry.CiteName
+		}
+		if old, ok := owner[key]; ok && old != entry.CiteName {
+			return 0, fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+		}
+		owner[key] = entry.CiteName
+	}
+	n := 0
+	renamed := make(map[string]string)
+	for _, entry := range bib.Entries {
+		if key, ok := renames[entry.CiteName]; ok && key != entry.CiteName {
+			renamed[entry.CiteName] = key
+			entry.CiteName = key
+			n++
+		}
+	}
+	bib.keysChanged(renamed)
+	return n, nil
+}
+
+// RekeyText rekeys the entries of a bib file like Rekey, and returns the
+// text of r with only the cite keys of the entries and the key references
+// changed. Comments, layout and the other fields are kept as written.
+func RekeyText(r io.Reader, p *KeyPattern) ([]byte, map[string]string, error) {
+	return rekeyText(r, func(bib *BibTex) (map[string]string, error) {
+		return bib.Rekey(p), nil
+	})
+}
+
+// RenameKeysText renames the entries of a bib file like RenameKeys, and
+// returns the text of r with only the cite keys of the entries and the key
+// references changed. Comments, layout and the other fields are kept as
+// written.
+func RenameKeysText(r io.Reader, renames map[string]string) ([]byte, error) {
+	text, _, err := rekeyText(r, func(bib *BibTex) (map[string]string, error) {
+		_, err := bib.RenameKeys(renames)
+		return renames, err
+	})
+	return text, err
+}
+
+// rekeyText parses r item by item, changes its cite keys with rekey, and
+// rewrites the cite keys and key references that changed in the text.
+func rekeyText(r io.Reader, rekey func(bib *BibTex) (map[string]string, error)) ([]byte, map[string]string, error) {
+	src, err := readSource(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	type before struct {
+		key  string
+		refs map[string]string // Key reference fields by name.
+	}
+	old := make([]before, len(src.items))
+	for i, item := range src.items {
+		if item.entry == nil {
+			continue
+		}
+		old[i] = before{key: item.entry.CiteName, refs: make(map[string]string)}
+		for name, value := range item.entry.Fields {
+			if keyReferenceFields[strings.ToLower(name)] {
+				old[i].refs[name] = value.String()
+			}
+		}
+	}
+	renames, err := rekey(src.bib)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	pos := 0
+	for i, item := range src.items {
+		if item.entry == nil {
+			continue
+		}
+		text := src.text[item.start:item.end]
+		keySpan, valueSpans := entrySpans(text)
+		type edit struct {
+			span [2]int
+			text string
+		}
+		var edits []edit
+		if item.entry.CiteName != old[i].key {
+			edits = append(edits, edit{keySpan, item.entry.CiteName})
+		}
+		for name, value := range old[i].refs {
+			span, ok := valueSpans[strings.ToLower(name)]
+			if newValue := item.entry.Fields[name]; ok && newValue.String() != value {
+				edits = append(edits, edit{span, rawFormat(newValue)})
+			}
+		}
+		sort.Slice(edits, func(i, j int) bool { return edits[i].span[0] < edits[j].span[0] })
+		for _, e := range edits {
+			buf.Write(src.text[pos : item.start+e.span[0]])
+			buf.WriteString(e.text)
+			pos = item.start + e.span[1]
+		}
+	}
+	buf.Write(src.text[pos:])
+	return buf.Bytes(), renames, nil
+}
+
+// entrySpans returns the offsets of the cite key and of the field values,
+// by lowercase field name, in the text of an entry item.
+func entrySpans(item []byte) ([2]int, map[string][2]int) {
+	values := make(map[string][2]int)
+	open := bytes.IndexAny(item, "{(")
+	closing := byte('}')
+	if item[open] == '(' {
+		closing = ')'
+	}
+	i := open + 1
+	for i < len(item) && isWhitespace(rune(item[i])) {
+		i++
+	}
+	key := [2]int{i, i}
+	for i < len(item) && item[i] != ',' && !isWhitespace(rune(item[i])) {
+		i++
+	}
+	key[1] = i
+	for {
+		comma := bytes.IndexByte(item[i:], ',')
+		if comma < 0 {
+			break
+		}
+		i += comma + 1
+		eq := bytes.IndexByte(item[i:], '=')
+		if eq < 0 {
+			break
+		}
+		name := strings.ToLower(strings.TrimSpace(string(item[i : i+eq])))
+		i += eq + 1
+		for i < len(item) && isWhitespace(rune(item[i])) {
+			i++
+		}
+		start, depth, quoted := i, 0, false
+	value:
+		for ; i < len(item); i++ {
+			switch c := item[i]; {
+			case c == '{':
+				depth++
+			case c == '}' && depth > 0:
+				depth--
+			case c == '"' && depth == 0:
+				quoted = !quoted
+			case depth == 0 && !quoted && (c == ',' || c == closing):
+				break value
+			}
+		}
+		values[name] = [2]int{start, len(bytes.TrimRight(item[:i], " \t\r\n"))}
+	}
+	return key, values
+}
+
+// renameReferences updates the fields of bib that refer to renamed keys.
+func (bib *BibTex) renameReferences(renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	for _, entry := range bib.Entries {
+		for name, value := range entry.Fields {
+			if !keyReferenceFields[strings.ToLower(name)] {
+				continue
+			}
+			keys := strings.Split(value.String(), ",")
+			changed := false
+			for i, key := range keys {
+				if newKey, ok := renames[strings.TrimSpace(key)]; ok {
+					keys[i] = strings.Replace(key, strings.TrimSpace(key), newKey, 1)
+					changed = true
+				}
+			}
+			if changed {
+				entry.Fields[name] = NewBibConst(strings.Join(keys, ","))
+			}
+		}
+	}
+}
+
+// keySuffix returns the n-th collision suffix: a, b, ..., z, aa, ab, ...
+func keySuffix(n int) string {
+	var suffix []byte
+	for n++; n > 0; n = (n - 1) / 26 {
+		suffix = append([]byte{byte('a' + (n-1)%26)}, suffix...)
+	}
+	return string(suffix)
+}
+
+// expand returns the value of a marker with its modifiers applied.
+func (part keyPart) expand(entry *BibEntry) string {
+	number := -1
+	for _, m := range part.modifiers {
+		if n, err := strconv.Atoi(m); err == nil {
+			number = n
+		}
+	}
+	abbr := part.hasModifier("abbr")
+	var value string
+	switch lower := strings.ToLower(part.marker); {
+	case lower == "auth" || lower == "authors" || lower == "authetal":
+		names := keyNames(entry)
+		switch {
+		case len(names) == 0:
+		case lower == "auth":
+			value = names[0]
+		case lower == "authors":
+			value = strings.Join(names, "")
+		case len(names) == 1:
+			value = names[0]
+		case len(names) == 2:
+			value = names[0] + names[1]
+		default:
+			value = names[0] + "EtAl"
+		}
+	case strings.HasPrefix(lower, "authors") && isDigits(lower[len("authors"):]):
+		n, _ := strconv.Atoi(lower[len("authors"):])
+		names := keyNames(entry)
+		if len(names) > n {
+			names = append(names[:n:n], "EtAl")
+		}
+		value = strings.Join(names, "")
+	case strings.HasPrefix(lower, "auth") && isDigits(lower[len("auth"):]):
+		n, _ := strconv.Atoi(lower[len("auth"):])
+		if names := keyNames(entry); len(names) > 0 {
+			value = truncateRunes(names[0], n)
+		}
+	case lower == "year" || lower == "shortyear":
+		year, _ := queryField(entry, "year")
+		value = keyWord(year)
+		if lower == "shortyear" && len(value) > 2 {
+			value = value[len(value)-2:]
+		}
+	case lower == "title" || lower == "shorttitle" || lower == "veryshorttitle":
+		title, _ := foldedField(entry, "title")
+		n := number
+		switch {
+		case n >= 0:
+		case lower == "shorttitle":
+			n = 3
+		case lower == "veryshorttitle":
+			n = 1
+		}
+		value = titleWords(title, lower != "title", n, abbr)
+		number = -1
+	default:
+		field, _ := foldedField(entry, lower)
+		if abbr {
+			value = titleWords(field, false, -1, true)
+		} else {
+			value = keyWord(field)
+		}
+	}
+	for _, m := range part.modifiers {
+		switch m {
+		case "lower":
+			value = strings.ToLower(value)
+		case "upper":
+			value = strings.ToUpper(value)
+		}
+	}
+	if number >= 0 {
+		value = truncateRunes(value, number)
+	}
+	return value
+}
+
+func (part keyPart) hasModifier(m string) bool {
+	for _, modifier := range part.modifiers {
+		if modifier == m {
+			return true
+		}
+	}
+	return false
+}
+
+// keyNames returns the ASCII last names of the authors (or editors).
+func keyNames(entry *BibEntry) []string {
+	names, ok := rawField(entry, "author")
+	if !ok {
+		names, _ = rawField(entry, "editor")
+	}
+	var lasts []string
+	for _, name := range ParseNames(names) {
+		if name.IsOthers() {
+			continue
+		}
+		lasts = append(lasts, keyWord(name.Last))
+	}
+	return lasts
+}
+
+// rawField returns the TeX value of the field with the given lowercase
+// name, ignoring the case of the field names of entry.
+func rawField(entry *BibEntry, name string) (string, bool) {
+	for key, value := range entry.Fields {
+		if strings.ToLower(key) == name {
+			return value.String(), true
+		}
+	}
+	return "", false
+}
+
+// titleWords returns the first n words of title (all if n < 0) with their
+// first letters capitalized, skipping stop words if skipStopWords is set.
+// If initials is set, only the first letter of each word is kept.
+func titleWords(title string, skipStopWords bool, n int, initials bool) string {
+	var buf strings.Builder
+	for _, w := range keyWords(title) {
+		if n == 0 {
+			break
+		}
+		if skipStopWords && keyStopWords[strings.ToLower(w)] {
+			continue
+		}
+		buf.WriteString(strings.ToUpper(w[:1]))
+		if !initials {
+			buf.WriteString(w[1:])
+		}
+		n--
+	}
+	return buf.String()
+}
+
+// keyWords splits s into ASCII words of letters and digits.
+func keyWords(s string) []string {
+	return strings.FieldsFunc(ASCIIFold(s), func(r rune) bool {
+		return r >= unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// keyWord returns s in ASCII with anything but letters and digits removed.
+func keyWord(s string) string {
+	return strings.Join(keyWords(s), "")
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func truncateRunes(s string, n int) string {
+	if rs := []rune(s); len(rs) > n {
+		return string(rs[:n])
+	}
+	return s
+}
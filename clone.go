@@ -0,0 +1,180 @@
+package bibtex
+
+// Clone returns a deep copy of bib. String variables used in the copied
+// entries, preambles and macros refer to the copied macros.
+func (bib *BibTex) Clone() *BibTex {
+	vars := make(map[*BibVar]*BibVar)
+	c := &BibTex{
+		Preambles:   make([]BibString, len(bib.Preambles)),
+		Entries:     make([]*BibEntry, len(bib.Entries)),
+		StringVar:   make(map[string]*BibVar, len(bib.StringVar)),
+		defaultVars: make(map[string]string, len(bib.defaultVars)),
+
+		hideDefaultVars: bib.hideDefaultVars,
+	}
+	for key, v := range bib.StringVar {
+		c.StringVar[key] = cloneVar(v, vars)
+	}
+	for i, preamble := range bib.Preambles {
+		c.Preambles[i] = cloneString(preamble, vars)
+	}
+	for i, entry := range bib.Entries {
+		c.Entries[i] = entry.clone(vars)
+	}
+	for key, value := range bib.defaultVars {
+		c.defaultVars[key] = value
+	}
+	return c
+}
+
+// Clone returns a deep copy of entry. String variables used in its fields
+// are copied too, so changing their values does not affect entry.
+func (entry *BibEntry) Clone() *BibEntry {
+	return entry.clone(make(map[*BibVar]*BibVar))
+}
+
+func (entry *BibEntry) clone(vars map[*BibVar]*BibVar) *BibEntry {
+	c := &BibEntry{
+		Type:     entry.Type,
+		CiteName: entry.CiteName,
+		Fields:   make(map[string]BibString, len(entry.Fields)),
+	}
+	for name, value := range entry.Fields {
+		c.Fields[name] = cloneString(value, vars)
+	}
+	return c
+}
+
+// Clone returns c; constants are values.
+func (c BibConst) Clone() BibString {
+	return c
+}
+
+// Clone returns a deep copy of v.
+func (v *BibVar) Clone() BibString {
+	return cloneVar(v, make(map[*BibVar]*BibVar))
+}
+
+// Clone returns a deep copy of c.
+func (c *BibComposite) Clone() BibString {
+	return cloneString(c, make(map[*BibVar]*BibVar))
+}
+
+// CloneString returns a deep copy of s.
+func CloneString(s BibString) BibString {
+	return cloneString(s, make(map[*BibVar]*BibVar))
+}
+
+// cloneString returns a deep copy of s, with the copies of string variables
+// recorded in vars so that shared variables stay shared.
+func cloneString(s BibString, vars map[*BibVar]*BibVar) BibString {
+	switch s := s.(type) {
+	case *BibConst:
+		c := *s
+		return &c
+	case *BibVar:
+		return cloneVar(s, vars)
+	case *BibComposite:
+		c := make(BibComposite, len(*s))
+		for i, part := range *s {
+			c[i] = cloneString(part, vars)
+		}
+		return &c
+	}
+	return s
+}
+
+func cloneVar(v *BibVar, vars map[*BibVar]*BibVar) *BibVar {
+	if c, ok := vars[v]; ok {
+		return c
+	}
+	c := &BibVar{Key: v.Key}
+	vars[v] = c
+	c.Value = cloneString(v.Value, vars)
+	return c
+}
+
+// EqualOpt changes how values are compared by Equal.
+type EqualOpt func(config *equalConfig)
+
+type equalConfig struct {
+	expanded bool
+}
+
+// WithExpandedStrings compares values with their string variables expanded,
+// so that a macro and a constant with the same value are equal.
+func WithExpandedStrings() EqualOpt {
+	return func(config *equalConfig) {
+		config.expanded = true
+	}
+}
+
+func newEqualConfig(options []EqualOpt) equalConfig {
+	var config equalConfig
+	for _, option := range options {
+		option(&config)
+	}
+	return config
+}
+
+// Equal returns true if bib and other have equal entries in the same order,
+// equal preambles and equal @string macros (other than the predefined
+// months). Entries are compared as by BibEntry.Equal.
+func (bib *BibTex) Equal(other *BibTex, options ...EqualOpt) bool {
+	config := newEqualConfig(options)
+	if len(bib.Entries) != len(other.Entries) || len(bib.Preambles) != len(other.Preambles) {
+		return false
+	}
+	for i, entry := range bib.Entries {
+		if !entry.equal(other.Entries[i], config) {
+			return false
+		}
+	}
+	for i, preamble := range bib.Preambles {
+		if !config.equalString(preamble, other.Preambles[i]) {
+			return false
+		}
+	}
+	vars, otherVars := stringVars(bib), stringVars(other)
+	if len(vars) != len(otherVars) {
+		return false
+	}
+	for key, value := range vars {
+		if otherValue, ok := otherVars[key]; !ok || !config.equalString(value, otherValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if entry and other have the same type, cite key and
+// fields, in any order. Values are compared as written, with string
+// variables by name, unless WithExpandedStrings is given.
+func (entry *BibEntry) Equal(other *BibEntry, options ...EqualOpt) bool {
+	return entry.equal(other, newEqualConfig(options))
+}
+
+func (entry *BibEntry) equal(other *BibEntry, config equalConfig) bool {
+	if entry.Type != other.Type || entry.CiteName != other.CiteName || len(entry.Fields) != len(other.Fields) {
+		return false
+	}
+	for name, value := range entry.Fields {
+		if otherValue, ok := other.Fields[name]; !ok || !config.equalString(value, otherValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualString returns true if a and b are equal as written, with string
+// variables by name, or expanded if WithExpandedStrings is given.
+func EqualString(a, b BibString, options ...EqualOpt) bool {
+	return newEqualConfig(options).equalString(a, b)
+}
+
+func (config equalConfig) equalString(a, b BibString) bool {
+	if config.expanded {
+		return a.String() == b.String()
+	}
+	return rawFormat(a) == rawFormat(b)
+}
@@ -0,0 +1,66 @@
+// Command bibdiff compares two bib files entry by entry.
+//
+// Usage:
+//
+//	bibdiff [-json] old.bib new.bib
+//
+// Entries are paired by cite key (or by DOI and title if renamed), so
+// reordering entries or fields is not reported. The exit status is 0 if the
+// files are equivalent, 1 if they differ and 2 on error.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nickng/bibtex"
+)
+
+var asJSON = flag.Bool("json", false, "Output the differences as JSON")
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: bibdiff [-json] old.bib new.bib")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	old, err := parseFile(flag.Arg(0))
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	new, err := parseFile(flag.Arg(1))
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	d := bibtex.Diff(old, new)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+	} else {
+		fmt.Print(d)
+	}
+	if !d.Empty() {
+		os.Exit(1)
+	}
+}
+
+func parseFile(path string) (*bibtex.BibTex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return bibtex.Parse(f)
+}
@@ -0,0 +1,74 @@
+// Command bibextract writes the subset of a bib file cited by a LaTeX
+// document, like bibtool -x or bibexport.
+//
+// Usage:
+//
+//	bibextract -bib master.bib [-out paper.bib] file.aux|file.bcf|file.tex|dir ...
+//
+// The cite keys are read from .aux files (\citation lines), BibLaTeX .bcf
+// files or the citation commands of .tex files (all .tex files under a
+// directory). The output has the cited entries, their crossref, xref and
+// xdata parents, and the @string macros and preambles they need. Cite keys
+// missing from the bib file are reported, and make bibextract exit with
+// status 1.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nickng/bibtex"
+	"github.com/nickng/bibtex/latex"
+)
+
+var (
+	bibfile = flag.String("bib", "", "Bib file to extract entries from")
+	outfile = flag.String("out", "", "Output file (default: stdout)")
+
+	writer = os.Stdout
+)
+
+func main() {
+	flag.Parse()
+	if *bibfile == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: bibextract -bib file.bib [flags] file.aux|file.bcf|file.tex|dir ...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	keys, err := latex.ReadCitations(flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rdFile, err := os.Open(*bibfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	parsed, err := bibtex.Parse(rdFile)
+	rdFile.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	subset, missing := parsed.Subset(keys)
+
+	if *outfile != "" {
+		wrFile, err := os.Create(*outfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer wrFile.Close()
+		writer = wrFile
+	}
+	if err := bibtex.NewEncoder(writer).Encode(subset); err != nil {
+		log.Fatal(err)
+	}
+	for _, key := range missing {
+		fmt.Fprintf(os.Stderr, "bibextract: %s not found in %s\n", key, *bibfile)
+	}
+	if len(missing) > 0 {
+		writer.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,76 @@
+// Command bibfilter prints the entries of a bib file matching a query.
+//
+// Usage:
+//
+//	bibfilter [-in file.bib] [-out file.bib] [-keys] [-count] query
+//
+// See bibtex.CompileQuery for the query syntax, e.g.
+//
+//	bibfilter -in refs.bib 'type:article AND year>=2020 AND NOT keywords~"draft"'
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nickng/bibtex"
+)
+
+var (
+	infile  = flag.String("in", "", "Input file (default: stdin)")
+	outfile = flag.String("out", "", "Output file (default: stdout)")
+	keys    = flag.Bool("keys", false, "Print only the cite keys of matching entries")
+	count   = flag.Bool("count", false, "Print only the number of matching entries")
+
+	reader = os.Stdin
+	writer = os.Stdout
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: bibfilter [flags] query")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	query := flag.Arg(0)
+
+	if *infile != "" {
+		rdFile, err := os.Open(*infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rdFile.Close()
+		reader = rdFile
+	}
+
+	if *outfile != "" {
+		wrFile, err := os.Create(*outfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer wrFile.Close()
+		writer = wrFile
+	}
+
+	parsed, err := bibtex.Parse(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	filtered, err := parsed.Filter(query)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case *count:
+		fmt.Fprintln(writer, len(filtered.Entries))
+	case *keys:
+		for _, entry := range filtered.Entries {
+			fmt.Fprintln(writer, entry.CiteName)
+		}
+	default:
+		fmt.Fprint(writer, filtered.PrettyString())
+	}
+}
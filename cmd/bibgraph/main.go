@@ -0,0 +1,87 @@
+// Command bibgraph writes the co-authorship or citation graph of a bib file
+// as GraphML, GEXF or Graphviz DOT.
+//
+// Usage:
+//
+//	bibgraph [-in file.bib] [-out file] [-graph coauthors|citations] [-format graphml|gexf|dot]
+//
+// Edge weights are the number of entries two authors wrote together, or the
+// number of references from one entry to another. For example,
+//
+//	bibgraph -in refs.bib -format dot | dot -Tsvg > coauthors.svg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nickng/bibtex"
+	"github.com/nickng/bibtex/graph"
+)
+
+var (
+	infile  = flag.String("in", "", "Input file (default: stdin)")
+	outfile = flag.String("out", "", "Output file (default: stdout)")
+	kind    = flag.String("graph", "coauthors", "Graph to write: coauthors or citations")
+	format  = flag.String("format", "graphml", "Output format: graphml, gexf or dot")
+
+	reader = os.Stdin
+	writer = os.Stdout
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: bibgraph [flags]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	var build func(*bibtex.BibTex) *graph.Graph
+	switch *kind {
+	case "coauthors":
+		build = graph.CoAuthors
+	case "citations":
+		build = graph.Citations
+	default:
+		log.Fatalf("unknown graph %q: want coauthors or citations", *kind)
+	}
+
+	if *infile != "" {
+		rdFile, err := os.Open(*infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rdFile.Close()
+		reader = rdFile
+	}
+	parsed, err := bibtex.Parse(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g := build(parsed)
+
+	if *outfile != "" {
+		wrFile, err := os.Create(*outfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer wrFile.Close()
+		writer = wrFile
+	}
+	switch *format {
+	case "graphml":
+		err = g.WriteGraphML(writer)
+	case "gexf":
+		err = g.WriteGEXF(writer)
+	case "dot":
+		err = g.WriteDOT(writer)
+	default:
+		err = fmt.Errorf("unknown format %q: want graphml, gexf or dot", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
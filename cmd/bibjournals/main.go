@@ -0,0 +1,90 @@
+// Command bibjournals abbreviates or expands the journal titles of a bib
+// file with ISO 4 abbreviation lists.
+//
+// Usage:
+//
+//	bibjournals [-expand] [-list file.csv ...] [-in file.bib] [-out file.bib]
+//
+// Journal titles are abbreviated unless -expand is given. The lists of the
+// -list flags (JabRef-style CSV files) are used in addition to the list
+// shipped with the journals package, and take precedence over it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nickng/bibtex"
+	"github.com/nickng/bibtex/journals"
+)
+
+// listFlags is a repeatable -list flag.
+type listFlags []string
+
+func (f *listFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *listFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+var (
+	infile  = flag.String("in", "", "Input file (default: stdin)")
+	outfile = flag.String("out", "", "Output file (default: stdout)")
+	expand  = flag.Bool("expand", false, "Expand abbreviated journal titles")
+	lists   listFlags
+
+	reader = os.Stdin
+	writer = os.Stdout
+)
+
+func main() {
+	flag.Var(&lists, "list", "Abbreviation list CSV file (repeatable)")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: bibjournals [flags]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	l := journals.Default().Clone()
+	for _, name := range lists {
+		if err := l.ReadFile(name); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *infile != "" {
+		rdFile, err := os.Open(*infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rdFile.Close()
+		reader = rdFile
+	}
+	parsed, err := bibtex.Parse(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *expand {
+		l.ExpandAll(parsed)
+	} else {
+		l.AbbreviateAll(parsed)
+	}
+
+	if *outfile != "" {
+		wrFile, err := os.Create(*outfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer wrFile.Close()
+		writer = wrFile
+	}
+	if err := bibtex.NewEncoder(writer).Encode(parsed); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+// Command bibmerge is a three-way merge driver for bib files.
+//
+// Usage:
+//
+//	bibmerge [-out file.bib] base.bib ours.bib theirs.bib
+//
+// The merged bibliography is written to ours.bib (or -out, "-" for stdout),
+// and the exit status is 1 if there are conflicts, which are marked inside
+// the affected field values. The text of ours.bib outside of the changed
+// entries, such as comments and the field order, is kept as written. To use
+// it as a git merge driver:
+//
+//	git config merge.bibtex.name "BibTeX merge driver"
+//	git config merge.bibtex.driver "bibmerge %O %A %B"
+//	echo "*.bib merge=bibtex" >> .gitattributes
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/nickng/bibtex"
+)
+
+var outfile = flag.String("out", "", "Output file (default: overwrite ours, - for stdout)")
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() != 3 {
+		fmt.Fprintln(os.Stderr, "usage: bibmerge [-out file.bib] base.bib ours.bib theirs.bib")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	var files [3]io.Reader
+	for i := range files {
+		b, err := os.ReadFile(flag.Arg(i))
+		if err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+		files[i] = bytes.NewReader(b)
+	}
+
+	merged, conflicts, err := bibtex.ThreeWayMergeText(files[0], files[1], files[2])
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	switch out := *outfile; out {
+	case "-":
+		os.Stdout.Write(merged)
+	default:
+		if out == "" {
+			out = flag.Arg(1)
+		}
+		if err := os.WriteFile(out, merged, 0644); err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+	}
+	for _, c := range conflicts {
+		log.Printf("CONFLICT in %s", c)
+	}
+	if len(conflicts) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,148 @@
+// Command bibrename renames cite keys in a bib file and in the citations of
+// the .tex files that use it.
+//
+// Usage:
+//
+//	bibrename [-n] -bib refs.bib (-map renames.txt | -pattern pattern) [dir|file.tex ...]
+//
+// The map file has one "old new" pair of cite keys per line; blank lines and
+// lines starting with # are ignored. Alternatively, all entries are rekeyed
+// with a cite key pattern (see bibtex.CompileKeyPattern), e.g.
+//
+//	bibrename -bib refs.bib -pattern '[auth:lower][year]' chapters/
+//
+// Renames that would give two entries the same cite key are rejected. The
+// bib file is rewritten in place, changing only the cite keys of entries and
+// the crossref, xref, related, xdata and entryset fields that refer to them,
+// and the .tex files under each argument (default: the current directory)
+// are rewritten if any of their citations change.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nickng/bibtex"
+	"github.com/nickng/bibtex/latex"
+)
+
+var (
+	bibfile = flag.String("bib", "", "Bib file to rename entries in")
+	mapfile = flag.String("map", "", "File of old and new cite keys, one pair per line")
+	pattern = flag.String("pattern", "", "Cite key pattern to rekey all entries with")
+	dryRun  = flag.Bool("n", false, "Print the renames without writing any files")
+)
+
+func main() {
+	flag.Parse()
+	if *bibfile == "" || (*mapfile == "") == (*pattern == "") {
+		fmt.Fprintln(os.Stderr, "usage: bibrename -bib file.bib (-map file | -pattern pattern) [dir|file.tex ...]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	text, err := os.ReadFile(*bibfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		renamed []byte
+		renames map[string]string
+	)
+	if *pattern != "" {
+		p, err := bibtex.CompileKeyPattern(*pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		renamed, renames, err = bibtex.RekeyText(bytes.NewReader(text), p)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if renames, err = readRenames(*mapfile); err != nil {
+			log.Fatal(err)
+		}
+		if renamed, err = bibtex.RenameKeysText(bytes.NewReader(text), renames); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for old, new := range renames {
+		fmt.Printf("%s -> %s\n", old, new)
+	}
+	if *dryRun || len(renames) == 0 {
+		return
+	}
+
+	if err := writeFile(*bibfile, renamed); err != nil {
+		log.Fatal(err)
+	}
+	for _, root := range roots {
+		changed, err := latex.RenameCitationsInTree(root, renames)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for path, n := range changed {
+			fmt.Printf("%s: %d citations renamed\n", path, n)
+		}
+	}
+}
+
+// writeFile replaces the file name by data, through a temporary file in the
+// same directory so that name is never left partly written.
+func writeFile(name string, data []byte) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// readRenames reads "old new" pairs of cite keys from a file.
+func readRenames(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	renames := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected old and new cite key", name, line)
+		}
+		renames[fields[0]] = fields[1]
+	}
+	return renames, scanner.Err()
+}
@@ -0,0 +1,105 @@
+// Command bibstats prints statistics of a bib file: the number of entries
+// per year, type, venue and author, co-authorships, field usage and field
+// completeness per entry type.
+//
+// Usage:
+//
+//	bibstats [-in file.bib] [-json] [-top n]
+//
+// Tables are printed unless -json is given; -top limits the rows of each
+// table (but not the years).
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nickng/bibtex"
+)
+
+var (
+	infile = flag.String("in", "", "Input file (default: stdin)")
+	asJSON = flag.Bool("json", false, "Print JSON")
+	top    = flag.Int("top", 10, "Maximum number of rows per table (0 for all)")
+
+	reader = os.Stdin
+	writer = os.Stdout
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: bibstats [flags]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if *infile != "" {
+		rdFile, err := os.Open(*infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rdFile.Close()
+		reader = rdFile
+	}
+	parsed, err := bibtex.Parse(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stats := parsed.Stats()
+	if *asJSON {
+		enc := json.NewEncoder(writer)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printTables(writer, stats)
+}
+
+func printTables(w io.Writer, s *bibtex.Stats) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Entries\t%d\n", s.Entries)
+	printCounts(tw, "Year", s.Years, 0)
+	printCounts(tw, "Type", s.Types, *top)
+	printCounts(tw, "Venue", s.Venues, *top)
+	printCounts(tw, "Author", s.Authors, *top)
+	if len(s.CoAuthors) > 0 {
+		fmt.Fprintf(tw, "\nCo-authors\t\tEntries\n")
+		for i, c := range s.CoAuthors {
+			if *top > 0 && i == *top {
+				break
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", c.Authors[0], c.Authors[1], c.Count)
+		}
+	}
+	printCounts(tw, "Field", s.Fields, *top)
+	for _, c := range s.Completeness {
+		fmt.Fprintf(tw, "\n@%s (%d)\tComplete\n", c.Type, c.Entries)
+		for i, f := range c.Fields {
+			if *top > 0 && i == *top {
+				break
+			}
+			fmt.Fprintf(tw, "%s\t%.0f%%\n", f.Name, 100*f.Fraction)
+		}
+	}
+	tw.Flush()
+}
+
+func printCounts(w io.Writer, title string, counts []bibtex.Count, limit int) {
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s\tEntries\n", title)
+	for i, c := range counts {
+		if limit > 0 && i == limit {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%d\n", c.Key, c.Count)
+	}
+}
@@ -7,15 +7,25 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/nickng/bibtex"
+	"github.com/nickng/bibtex/bibtemplate"
 )
 
 var (
 	infile  = flag.String("in", "", "Input file (default: stdin)")
 	outfile = flag.String("out", "", "Output file (default: stdout)")
 	config  = flag.String("conf", "", "Filter config to use")
+	tmpl    = flag.String("template", "", "Go template file to render with")
+	format  = flag.String("format", "", "Template package: text or html (default: html for .html and .htm files, also before .tmpl)")
+	casing  = flag.String("case", "", "Change the case of titles: sentence or title")
+	protect = flag.Bool("protect", false, "Brace acronyms and mixed-case words in titles")
+	dict    = flag.String("dict", "", "File of words to brace in titles, one per line (implies -protect)")
+	sortBy  = flag.String("sort", "", "Comma-separated sort keys, e.g. author,-year (see bibtex.BibTex.Sort)")
+	norm    = flag.String("normalize", "", "Comma-separated normalizers to run, or \"default\" ("+strings.Join(bibtex.DefaultNormalizers, ",")+")")
 
 	reader = os.Stdin
 	writer = os.Stdout
@@ -53,10 +63,27 @@ func main() {
 		writer = wrFile
 	}
 
+	opts, err := caseOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	parsed, err := bibtex.Parse(reader)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *norm != "" {
+		steps, err := normalizers(*norm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := parsed.Normalize(steps...); err != nil {
+			log.Print(err)
+		}
+	}
+	if *sortBy != "" {
+		parsed.Sort(strings.Split(*sortBy, ",")...)
+	}
 	keyOrderByType := make(map[string][]string)
 	if *config != "" {
 		var conf Config
@@ -68,7 +95,93 @@ func main() {
 			keyOrderByType[name] = bt.FieldsOrder
 		}
 	}
-	prettyPrintOverridingOrder(writer, parsed, keyOrderByType)
+	if *tmpl != "" {
+		if err := executeTemplate(writer, parsed, *tmpl, *format); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	prettyPrintOverridingOrder(writer, parsed, keyOrderByType, opts)
+}
+
+// normalizers returns the normalizers named in a comma-separated list, in
+// which "default" stands for bibtex.DefaultNormalizers.
+func normalizers(list string) ([]bibtex.Normalizer, error) {
+	var steps []bibtex.Normalizer
+	for _, name := range strings.Split(list, ",") {
+		names := []string{strings.TrimSpace(name)}
+		if names[0] == "default" {
+			names = bibtex.DefaultNormalizers
+		}
+		for _, name := range names {
+			step, ok := bibtex.Normalizers[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown normalizer %q", name)
+			}
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// caseOptions returns the title casing options given by the -case,
+// -protect and -dict flags.
+func caseOptions() ([]bibtex.PrettyStringOpt, error) {
+	var opts []bibtex.PrettyStringOpt
+	switch *casing {
+	case "":
+	case "sentence":
+		opts = append(opts, bibtex.WithTitleCasing(bibtex.SentenceCase))
+	case "title":
+		opts = append(opts, bibtex.WithTitleCasing(bibtex.TitleCase))
+	default:
+		return nil, fmt.Errorf("unknown case %q: want sentence or title", *casing)
+	}
+	if *dict != "" {
+		b, err := os.ReadFile(*dict)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, bibtex.WithCaseProtection(strings.Fields(string(b))...))
+	} else if *protect {
+		opts = append(opts, bibtex.WithCaseProtection())
+	}
+	return opts, nil
+}
+
+// executeTemplate renders bib with the template file at path, using
+// html/template if format is html and text/template if it is text. With no
+// format, html/template is used for .html and .htm files, also with a
+// template extension such as page.html.tmpl.
+func executeTemplate(w io.Writer, bib *bibtex.BibTex, path, format string) error {
+	if format == "" {
+		format = "text"
+		ext := strings.ToLower(filepath.Ext(path))
+		switch ext {
+		case ".tmpl", ".tpl", ".gotmpl":
+			ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path))))
+		}
+		if ext == ".html" || ext == ".htm" {
+			format = "html"
+		}
+	}
+	var (
+		t   bibtemplate.Template
+		err error
+	)
+	name := filepath.Base(path)
+	switch format {
+	case "html":
+		t, err = bibtemplate.NewHTML(name).ParseFiles(path)
+	case "text":
+		t, err = bibtemplate.New(name).ParseFiles(path)
+	default:
+		return fmt.Errorf("unknown template format %q (text or html)", format)
+	}
+	if err != nil {
+		return err
+	}
+	return bibtemplate.Execute(w, t, bib)
 }
 
 func filter(bib *bibtex.BibTex, conf *Config) {
@@ -88,9 +201,9 @@ func filter(bib *bibtex.BibTex, conf *Config) {
 	}
 }
 
-func prettyPrintOverridingOrder(w io.Writer, parsed *bibtex.BibTex, keyOrderByType map[string][]string) {
+func prettyPrintOverridingOrder(w io.Writer, parsed *bibtex.BibTex, keyOrderByType map[string][]string, baseOpts []bibtex.PrettyStringOpt) {
 	for _, entry := range parsed.Entries {
-		var opts []bibtex.PrettyStringOpt
+		opts := append([]bibtex.PrettyStringOpt{}, baseOpts...)
 		if order, specified := keyOrderByType[entry.Type]; specified {
 			opts = append(opts, bibtex.WithKeyOrder(order))
 		}
@@ -0,0 +1,356 @@
+// Package csl is a small Citation Style Language (CSL 1.0) processor for
+// BibTeX entries.
+//
+// A Processor loads a .csl style and a CSL locale file, converts the entries
+// of a bibtex.BibTex into CSL items and renders them as in-text citations
+// and formatted bibliography entries. Disambiguation of citations (adding
+// names, given names and year suffixes), "et al." abbreviation and sorting
+// are supported; note-specific features such as ibid. and locators are not.
+//
+// No network access is needed: styles and locales are read from files or
+// readers supplied by the caller, and a minimal en-US locale is built in.
+//
+//	style, err := csl.LoadStyle("apa.csl")
+//	locale, err := csl.LoadLocale("locales-en-US.xml")
+//	p := csl.NewProcessor(style, locale, bib)
+//	cite, err := p.Cite("knuth84")
+//	entries := p.Bibliography()
+//
+// See https://docs.citationstyles.org/en/stable/specification.html for the
+// specification.
+package csl // import "github.com/nickng/bibtex/csl"
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrNotStyle is an error for a CSL file without a style root element.
+	ErrNotStyle = errors.New("not a CSL style")
+	// ErrNotLocale is an error for a CSL file without a locale root element.
+	ErrNotLocale = errors.New("not a CSL locale")
+	// ErrUnknownCiteKey is an error for citing a key not in the bibliography.
+	ErrUnknownCiteKey = errors.New("unknown cite key")
+)
+
+// element is a generic CSL XML element.
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []*element `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+// attr returns the value of the named attribute, or "".
+func (e *element) attr(name string) string {
+	if e == nil {
+		return ""
+	}
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// hasAttr returns true if the element has the named attribute.
+func (e *element) hasAttr(name string) bool {
+	if e == nil {
+		return false
+	}
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// child returns the first child element with the given name, or nil.
+func (e *element) child(name string) *element {
+	if e == nil {
+		return nil
+	}
+	for _, c := range e.Children {
+		if c.XMLName.Local == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// walk calls fn for e and every descendant element.
+func (e *element) walk(fn func(*element)) {
+	fn(e)
+	for _, c := range e.Children {
+		c.walk(fn)
+	}
+}
+
+// Style is a parsed CSL style.
+type Style struct {
+	Title string // Title from the style info.
+	Class string // "in-text" or "note".
+
+	root         *element
+	citation     *element
+	bibliography *element
+	macros       map[string]*element
+	locales      []*Locale // Inline locale overrides, in document order.
+
+	explicitYearSuffix bool // The style renders year-suffix itself.
+}
+
+// ParseStyle reads a CSL style from r.
+func ParseStyle(r io.Reader) (*Style, error) {
+	var root element
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	if root.XMLName.Local != "style" {
+		return nil, fmt.Errorf("%w: root element is %s", ErrNotStyle, root.XMLName.Local)
+	}
+	s := &Style{
+		Class:  root.attr("class"),
+		root:   &root,
+		macros: make(map[string]*element),
+	}
+	for _, c := range root.Children {
+		switch c.XMLName.Local {
+		case "info":
+			if title := c.child("title"); title != nil {
+				s.Title = strings.TrimSpace(title.Text)
+			}
+		case "citation":
+			s.citation = c
+		case "bibliography":
+			s.bibliography = c
+		case "macro":
+			s.macros[c.attr("name")] = c
+		case "locale":
+			s.locales = append(s.locales, newLocale(c))
+		}
+	}
+	if s.citation == nil {
+		return nil, fmt.Errorf("%w: missing citation element", ErrNotStyle)
+	}
+	root.walk(func(e *element) {
+		if e.attr("variable") == "year-suffix" {
+			s.explicitYearSuffix = true
+		}
+	})
+	return s, nil
+}
+
+// LoadStyle reads a CSL style from a .csl file.
+func LoadStyle(path string) (*Style, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseStyle(f)
+}
+
+// HasBibliography returns true if the style defines a bibliography.
+func (s *Style) HasBibliography() bool {
+	return s.bibliography != nil
+}
+
+// termKey identifies a term by name and form.
+type termKey struct {
+	name string
+	form string
+}
+
+// term is a localized term in its singular and plural forms.
+type term struct {
+	single   string
+	multiple string
+}
+
+// Locale is a parsed CSL locale (or a style's inline locale).
+type Locale struct {
+	Lang string // Language tag, e.g. "en-US".
+
+	terms              map[termKey]term
+	dates              map[string]*element // Localized date formats by form.
+	punctuationInQuote bool
+	hasPunctuation     bool // punctuationInQuote was set explicitly.
+}
+
+func newLocale(e *element) *Locale {
+	l := &Locale{
+		Lang:  e.attr("lang"),
+		terms: make(map[termKey]term),
+		dates: make(map[string]*element),
+	}
+	for _, c := range e.Children {
+		switch c.XMLName.Local {
+		case "style-options":
+			if c.hasAttr("punctuation-in-quote") {
+				l.punctuationInQuote = c.attr("punctuation-in-quote") == "true"
+				l.hasPunctuation = true
+			}
+		case "date":
+			l.dates[c.attr("form")] = c
+		case "terms":
+			for _, t := range c.Children {
+				form := t.attr("form")
+				if form == "" {
+					form = "long"
+				}
+				tm := term{single: t.Text, multiple: t.Text}
+				if single := t.child("single"); single != nil {
+					tm.single = single.Text
+				}
+				if multiple := t.child("multiple"); multiple != nil {
+					tm.multiple = multiple.Text
+				}
+				l.terms[termKey{name: t.attr("name"), form: form}] = tm
+			}
+		}
+	}
+	return l
+}
+
+// ParseLocale reads a CSL locale from r.
+func ParseLocale(r io.Reader) (*Locale, error) {
+	var root element
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	if root.XMLName.Local != "locale" {
+		return nil, fmt.Errorf("%w: root element is %s", ErrNotLocale, root.XMLName.Local)
+	}
+	return newLocale(&root), nil
+}
+
+// LoadLocale reads a CSL locale from a locales-xx-XX.xml file.
+func LoadLocale(path string) (*Locale, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseLocale(f)
+}
+
+// defaultLocale is the built-in en-US fallback for terms missing from the
+// locale given to a Processor.
+var defaultLocale = func() *Locale {
+	l, err := ParseLocale(strings.NewReader(defaultLocaleXML))
+	if err != nil {
+		panic(err)
+	}
+	return l
+}()
+
+const defaultLocaleXML = `<?xml version="1.0" encoding="utf-8"?>
+<locale xmlns="http://purl.org/net/xbiblio/csl" version="1.0" xml:lang="en-US">
+  <style-options punctuation-in-quote="true"/>
+  <date form="text">
+    <date-part name="month" suffix=" "/>
+    <date-part name="day" suffix=", "/>
+    <date-part name="year"/>
+  </date>
+  <date form="numeric">
+    <date-part name="month" form="numeric-leading-zeros" suffix="/"/>
+    <date-part name="day" form="numeric-leading-zeros" suffix="/"/>
+    <date-part name="year"/>
+  </date>
+  <terms>
+    <term name="accessed">accessed</term>
+    <term name="and">and</term>
+    <term name="and others">and others</term>
+    <term name="anonymous">anonymous</term>
+    <term name="anonymous" form="short">anon.</term>
+    <term name="available at">available at</term>
+    <term name="by">by</term>
+    <term name="et-al">et al.</term>
+    <term name="forthcoming">forthcoming</term>
+    <term name="from">from</term>
+    <term name="in">in</term>
+    <term name="no date">no date</term>
+    <term name="no date" form="short">n.d.</term>
+    <term name="online">online</term>
+    <term name="presented at">presented at the</term>
+    <term name="retrieved">retrieved</term>
+    <term name="open-quote">“</term>
+    <term name="close-quote">”</term>
+    <term name="open-inner-quote">‘</term>
+    <term name="close-inner-quote">’</term>
+    <term name="ordinal">th</term>
+    <term name="ordinal-01">st</term>
+    <term name="ordinal-02">nd</term>
+    <term name="ordinal-03">rd</term>
+    <term name="ordinal-11">th</term>
+    <term name="ordinal-12">th</term>
+    <term name="ordinal-13">th</term>
+    <term name="long-ordinal-01">first</term>
+    <term name="long-ordinal-02">second</term>
+    <term name="long-ordinal-03">third</term>
+    <term name="long-ordinal-04">fourth</term>
+    <term name="long-ordinal-05">fifth</term>
+    <term name="long-ordinal-06">sixth</term>
+    <term name="long-ordinal-07">seventh</term>
+    <term name="long-ordinal-08">eighth</term>
+    <term name="long-ordinal-09">ninth</term>
+    <term name="long-ordinal-10">tenth</term>
+    <term name="chapter"><single>chapter</single><multiple>chapters</multiple></term>
+    <term name="chapter" form="short"><single>chap.</single><multiple>chaps.</multiple></term>
+    <term name="edition"><single>edition</single><multiple>editions</multiple></term>
+    <term name="edition" form="short">ed.</term>
+    <term name="issue"><single>issue</single><multiple>issues</multiple></term>
+    <term name="issue" form="short"><single>no.</single><multiple>nos.</multiple></term>
+    <term name="page"><single>page</single><multiple>pages</multiple></term>
+    <term name="page" form="short"><single>p.</single><multiple>pp.</multiple></term>
+    <term name="volume"><single>volume</single><multiple>volumes</multiple></term>
+    <term name="volume" form="short"><single>vol.</single><multiple>vols.</multiple></term>
+    <term name="number-of-pages"><single>page</single><multiple>pages</multiple></term>
+    <term name="number-of-pages" form="short"><single>p.</single><multiple>pp.</multiple></term>
+    <term name="director"><single>director</single><multiple>directors</multiple></term>
+    <term name="editor"><single>editor</single><multiple>editors</multiple></term>
+    <term name="editor" form="short"><single>ed.</single><multiple>eds.</multiple></term>
+    <term name="editorial-director"><single>editor</single><multiple>editors</multiple></term>
+    <term name="editorial-director" form="short"><single>ed.</single><multiple>eds.</multiple></term>
+    <term name="translator"><single>translator</single><multiple>translators</multiple></term>
+    <term name="translator" form="short"><single>tran.</single><multiple>trans.</multiple></term>
+    <term name="container-author" form="verb">by</term>
+    <term name="editor" form="verb">edited by</term>
+    <term name="editor" form="verb-short">ed. by</term>
+    <term name="translator" form="verb">translated by</term>
+    <term name="translator" form="verb-short">trans. by</term>
+    <term name="month-01">January</term>
+    <term name="month-02">February</term>
+    <term name="month-03">March</term>
+    <term name="month-04">April</term>
+    <term name="month-05">May</term>
+    <term name="month-06">June</term>
+    <term name="month-07">July</term>
+    <term name="month-08">August</term>
+    <term name="month-09">September</term>
+    <term name="month-10">October</term>
+    <term name="month-11">November</term>
+    <term name="month-12">December</term>
+    <term name="month-01" form="short">Jan.</term>
+    <term name="month-02" form="short">Feb.</term>
+    <term name="month-03" form="short">Mar.</term>
+    <term name="month-04" form="short">Apr.</term>
+    <term name="month-05" form="short">May</term>
+    <term name="month-06" form="short">Jun.</term>
+    <term name="month-07" form="short">Jul.</term>
+    <term name="month-08" form="short">Aug.</term>
+    <term name="month-09" form="short">Sep.</term>
+    <term name="month-10" form="short">Oct.</term>
+    <term name="month-11" form="short">Nov.</term>
+    <term name="month-12" form="short">Dec.</term>
+  </terms>
+</locale>
+`
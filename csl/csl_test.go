@@ -0,0 +1,103 @@
+package csl
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nickng/bibtex"
+	"github.com/nickng/bibtex/render"
+)
+
+func examples(t *testing.T) *bibtex.BibTex {
+	f, err := os.Open("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bib, err := bibtex.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bib
+}
+
+func processor(t *testing.T, style, locale string, opts ...Option) *Processor {
+	s, err := LoadStyle("testdata/" + style + ".csl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := LoadLocale("testdata/locales-" + locale + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProcessor(s, l, examples(t), opts...)
+}
+
+func TestCite(t *testing.T) {
+	tests := []struct {
+		style, locale string
+		keys          []string
+		want          string
+	}{
+		{"author-date", "en-US", []string{"sigfridsson"}, "(Sigfridsson & Ryde, 1998)"},
+		{"author-date", "en-US", []string{"aksin", "knuth:ct:a", "knuth:ct:b"}, "(Aksın et al., 2006; Knuth, 1984c; Knuth, 1986c)"},
+		{"author-date", "de-DE", []string{"aksin"}, "(Aksın u. a., 2006)"},
+		{"numeric", "en-US", []string{"aksin", "sigfridsson"}, "[4, 18]"},
+	}
+	for _, tt := range tests {
+		p := processor(t, tt.style, tt.locale)
+		got, err := p.Cite(tt.keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s/%s %v:\nwant %s\n got %s", tt.style, tt.locale, tt.keys, tt.want, got)
+		}
+	}
+}
+
+func TestCiteUnknownKey(t *testing.T) {
+	p := processor(t, "author-date", "en-US")
+	if _, err := p.Cite("nonexistent"); !errors.Is(err, ErrUnknownCiteKey) {
+		t.Errorf("expected ErrUnknownCiteKey but got %v", err)
+	}
+}
+
+func TestBibliography(t *testing.T) {
+	tests := []struct {
+		style, locale string
+		format        render.Format
+		want          string
+	}{
+		{"author-date", "en-US", render.Text, "Baez, J. C., & Lauda, A. D. (2004a). Higher-Dimensional Algebra V: 2-Groups. Theory and Applications of Categories, 12, 423–491."},
+		{"author-date", "en-US", render.HTML, "Baez, J. C., &amp; Lauda, A. D. (2004a). Higher-Dimensional Algebra V: 2-Groups. <i>Theory and Applications of Categories</i>, <i>12</i>, 423–491."},
+		{"numeric", "en-US", render.Text, "[6] J. C. Baez and A. D. Lauda, “Higher-Dimensional Algebra V: 2-Groups,” Theory and Applications of Categories, vol. 12, pp. 423–491, 2004."},
+		{"numeric", "de-DE", render.Text, "[6] J. C. Baez und A. D. Lauda, „Higher-Dimensional Algebra V: 2-Groups“, Theory and Applications of Categories, Bd. 12, S. 423–491, 2004."},
+	}
+	for _, tt := range tests {
+		p := processor(t, tt.style, tt.locale, WithFormat(tt.format))
+		found := false
+		for _, entry := range p.Bibliography() {
+			if strings.Contains(entry, "Theory and Applications of Categories") {
+				found = true
+				if entry != tt.want {
+					t.Errorf("%s/%s:\nwant %s\n got %s", tt.style, tt.locale, tt.want, entry)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s/%s: entry not found in bibliography", tt.style, tt.locale)
+		}
+	}
+}
+
+func TestParseStyleErrors(t *testing.T) {
+	if _, err := ParseStyle(strings.NewReader(defaultLocaleXML)); !errors.Is(err, ErrNotStyle) {
+		t.Errorf("expected ErrNotStyle but got %v", err)
+	}
+	if _, err := ParseLocale(strings.NewReader(`<style><citation/></style>`)); !errors.Is(err, ErrNotLocale) {
+		t.Errorf("expected ErrNotLocale but got %v", err)
+	}
+}
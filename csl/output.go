@@ -0,0 +1,256 @@
+package csl
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nickng/bibtex/render"
+)
+
+// span is a run of rendered text with uniform formatting.
+type span struct {
+	s          string
+	italic     bool
+	bold       bool
+	smallCaps  bool
+	closeQuote bool // Closing quotation mark, for punctuation-in-quote.
+}
+
+// output is rendered rich text.
+type output []span
+
+// plain returns o with a plain span appended.
+func (o output) plain(s string) output {
+	if s == "" {
+		return o
+	}
+	return append(o, span{s: s})
+}
+
+// String returns the text of o without formatting.
+func (o output) String() string {
+	var buf strings.Builder
+	for _, sp := range o {
+		buf.WriteString(sp.s)
+	}
+	return buf.String()
+}
+
+func (o output) empty() bool {
+	for _, sp := range o {
+		if sp.s != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// lastRune returns the last rune of the text of o, or utf8.RuneError.
+func (o output) lastRune() rune {
+	for i := len(o) - 1; i >= 0; i-- {
+		if o[i].s != "" {
+			r, _ := utf8.DecodeLastRuneInString(o[i].s)
+			return r
+		}
+	}
+	return utf8.RuneError
+}
+
+// concat joins a and b, dropping a leading period of b if a already ends in
+// terminal punctuation, to avoid doubled punctuation.
+func concat(a, b output) output {
+	if len(b) == 0 {
+		return a
+	}
+	switch a.lastRune() {
+	case '.', '?', '!':
+		if b[0].s != "" && b[0].s[0] == '.' && !strings.HasPrefix(b[0].s, "..") {
+			b = append(output{b[0]}, b[1:]...)
+			b[0].s = b[0].s[1:]
+		}
+	}
+	return append(a, b...)
+}
+
+// join joins the non-empty parts with delim.
+func join(parts []output, delim string) output {
+	var o output
+	for _, part := range parts {
+		if part.empty() {
+			continue
+		}
+		if len(o) > 0 {
+			o = concat(o, output{}.plain(delim))
+		}
+		o = concat(o, part)
+	}
+	return o
+}
+
+// mapText applies fn to the text of every span.
+func (o output) mapText(fn func(string) string) output {
+	mapped := make(output, len(o))
+	for i, sp := range o {
+		sp.s = fn(sp.s)
+		mapped[i] = sp
+	}
+	return mapped
+}
+
+// format serializes o in the given format.
+func (o output) format(f render.Format, punctuationInQuote bool) string {
+	spans := append(output(nil), o...)
+	if punctuationInQuote {
+		for i := 0; i+1 < len(spans); i++ {
+			if next := spans[i+1].s; spans[i].closeQuote && next != "" && (next[0] == ',' || next[0] == '.') {
+				spans[i].s, spans[i+1].s = next[:1]+spans[i].s, next[1:]
+			}
+		}
+	}
+	var buf strings.Builder
+	for _, sp := range spans {
+		if sp.s == "" {
+			continue
+		}
+		switch f {
+		case render.HTML:
+			s := html.EscapeString(sp.s)
+			if sp.smallCaps {
+				s = `<span style="font-variant:small-caps;">` + s + "</span>"
+			}
+			if sp.bold {
+				s = "<b>" + s + "</b>"
+			}
+			if sp.italic {
+				s = "<i>" + s + "</i>"
+			}
+			buf.WriteString(s)
+		case render.Markdown:
+			s := markdownEscaper.Replace(sp.s)
+			if sp.bold && strings.TrimSpace(s) != "" {
+				s = "**" + s + "**"
+			}
+			if sp.italic && strings.TrimSpace(s) != "" {
+				s = "*" + s + "*"
+			}
+			buf.WriteString(s)
+		default:
+			buf.WriteString(sp.s)
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`,
+)
+
+// formatting applies the CSL formatting attributes of e (font-style,
+// font-weight, font-variant, text-case, strip-periods, quotes and affixes)
+// to o.
+func (ctx *context) formatting(e *element, o output) output {
+	if o.empty() {
+		return nil
+	}
+	if e.attr("strip-periods") == "true" {
+		o = o.mapText(func(s string) string { return strings.ReplaceAll(s, ".", "") })
+	}
+	if textCase := e.attr("text-case"); textCase != "" {
+		o = applyTextCase(o, textCase)
+	}
+	for i := range o {
+		switch e.attr("font-style") {
+		case "italic", "oblique":
+			o[i].italic = true
+		case "normal":
+			o[i].italic = false
+		}
+		switch e.attr("font-weight") {
+		case "bold":
+			o[i].bold = true
+		case "normal", "light":
+			o[i].bold = false
+		}
+		if e.attr("font-variant") == "small-caps" {
+			o[i].smallCaps = true
+		}
+	}
+	if e.attr("quotes") == "true" {
+		quoted := output{}.plain(ctx.term("open-quote", "long", false))
+		quoted = append(quoted, o...)
+		o = append(quoted, span{s: ctx.term("close-quote", "long", false), closeQuote: true})
+	}
+	return ctx.affixes(e, o)
+}
+
+// affixes adds the prefix and suffix of e around o.
+func (ctx *context) affixes(e *element, o output) output {
+	if o.empty() {
+		return nil
+	}
+	return concat(concat(output{}.plain(e.attr("prefix")), o), output{}.plain(e.attr("suffix")))
+}
+
+// titleStopWords are not capitalized by text-case="title".
+var titleStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "from": true, "in": true, "into": true,
+	"nor": true, "of": true, "on": true, "or": true, "over": true,
+	"the": true, "to": true, "up": true, "with": true,
+}
+
+// applyTextCase implements the CSL text-case attribute.
+func applyTextCase(o output, textCase string) output {
+	switch textCase {
+	case "lowercase":
+		return o.mapText(strings.ToLower)
+	case "uppercase":
+		return o.mapText(strings.ToUpper)
+	case "capitalize-first", "sentence":
+		done := false
+		return o.mapText(func(s string) string {
+			if done || s == "" {
+				return s
+			}
+			done = true
+			return upperFirst(s)
+		})
+	case "capitalize-all":
+		return o.mapText(func(s string) string {
+			return mapWords(s, func(i int, w string) string { return upperFirst(w) })
+		})
+	case "title":
+		first := true
+		return o.mapText(func(s string) string {
+			return mapWords(s, func(i int, w string) string {
+				defer func() { first = false }()
+				if !first && titleStopWords[strings.ToLower(w)] {
+					return w
+				}
+				return upperFirst(w)
+			})
+		})
+	}
+	return o
+}
+
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if unicode.IsLower(r) {
+		return string(unicode.ToUpper(r)) + s[size:]
+	}
+	return s
+}
+
+// mapWords applies fn to every space-separated word of s.
+func mapWords(s string, fn func(i int, w string) string) string {
+	words := strings.Split(s, " ")
+	for i, w := range words {
+		if w != "" {
+			words[i] = fn(i, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,580 @@
+package csl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nickng/bibtex"
+	"github.com/nickng/bibtex/render"
+)
+
+// item is a BibTeX entry converted to the CSL data model.
+type item struct {
+	key   string
+	typ   string
+	vars  map[string]string        // Ordinary and number variables.
+	names map[string][]bibtex.Name // Name variables, decoded.
+	dates map[string]date          // Date variables.
+
+	number int // citation-number, by bibliography order.
+
+	// Disambiguation state.
+	etAlUseFirst int    // Names shown before et al., if above the style's.
+	givenName    bool   // Show given names or initials in short names.
+	disambiguate bool   // Value of the disambiguate condition.
+	yearSuffix   string // Suffix added to the year, e.g. "a".
+}
+
+// date is a (possibly partial) calendar date.
+type date struct {
+	year, month, day int
+	literal          string
+}
+
+func (d date) empty() bool {
+	return d.year == 0 && d.literal == ""
+}
+
+// cslTypes maps BibTeX entry types to CSL item types.
+var cslTypes = map[string]string{
+	"article":       "article-journal",
+	"book":          "book",
+	"mvbook":        "book",
+	"booklet":       "pamphlet",
+	"collection":    "book",
+	"mvcollection":  "book",
+	"proceedings":   "book",
+	"mvproceedings": "book",
+	"periodical":    "periodical",
+	"inbook":        "chapter",
+	"incollection":  "chapter",
+	"inproceedings": "paper-conference",
+	"conference":    "paper-conference",
+	"inreference":   "entry-encyclopedia",
+	"manual":        "book",
+	"mastersthesis": "thesis",
+	"phdthesis":     "thesis",
+	"thesis":        "thesis",
+	"techreport":    "report",
+	"report":        "report",
+	"patent":        "patent",
+	"online":        "webpage",
+	"www":           "webpage",
+	"software":      "software",
+	"dataset":       "dataset",
+	"unpublished":   "manuscript",
+	"misc":          "article",
+}
+
+// cslVariables maps BibTeX fields to CSL ordinary and number variables;
+// earlier fields take precedence.
+var cslVariables = []struct{ field, variable string }{
+	{"title", "title"},
+	{"shorttitle", "title-short"},
+	{"journaltitle", "container-title"},
+	{"journal", "container-title"},
+	{"booktitle", "container-title"},
+	{"shortjournal", "container-title-short"},
+	{"series", "collection-title"},
+	{"publisher", "publisher"},
+	{"institution", "publisher"},
+	{"school", "publisher"},
+	{"organization", "publisher"},
+	{"howpublished", "publisher"},
+	{"location", "publisher-place"},
+	{"address", "publisher-place"},
+	{"volume", "volume"},
+	{"volumes", "number-of-volumes"},
+	{"pages", "page"},
+	{"pagetotal", "number-of-pages"},
+	{"edition", "edition"},
+	{"chapter", "chapter-number"},
+	{"doi", "DOI"},
+	{"url", "URL"},
+	{"isbn", "ISBN"},
+	{"issn", "ISSN"},
+	{"abstract", "abstract"},
+	{"note", "note"},
+	{"addendum", "note"},
+	{"eventtitle", "event"},
+	{"venue", "event-place"},
+	{"language", "language"},
+	{"langid", "language"},
+	{"keywords", "keyword"},
+	{"version", "version"},
+	{"type", "genre"},
+}
+
+// newItem converts a BibTeX entry to a CSL item.
+func newItem(entry *bibtex.BibEntry) *item {
+	it := &item{
+		key:   entry.CiteName,
+		typ:   cslTypes[entry.Type],
+		vars:  make(map[string]string),
+		names: make(map[string][]bibtex.Name),
+		dates: make(map[string]date),
+	}
+	if it.typ == "" {
+		it.typ = "article"
+	}
+	fields := make(map[string]string, len(entry.Fields))
+	for key, val := range entry.Fields {
+		fields[strings.ToLower(key)] = val.String()
+	}
+	for _, v := range cslVariables {
+		if it.vars[v.variable] == "" && fields[v.field] != "" {
+			it.vars[v.variable] = bibtex.DecodeTeX(fields[v.field])
+		}
+	}
+	if sub := bibtex.DecodeTeX(fields["subtitle"]); sub != "" && it.vars["title"] != "" {
+		it.vars["title"] += ": " + sub
+	}
+	if pages := it.vars["page"]; pages != "" && !strings.Contains(pages, "–") {
+		it.vars["page"] = strings.ReplaceAll(pages, "-", "–")
+	}
+	if it.vars["DOI"] != "" {
+		it.vars["DOI"] = strings.TrimPrefix(it.vars["DOI"], "https://doi.org/")
+	}
+	// The BibTeX number field is an issue for periodicals and a report or
+	// patent number otherwise.
+	if num := bibtex.DecodeTeX(fields["number"]); num != "" {
+		if it.typ == "article-journal" || it.typ == "periodical" {
+			it.vars["issue"] = num
+		} else {
+			it.vars["number"] = num
+		}
+	}
+	if it.vars["issue"] == "" && fields["issue"] != "" {
+		it.vars["issue"] = bibtex.DecodeTeX(fields["issue"])
+	}
+	switch entry.Type {
+	case "phdthesis":
+		it.vars["genre"] = "PhD thesis"
+	case "mastersthesis":
+		it.vars["genre"] = "Master's thesis"
+	}
+	it.vars["citation-label"] = entry.CiteName
+
+	for field, variable := range map[string]string{
+		"author": "author", "editor": "editor", "translator": "translator",
+		"bookauthor": "container-author", "holder": "author",
+	} {
+		if fields[field] == "" || len(it.names[variable]) > 0 {
+			continue
+		}
+		names := bibtex.ParseNames(fields[field])
+		for i, n := range names {
+			names[i] = bibtex.Name{
+				First: bibtex.DecodeTeX(n.First),
+				Von:   bibtex.DecodeTeX(n.Von),
+				Last:  bibtex.DecodeTeX(n.Last),
+				Jr:    bibtex.DecodeTeX(n.Jr),
+			}
+		}
+		it.names[variable] = names
+	}
+
+	if d := parseDate(bibtex.DecodeTeX(fields["date"])); !d.empty() {
+		it.dates["issued"] = d
+	} else if year, err := strconv.Atoi(strings.TrimSpace(fields["year"])); err == nil {
+		it.dates["issued"] = date{year: year, month: parseMonth(fields["month"])}
+	} else if fields["year"] != "" {
+		it.dates["issued"] = date{literal: bibtex.DecodeTeX(fields["year"])}
+	}
+	if d := parseDate(fields["urldate"]); !d.empty() {
+		it.dates["accessed"] = d
+	}
+	if d := parseDate(fields["eventdate"]); !d.empty() {
+		it.dates["event-date"] = d
+	}
+	if d := parseDate(fields["origdate"]); !d.empty() {
+		it.dates["original-date"] = d
+	}
+	return it
+}
+
+// parseDate parses an ISO 8601 (EDTF level 0) date such as 2006, 1991-03 or
+// 2001-05-19. For ranges only the start date is kept.
+func parseDate(s string) date {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return date{}
+	}
+	start, _, _ := strings.Cut(s, "/")
+	parts := strings.Split(start, "-")
+	var d date
+	var err error
+	if d.year, err = strconv.Atoi(parts[0]); err != nil {
+		return date{literal: s}
+	}
+	if len(parts) > 1 {
+		d.month, _ = strconv.Atoi(parts[1])
+	}
+	if len(parts) > 2 {
+		d.day, _ = strconv.Atoi(parts[2])
+	}
+	return d
+}
+
+// parseMonth parses a BibTeX month field, e.g. "3", "mar" or "March".
+func parseMonth(s string) int {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if m, err := strconv.Atoi(s); err == nil && m >= 1 && m <= 12 {
+		return m
+	}
+	for i, name := range []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"} {
+		if strings.HasPrefix(s, name) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// config controls the output of a Processor.
+type config struct {
+	format render.Format
+}
+
+// Option configures a Processor.
+type Option func(config *config)
+
+// WithFormat selects the output format (default render.Text).
+func WithFormat(format render.Format) Option {
+	return func(config *config) {
+		config.format = format
+	}
+}
+
+// Processor renders the entries of a bibliography with a CSL style.
+type Processor struct {
+	style  *Style
+	locale *Locale
+	config config
+
+	items []*item // Items in bibliography order.
+	byKey map[string]*item
+}
+
+// NewProcessor creates a processor rendering the entries of bib with style,
+// using terms and date formats from locale. The locale may be nil, in which
+// case a minimal built-in en-US locale is used.
+func NewProcessor(style *Style, locale *Locale, bib *bibtex.BibTex, options ...Option) *Processor {
+	p := &Processor{
+		style:  style,
+		locale: locale,
+		byKey:  make(map[string]*item),
+	}
+	for _, option := range options {
+		option(&p.config)
+	}
+	for _, entry := range bib.Entries {
+		it := newItem(entry)
+		p.items = append(p.items, it)
+		p.byKey[it.key] = it
+	}
+	p.sortBibliography()
+	p.disambiguate()
+	return p
+}
+
+// Bibliography returns the formatted bibliography entries in the order of
+// the style's bibliography sort (or bibliography order if unsorted). It
+// returns nil if the style has no bibliography.
+func (p *Processor) Bibliography() []string {
+	if p.style.bibliography == nil {
+		return nil
+	}
+	layout := p.style.bibliography.child("layout")
+	var entries []string
+	for _, it := range p.items {
+		ctx := p.newContext(it, p.style.bibliography)
+		o := ctx.affixes(layout, ctx.formatting(stripAffixes(layout), ctx.children(layout)))
+		entries = append(entries, o.format(p.config.format, p.punctuationInQuote()))
+	}
+	return entries
+}
+
+// Cite returns the formatted in-text citation of the given keys, sorted
+// according to the style's citation sort.
+func (p *Processor) Cite(keys ...string) (string, error) {
+	var items []*item
+	for _, key := range keys {
+		it, ok := p.byKey[key]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnknownCiteKey, key)
+		}
+		items = append(items, it)
+	}
+	p.sortItems(items, p.style.citation)
+
+	layout := p.style.citation.child("layout")
+	var cites []output
+	for _, it := range items {
+		cites = append(cites, p.cite(it))
+	}
+	ctx := p.newContext(nil, p.style.citation)
+	o := ctx.affixes(layout, ctx.formatting(stripAffixes(layout), join(cites, layout.attr("delimiter"))))
+	return o.format(p.config.format, p.punctuationInQuote()), nil
+}
+
+// cite renders the citation layout of a single item, without the layout
+// affixes and delimiter.
+func (p *Processor) cite(it *item) output {
+	ctx := p.newContext(it, p.style.citation)
+	return ctx.children(p.style.citation.child("layout"))
+}
+
+// stripAffixes returns a copy of e without prefix, suffix and delimiter, so
+// that layout formatting can be applied separately from its affixes.
+func stripAffixes(e *element) *element {
+	stripped := *e
+	stripped.Attrs = nil
+	for _, a := range e.Attrs {
+		switch a.Name.Local {
+		case "prefix", "suffix", "delimiter":
+		default:
+			stripped.Attrs = append(stripped.Attrs, a)
+		}
+	}
+	return &stripped
+}
+
+func (p *Processor) punctuationInQuote() bool {
+	for _, l := range p.locales() {
+		if l.hasPunctuation {
+			return l.punctuationInQuote
+		}
+	}
+	return false
+}
+
+// locales returns the locales to look up terms in, in priority order.
+func (p *Processor) locales() []*Locale {
+	var locales []*Locale
+	lang := defaultLocale.Lang
+	if p.locale != nil {
+		lang = p.locale.Lang
+	}
+	primary, _, _ := strings.Cut(lang, "-")
+	// Inline locales matching the language (e.g. "de-DE" or "de") take
+	// precedence over the locale file; inline locales without a language
+	// apply to all languages.
+	for _, l := range p.style.locales {
+		if l.Lang == lang {
+			locales = append(locales, l)
+		}
+	}
+	for _, l := range p.style.locales {
+		if l.Lang == primary && primary != lang {
+			locales = append(locales, l)
+		}
+	}
+	for _, l := range p.style.locales {
+		if l.Lang == "" {
+			locales = append(locales, l)
+		}
+	}
+	if p.locale != nil {
+		locales = append(locales, p.locale)
+	}
+	return append(locales, defaultLocale)
+}
+
+// sortBibliography sorts items by the bibliography sort keys and assigns
+// citation numbers in the resulting order.
+func (p *Processor) sortBibliography() {
+	for i, it := range p.items {
+		it.number = i + 1
+	}
+	if p.style.bibliography != nil {
+		p.sortItems(p.items, p.style.bibliography)
+	}
+	for i, it := range p.items {
+		it.number = i + 1
+	}
+}
+
+// sortItems sorts items by the sort keys of the citation or bibliography
+// element mode. Items with an empty key sort last.
+func (p *Processor) sortItems(items []*item, mode *element) {
+	sortElem := mode.child("sort")
+	if sortElem == nil {
+		return
+	}
+	keys := make(map[*item][]string, len(items))
+	for _, it := range items {
+		for _, key := range sortElem.Children {
+			keys[it] = append(keys[it], p.sortKey(it, mode, key))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		ki, kj := keys[items[i]], keys[items[j]]
+		for n, key := range sortElem.Children {
+			if ki[n] == kj[n] {
+				continue
+			}
+			if ki[n] == "" || kj[n] == "" {
+				return kj[n] == ""
+			}
+			if key.attr("sort") == "descending" {
+				return ki[n] > kj[n]
+			}
+			return ki[n] < kj[n]
+		}
+		return false
+	})
+}
+
+// sortKey renders the sort key of it for a sort key element.
+func (p *Processor) sortKey(it *item, mode, key *element) string {
+	ctx := p.newContext(it, mode)
+	ctx.sorting = true
+	ctx.sortKey = key
+	var o output
+	if macro := key.attr("macro"); macro != "" {
+		o = ctx.macro(macro)
+	} else {
+		variable := key.attr("variable")
+		switch {
+		case isNameVariable(variable):
+			o = ctx.names(&element{Attrs: key.Attrs}, []string{variable})
+		case isDateVariable(variable):
+			o = output{}.plain(ctx.dateSortKey(variable))
+		case variable == "citation-number":
+			o = output{}.plain(fmt.Sprintf("%08d", it.number))
+		default:
+			o = output{}.plain(ctx.variable(variable, "long"))
+		}
+	}
+	return strings.ToLower(bibtex.ASCIIFold(o.String()))
+}
+
+// disambiguate resolves ambiguous citations, in the order given by the CSL
+// specification: by adding names, then given names, then the disambiguate
+// condition, then year suffixes.
+func (p *Processor) disambiguate() {
+	citation := p.style.citation
+	addNames := citation.attr("disambiguate-add-names") == "true"
+	addGivenName := citation.attr("disambiguate-add-givenname") == "true"
+	addYearSuffix := citation.attr("disambiguate-add-year-suffix") == "true"
+
+	// Each method is kept for a group only if it reduces its ambiguity.
+	if addNames {
+		for _, group := range p.ambiguous() {
+			saved := make([]int, len(group))
+			for i, it := range group {
+				saved[i] = it.etAlUseFirst
+			}
+			for n := p.etAlUseFirst(); ; n++ {
+				grown := false
+				for _, it := range group {
+					if n < maxNames(it) {
+						it.etAlUseFirst, grown = n+1, true
+					}
+				}
+				if !grown || p.ambiguity(group) == 0 {
+					break
+				}
+			}
+			if p.ambiguity(group) == len(group) {
+				for i, it := range group {
+					it.etAlUseFirst = saved[i]
+				}
+			}
+		}
+	}
+	if addGivenName {
+		for _, group := range p.ambiguous() {
+			for _, it := range group {
+				it.givenName = true
+			}
+			if p.ambiguity(group) == len(group) {
+				for _, it := range group {
+					it.givenName = false
+				}
+			}
+		}
+	}
+	for _, group := range p.ambiguous() {
+		for _, it := range group {
+			it.disambiguate = true
+		}
+	}
+	if addYearSuffix {
+		for _, group := range p.ambiguous() {
+			// Items are already in bibliography order.
+			for i, it := range group {
+				it.yearSuffix = yearSuffix(i)
+			}
+		}
+	}
+}
+
+// ambiguous returns groups of items whose citations render identically.
+func (p *Processor) ambiguous() [][]*item {
+	return p.groupAmbiguous(p.items)
+}
+
+func (p *Processor) groupAmbiguous(items []*item) [][]*item {
+	byCite := make(map[string][]*item)
+	var order []string
+	for _, it := range items {
+		cite := p.cite(it).String()
+		if _, seen := byCite[cite]; !seen {
+			order = append(order, cite)
+		}
+		byCite[cite] = append(byCite[cite], it)
+	}
+	var groups [][]*item
+	for _, cite := range order {
+		if len(byCite[cite]) > 1 {
+			groups = append(groups, byCite[cite])
+		}
+	}
+	return groups
+}
+
+// ambiguity returns the number of items of group that are still ambiguous
+// among themselves.
+func (p *Processor) ambiguity(group []*item) int {
+	n := 0
+	for _, g := range p.groupAmbiguous(group) {
+		n += len(g)
+	}
+	return n
+}
+
+// etAlUseFirst returns the et-al-use-first setting of the citation.
+func (p *Processor) etAlUseFirst() int {
+	n, _ := strconv.Atoi(p.inherited(p.style.citation, "et-al-use-first"))
+	return n
+}
+
+// inherited looks up an inheritable name option on mode, then on style.
+func (p *Processor) inherited(mode *element, name string) string {
+	if mode.hasAttr(name) {
+		return mode.attr(name)
+	}
+	return p.style.root.attr(name)
+}
+
+// maxNames returns the length of the longest name list of it.
+func maxNames(it *item) int {
+	max := 0
+	for _, names := range it.names {
+		if len(names) > max {
+			max = len(names)
+		}
+	}
+	return max
+}
+
+// yearSuffix returns the i-th year suffix: a, b, ..., z, aa, ab, ...
+func yearSuffix(i int) string {
+	if i < 26 {
+		return string(rune('a' + i))
+	}
+	return yearSuffix(i/26-1) + string(rune('a'+i%26))
+}
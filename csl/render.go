@@ -0,0 +1,741 @@
+package csl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nickng/bibtex"
+)
+
+// context is the state of rendering one item with a citation or
+// bibliography element.
+type context struct {
+	p    *Processor
+	item *item
+	mode *element // The citation or bibliography element.
+
+	suppressed map[string]bool // Variables consumed by a names substitute.
+	called     int             // Variables looked up, for group suppression.
+	rendered   int             // Variables that were non-empty.
+
+	sorting bool     // Rendering a sort key.
+	sortKey *element // The sort key element, when sorting.
+}
+
+func (p *Processor) newContext(it *item, mode *element) *context {
+	return &context{p: p, item: it, mode: mode, suppressed: make(map[string]bool)}
+}
+
+// children renders the child elements of e, concatenated with the
+// delimiter of e.
+func (ctx *context) children(e *element) output {
+	var parts []output
+	for _, c := range e.Children {
+		parts = append(parts, ctx.element(c))
+	}
+	return join(parts, e.attr("delimiter"))
+}
+
+// element renders a single rendering element.
+func (ctx *context) element(e *element) output {
+	switch e.XMLName.Local {
+	case "text":
+		return ctx.text(e)
+	case "number":
+		return ctx.formatting(e, ctx.number(e))
+	case "date":
+		return ctx.date(e)
+	case "names":
+		return ctx.formatting(e, ctx.names(e, strings.Fields(e.attr("variable"))))
+	case "label":
+		return ctx.formatting(e, ctx.label(e, e.attr("variable")))
+	case "group":
+		return ctx.group(e)
+	case "choose":
+		return ctx.choose(e)
+	}
+	return nil
+}
+
+// text renders a cs:text element.
+func (ctx *context) text(e *element) output {
+	var o output
+	switch {
+	case e.hasAttr("variable"):
+		form := e.attr("form")
+		if form == "" {
+			form = "long"
+		}
+		o = output{}.plain(ctx.variable(e.attr("variable"), form))
+	case e.hasAttr("macro"):
+		o = ctx.macro(e.attr("macro"))
+	case e.hasAttr("term"):
+		form := e.attr("form")
+		if form == "" {
+			form = "long"
+		}
+		o = output{}.plain(ctx.term(e.attr("term"), form, e.attr("plural") == "true"))
+	case e.hasAttr("value"):
+		o = output{}.plain(e.attr("value"))
+	}
+	return ctx.formatting(e, o)
+}
+
+// macro renders the named macro.
+func (ctx *context) macro(name string) output {
+	m, ok := ctx.p.style.macros[name]
+	if !ok {
+		return nil
+	}
+	return ctx.children(m)
+}
+
+// variable returns the value of an ordinary or number variable, recording
+// the lookup for group suppression.
+func (ctx *context) variable(name, form string) string {
+	ctx.called++
+	if ctx.item == nil || ctx.suppressed[name] {
+		return ""
+	}
+	var v string
+	switch name {
+	case "citation-number":
+		v = strconv.Itoa(ctx.item.number)
+	case "year-suffix":
+		v = ctx.item.yearSuffix
+	case "title", "container-title":
+		if form == "short" {
+			v = ctx.item.vars[name+"-short"]
+		}
+		if v == "" {
+			v = ctx.item.vars[name]
+		}
+	default:
+		v = ctx.item.vars[name]
+	}
+	if v != "" {
+		ctx.rendered++
+	}
+	return v
+}
+
+// term looks up a localized term, falling back from the requested form as
+// described in the specification (verb-short to verb to long, symbol to
+// short to long).
+func (ctx *context) term(name, form string, plural bool) string {
+	forms := []string{form}
+	switch form {
+	case "verb-short":
+		forms = append(forms, "verb", "long")
+	case "symbol":
+		forms = append(forms, "short", "long")
+	case "short", "verb":
+		forms = append(forms, "long")
+	}
+	for _, f := range forms {
+		for _, l := range ctx.p.locales() {
+			if t, ok := l.terms[termKey{name: name, form: f}]; ok {
+				if plural {
+					return t.multiple
+				}
+				return t.single
+			}
+		}
+	}
+	return ""
+}
+
+// group renders a cs:group, which is suppressed if it calls at least one
+// variable but all of them are empty.
+func (ctx *context) group(e *element) output {
+	called, rendered := ctx.called, ctx.rendered
+	o := ctx.children(e)
+	if ctx.called > called && ctx.rendered == rendered {
+		return nil
+	}
+	return ctx.formatting(e, o)
+}
+
+// choose renders the first matching branch of a cs:choose.
+func (ctx *context) choose(e *element) output {
+	for _, branch := range e.Children {
+		if branch.XMLName.Local == "else" || ctx.condition(branch) {
+			return ctx.children(branch)
+		}
+	}
+	return nil
+}
+
+// condition evaluates the tests of a cs:if or cs:else-if branch.
+func (ctx *context) condition(e *element) bool {
+	var results []bool
+	for _, a := range e.Attrs {
+		var test func(string) bool
+		switch a.Name.Local {
+		case "type":
+			test = func(v string) bool { return ctx.item != nil && ctx.item.typ == v }
+		case "variable":
+			test = func(v string) bool { return ctx.hasVariable(v) }
+		case "is-numeric":
+			test = func(v string) bool { return isNumeric(ctx.peek(v)) }
+		case "is-uncertain-date":
+			test = func(v string) bool { return false }
+		case "locator":
+			test = func(v string) bool { return false }
+		case "position":
+			test = func(v string) bool { return v == "first" }
+		case "disambiguate":
+			test = func(v string) bool { return ctx.item != nil && ctx.item.disambiguate == (v == "true") }
+		default:
+			continue
+		}
+		for _, v := range strings.Fields(a.Value) {
+			results = append(results, test(v))
+		}
+	}
+	switch e.attr("match") {
+	case "any":
+		for _, r := range results {
+			if r {
+				return true
+			}
+		}
+		return false
+	case "none":
+		for _, r := range results {
+			if r {
+				return false
+			}
+		}
+		return true
+	default: // "all"
+		for _, r := range results {
+			if !r {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// hasVariable returns true if variable v of the item is non-empty.
+func (ctx *context) hasVariable(v string) bool {
+	if ctx.item == nil || ctx.suppressed[v] {
+		return false
+	}
+	switch {
+	case isNameVariable(v):
+		return len(ctx.item.names[v]) > 0
+	case isDateVariable(v):
+		return !ctx.item.dates[v].empty()
+	case v == "citation-number":
+		return true
+	case v == "year-suffix":
+		return ctx.item.yearSuffix != ""
+	}
+	return ctx.item.vars[v] != ""
+}
+
+// peek returns the value of a variable without counting it as rendered.
+func (ctx *context) peek(v string) string {
+	if ctx.item == nil {
+		return ""
+	}
+	if v == "citation-number" {
+		return strconv.Itoa(ctx.item.number)
+	}
+	return ctx.item.vars[v]
+}
+
+// isNumeric returns true if v is a number, optionally with a prefix or
+// suffix, or a range or list of such numbers, e.g. "2", "2a", "12–14".
+func isNumeric(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, part := range strings.FieldsFunc(v, func(r rune) bool {
+		return r == '-' || r == '–' || r == ',' || r == '&' || unicode.IsSpace(r)
+	}) {
+		if !strings.ContainsAny(part, "0123456789") {
+			return false
+		}
+		letters := strings.TrimFunc(part, unicode.IsDigit)
+		if len([]rune(letters)) > 2 {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameVariable(v string) bool {
+	switch v {
+	case "author", "editor", "translator", "container-author", "collection-editor",
+		"composer", "director", "editorial-director", "illustrator", "interviewer",
+		"original-author", "recipient", "reviewed-author":
+		return true
+	}
+	return false
+}
+
+func isDateVariable(v string) bool {
+	switch v {
+	case "issued", "accessed", "event-date", "original-date", "submitted":
+		return true
+	}
+	return false
+}
+
+// number renders a cs:number element.
+func (ctx *context) number(e *element) output {
+	v := ctx.variable(e.attr("variable"), "long")
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return output{}.plain(v)
+	}
+	switch e.attr("form") {
+	case "ordinal":
+		return output{}.plain(v + ctx.ordinal(n))
+	case "long-ordinal":
+		if n >= 1 && n <= 10 {
+			return output{}.plain(ctx.term(fmt.Sprintf("long-ordinal-%02d", n), "long", false))
+		}
+		return output{}.plain(v + ctx.ordinal(n))
+	case "roman":
+		return output{}.plain(roman(n))
+	}
+	return output{}.plain(v)
+}
+
+// ordinal returns the ordinal suffix for n from the locale terms.
+func (ctx *context) ordinal(n int) string {
+	if t := ctx.term(fmt.Sprintf("ordinal-%02d", n%100), "long", false); n%100 > 10 && n%100 < 14 && t != "" {
+		return t
+	}
+	if t := ctx.term(fmt.Sprintf("ordinal-%02d", n%10), "long", false); t != "" && !(n%100 > 10 && n%100 < 14) {
+		return t
+	}
+	return ctx.term("ordinal", "long", false)
+}
+
+// roman returns n in lower-case Roman numerals.
+func roman(n int) string {
+	if n <= 0 || n >= 4000 {
+		return strconv.Itoa(n)
+	}
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	numerals := []string{"m", "cm", "d", "cd", "c", "xc", "l", "xl", "x", "ix", "v", "iv", "i"}
+	var buf strings.Builder
+	for i, v := range values {
+		for n >= v {
+			buf.WriteString(numerals[i])
+			n -= v
+		}
+	}
+	return buf.String()
+}
+
+// label renders the term for a variable, e.g. "pp." for page or "eds." for
+// editor, plural if the variable has multiple values.
+func (ctx *context) label(e *element, variable string) output {
+	if !ctx.hasVariable(variable) {
+		return nil
+	}
+	plural := false
+	switch e.attr("plural") {
+	case "always":
+		plural = true
+	case "never":
+	default:
+		if isNameVariable(variable) {
+			plural = len(ctx.item.names[variable]) > 1
+		} else {
+			plural = strings.ContainsAny(ctx.item.vars[variable], "–-,&")
+		}
+	}
+	form := e.attr("form")
+	if form == "" {
+		form = "long"
+	}
+	return output{}.plain(ctx.term(variable, form, plural))
+}
+
+// date renders a cs:date element, either in a localized form or with its
+// own date-part children.
+func (ctx *context) date(e *element) output {
+	variable := e.attr("variable")
+	ctx.called++
+	if ctx.item == nil || ctx.suppressed[variable] {
+		return nil
+	}
+	d, ok := ctx.item.dates[variable]
+	if !ok || d.empty() {
+		return nil
+	}
+	ctx.rendered++
+	if d.literal != "" {
+		return ctx.formatting(e, output{}.plain(d.literal))
+	}
+
+	parts := e.Children
+	if form := e.attr("form"); form != "" {
+		// Localized date: date-parts come from the locale, and child
+		// date-part elements may only override their formatting.
+		for _, l := range ctx.p.locales() {
+			if ld, ok := l.dates[form]; ok {
+				parts = overrideDateParts(ld.Children, e.Children)
+				break
+			}
+		}
+	}
+	show := map[string]bool{"year": true, "month": true, "day": true}
+	switch e.attr("date-parts") {
+	case "year":
+		show["month"], show["day"] = false, false
+	case "year-month":
+		show["day"] = false
+	}
+
+	var rendered []output
+	for _, part := range parts {
+		if part.XMLName.Local != "date-part" || !show[part.attr("name")] {
+			continue
+		}
+		rendered = append(rendered, ctx.formatting(part, ctx.datePart(part, d, variable)))
+	}
+	return ctx.formatting(e, join(rendered, e.attr("delimiter")))
+}
+
+// overrideDateParts merges formatting attributes of the style's date-part
+// elements into the locale's date-part elements.
+func overrideDateParts(locale, style []*element) []*element {
+	var merged []*element
+	for _, part := range locale {
+		m := *part
+		for _, s := range style {
+			if s.attr("name") == part.attr("name") {
+				// Attributes are looked up first to last, so the style wins.
+				m.Attrs = append(append([]xml.Attr(nil), s.Attrs...), part.Attrs...)
+			}
+		}
+		merged = append(merged, &m)
+	}
+	return merged
+}
+
+// datePart renders one part of a date.
+func (ctx *context) datePart(e *element, d date, variable string) output {
+	switch e.attr("name") {
+	case "year":
+		if d.year == 0 {
+			return nil
+		}
+		year := strconv.Itoa(d.year)
+		if e.attr("form") == "short" {
+			year = fmt.Sprintf("%02d", d.year%100)
+		}
+		// Year suffixes are attached to the first rendered issued year
+		// unless the style renders the year-suffix variable itself.
+		if variable == "issued" && !ctx.p.style.explicitYearSuffix && ctx.item.yearSuffix != "" && !ctx.sorting {
+			year += ctx.item.yearSuffix
+		}
+		return output{}.plain(year)
+	case "month":
+		if d.month < 1 || d.month > 12 {
+			return nil
+		}
+		switch e.attr("form") {
+		case "numeric":
+			return output{}.plain(strconv.Itoa(d.month))
+		case "numeric-leading-zeros":
+			return output{}.plain(fmt.Sprintf("%02d", d.month))
+		case "short":
+			return output{}.plain(ctx.term(fmt.Sprintf("month-%02d", d.month), "short", false))
+		}
+		return output{}.plain(ctx.term(fmt.Sprintf("month-%02d", d.month), "long", false))
+	case "day":
+		if d.day == 0 {
+			return nil
+		}
+		switch e.attr("form") {
+		case "numeric-leading-zeros":
+			return output{}.plain(fmt.Sprintf("%02d", d.day))
+		case "ordinal":
+			return output{}.plain(strconv.Itoa(d.day) + ctx.ordinal(d.day))
+		}
+		return output{}.plain(strconv.Itoa(d.day))
+	}
+	return nil
+}
+
+// dateSortKey returns a date as YYYYMMDD for sorting.
+func (ctx *context) dateSortKey(variable string) string {
+	d := ctx.item.dates[variable]
+	if d.empty() {
+		return ""
+	}
+	if d.literal != "" {
+		return d.literal
+	}
+	return fmt.Sprintf("%04d%02d%02d", d.year, d.month, d.day)
+}
+
+// names renders a cs:names element for the given name variables, falling
+// back to its cs:substitute children if all variables are empty.
+func (ctx *context) names(e *element, variables []string) output {
+	nameElem := e.child("name")
+	if nameElem == nil {
+		nameElem = &element{}
+	}
+	var parts []output
+	for _, variable := range variables {
+		ctx.called++
+		if ctx.item == nil || ctx.suppressed[variable] || len(ctx.item.names[variable]) == 0 {
+			continue
+		}
+		ctx.rendered++
+		o := ctx.nameList(nameElem, e.child("et-al"), ctx.item.names[variable])
+		if nameElem.attr("form") != "count" {
+			if label := e.child("label"); label != nil && !ctx.sorting {
+				o = concat(o, ctx.formatting(label, ctx.label(label, variable)))
+			}
+		}
+		parts = append(parts, o)
+	}
+	if len(parts) > 0 {
+		return join(parts, ctx.inheritedAttr(e, "names-delimiter", "delimiter"))
+	}
+	if sub := e.child("substitute"); sub != nil {
+		for _, c := range sub.Children {
+			var o output
+			if c.XMLName.Local == "names" && len(c.Children) == 0 {
+				// A bare cs:names inherits the name options of its parent.
+				inherit := element{XMLName: c.XMLName, Attrs: c.Attrs}
+				for _, child := range e.Children {
+					if child.XMLName.Local != "substitute" {
+						inherit.Children = append(inherit.Children, child)
+					}
+				}
+				o = ctx.formatting(c, ctx.names(&inherit, strings.Fields(c.attr("variable"))))
+			} else {
+				o = ctx.element(c)
+			}
+			if !o.empty() {
+				ctx.suppressSubstitute(c)
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+// suppressSubstitute suppresses the variables used by a substitute element
+// for the rest of the item, as required by the specification.
+func (ctx *context) suppressSubstitute(e *element) {
+	e.walk(func(c *element) {
+		for _, v := range strings.Fields(c.attr("variable")) {
+			ctx.suppressed[v] = true
+		}
+	})
+}
+
+// inheritedAttr returns attribute name of e, or the inheritable attribute
+// from the citation/bibliography or style element.
+func (ctx *context) inheritedAttr(e *element, inheritable, name string) string {
+	if e.hasAttr(name) {
+		return e.attr(name)
+	}
+	if ctx.mode.hasAttr(inheritable) {
+		return ctx.mode.attr(inheritable)
+	}
+	if ctx.p.style.root.hasAttr(inheritable) {
+		return ctx.p.style.root.attr(inheritable)
+	}
+	if name == "delimiter" {
+		return ", "
+	}
+	return ""
+}
+
+// nameOption returns a name option of the cs:name element, inherited from
+// the citation/bibliography and style elements.
+func (ctx *context) nameOption(e *element, name string) string {
+	if ctx.sorting && ctx.sortKey != nil {
+		switch name {
+		case "et-al-min", "et-al-subsequent-min":
+			if v := ctx.sortKey.attr("names-min"); v != "" {
+				return v
+			}
+		case "et-al-use-first", "et-al-subsequent-use-first":
+			if v := ctx.sortKey.attr("names-use-first"); v != "" {
+				return v
+			}
+		}
+	}
+	if e.hasAttr(name) {
+		return e.attr(name)
+	}
+	return ctx.p.inherited(ctx.mode, name)
+}
+
+// nameList renders a list of names with et-al abbreviation.
+func (ctx *context) nameList(e, etAl *element, names []bibtex.Name) output {
+	etAlMin, _ := strconv.Atoi(ctx.nameOption(e, "et-al-min"))
+	useFirst, _ := strconv.Atoi(ctx.nameOption(e, "et-al-use-first"))
+	if ctx.sorting && ctx.sortKey.attr("names-min") == "" {
+		etAlMin = 0 // Sort keys use all names unless limited explicitly.
+	}
+	if ctx.item.etAlUseFirst > useFirst {
+		useFirst = ctx.item.etAlUseFirst
+	}
+
+	truncated := false
+	if n := len(names); n > 0 && names[n-1].IsOthers() {
+		names, truncated = names[:n-1], true
+	}
+	if etAlMin > 0 && useFirst > 0 && len(names) >= etAlMin && useFirst < len(names) {
+		names, truncated = names[:useFirst], true
+	}
+	if e.attr("form") == "count" {
+		return output{}.plain(strconv.Itoa(len(names)))
+	}
+
+	var rendered []output
+	for i, n := range names {
+		rendered = append(rendered, ctx.name(e, n, i))
+	}
+	delimiter := ctx.inheritedAttr(e, "name-delimiter", "delimiter")
+
+	var o output
+	for i, r := range rendered {
+		if i > 0 {
+			last := i == len(rendered)-1 && !truncated
+			if last && ctx.nameOption(e, "and") != "" {
+				if precedes(ctx.nameOption(e, "delimiter-precedes-last"), len(rendered) > 2, ctx.nameOption(e, "name-as-sort-order") != "") {
+					o = o.plain(delimiter)
+				} else {
+					o = o.plain(" ")
+				}
+				o = o.plain(ctx.and(e) + " ")
+			} else {
+				o = o.plain(delimiter)
+			}
+		}
+		o = append(o, r...)
+	}
+	if truncated && len(rendered) > 0 && !ctx.sorting {
+		term := "et-al"
+		if etAl != nil && etAl.attr("term") != "" {
+			term = etAl.attr("term")
+		}
+		if precedes(ctx.nameOption(e, "delimiter-precedes-et-al"), len(rendered) > 1, ctx.nameOption(e, "name-as-sort-order") != "") {
+			o = o.plain(delimiter)
+		} else {
+			o = o.plain(" ")
+		}
+		etAlText := output{}.plain(ctx.term(term, "long", false))
+		if etAl != nil {
+			etAlText = ctx.formatting(etAl, etAlText)
+		}
+		o = append(o, etAlText...)
+	}
+	return o
+}
+
+// precedes decides whether the delimiter precedes the last name (or et al.)
+// for a delimiter-precedes-last/et-al value; contextual is the result of
+// the default "contextual" rule.
+func precedes(rule string, contextual, inverted bool) bool {
+	switch rule {
+	case "always":
+		return true
+	case "never":
+		return false
+	case "after-inverted-name":
+		return inverted
+	}
+	return contextual
+}
+
+// and returns the word or symbol joining the last two names.
+func (ctx *context) and(e *element) string {
+	if ctx.nameOption(e, "and") == "symbol" {
+		return "&"
+	}
+	return ctx.term("and", "long", false)
+}
+
+// name renders the i-th name of a list.
+func (ctx *context) name(e *element, n bibtex.Name, i int) output {
+	family := strings.TrimSpace(n.Von + " " + n.Last)
+	given := n.First
+	if init := ctx.nameOption(e, "initialize-with"); init != "" && ctx.nameOption(e, "initialize") != "false" && !ctx.sorting {
+		given = initialize(given, init)
+	}
+	var familyOut, givenOut output
+	familyOut = output{}.plain(family)
+	givenOut = output{}.plain(given)
+	for _, part := range e.Children {
+		if part.XMLName.Local != "name-part" {
+			continue
+		}
+		switch part.attr("name") {
+		case "family":
+			familyOut = ctx.formatting(part, familyOut)
+		case "given":
+			givenOut = ctx.formatting(part, givenOut)
+		}
+	}
+
+	if n.First == "" {
+		return familyOut
+	}
+	form := e.attr("form")
+	if form == "short" && !ctx.item.givenName && !ctx.sorting {
+		return familyOut
+	}
+	order := ctx.nameOption(e, "name-as-sort-order")
+	if ctx.sorting || order == "all" || (order == "first" && i == 0) {
+		sep := ctx.nameOption(e, "sort-separator")
+		if sep == "" {
+			sep = ", "
+		}
+		o := append(append(familyOut, output{}.plain(sep)...), givenOut...)
+		if n.Jr != "" {
+			o = o.plain(sep + n.Jr)
+		}
+		return o
+	}
+	o := append(append(givenOut, output{}.plain(" ")...), familyOut...)
+	if n.Jr != "" {
+		o = o.plain(" " + n.Jr)
+	}
+	return o
+}
+
+// initialize abbreviates given names with the initialize-with string, e.g.
+// "Donald Ervin" with ". " becomes "D. E."
+func initialize(given, with string) string {
+	var parts []string
+	for _, word := range strings.Fields(given) {
+		var hyphenated []string
+		for _, part := range strings.Split(word, "-") {
+			rs := []rune(part)
+			if len(rs) == 0 {
+				continue
+			}
+			if unicode.IsUpper(rs[0]) {
+				hyphenated = append(hyphenated, strings.TrimSpace(string(rs[0])+with))
+			} else {
+				hyphenated = append(hyphenated, part)
+			}
+		}
+		parts = append(parts, strings.Join(hyphenated, "-"))
+	}
+	if strings.HasSuffix(with, " ") {
+		return strings.Join(parts, " ")
+	}
+	return strings.Join(parts, "")
+}
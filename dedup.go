@@ -0,0 +1,341 @@
+package bibtex
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DuplicateGroup is a set of entries that are probably the same work.
+type DuplicateGroup struct {
+	Entries    []*BibEntry // In bibliography order.
+	Confidence float64     // From 0 to 1, for the weakest link in the group.
+}
+
+// Confidence of the different kinds of matches of FindDuplicates.
+const (
+	doiConfidence        = 1.0
+	identifierConfidence = 0.95 // ISBN or arXiv ID.
+	fuzzyConfidence      = 0.9  // Same first author and year, times title similarity.
+	minTitleSimilarity   = 0.85
+)
+
+// FindDuplicates groups the entries of bib that are probably the same work,
+// regardless of their cite keys.
+//
+// Entries match if they have the same normalized DOI, ISBN (of books) or
+// arXiv ID, or if they have the same first author surname and year and
+// similar titles. Entries without an author match only by identifier.
+// Entries with different DOIs are never grouped. Groups are
+// returned in the order of their first entries.
+func FindDuplicates(bib *BibTex) []DuplicateGroup {
+	type link struct {
+		i, j       int
+		confidence float64
+	}
+	var links []link
+	keys := make([]dedupKey, len(bib.Entries))
+	for i, entry := range bib.Entries {
+		keys[i] = newDedupKey(entry)
+	}
+
+	byID := make(map[string][]int)
+	byAuthor := make(map[string][]int)
+	for i, k := range keys {
+		for _, id := range k.ids() {
+			byID[id] = append(byID[id], i)
+		}
+		byAuthor[k.surname] = append(byAuthor[k.surname], i)
+	}
+	best := make(map[[2]int]float64)
+	for id, idx := range byID {
+		confidence := identifierConfidence
+		if strings.HasPrefix(id, "doi:") {
+			confidence = doiConfidence
+		}
+		for a := 0; a < len(idx); a++ {
+			for b := a + 1; b < len(idx); b++ {
+				pair := [2]int{idx[a], idx[b]}
+				best[pair] = max(best[pair], confidence)
+			}
+		}
+	}
+	for surname, idx := range byAuthor {
+		if surname == "" {
+			continue // Entries without authors match only by identifier.
+		}
+		for a := 0; a < len(idx); a++ {
+			for b := a + 1; b < len(idx); b++ {
+				ka, kb := keys[idx[a]], keys[idx[b]]
+				if ka.year != kb.year || ka.title == "" {
+					continue
+				}
+				if sim := similarity(ka.title, kb.title); sim >= minTitleSimilarity {
+					pair := [2]int{idx[a], idx[b]}
+					best[pair] = max(best[pair], fuzzyConfidence*sim)
+				}
+			}
+		}
+	}
+	for pair, confidence := range best {
+		links = append(links, link{i: pair[0], j: pair[1], confidence: confidence})
+	}
+	// Join the strongest links first, so the confidence of a group is that
+	// of the weakest link needed to connect it.
+	sort.Slice(links, func(a, b int) bool {
+		if links[a].confidence != links[b].confidence {
+			return links[a].confidence > links[b].confidence
+		}
+		if links[a].i != links[b].i {
+			return links[a].i < links[b].i
+		}
+		return links[a].j < links[b].j
+	})
+	parent := make([]int, len(bib.Entries))
+	confidence := make([]float64, len(bib.Entries))
+	doi := make([]string, len(bib.Entries)) // DOI of the group, if any.
+	for i := range parent {
+		parent[i] = i
+		confidence[i] = 1
+		doi[i] = keys[i].doi
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for _, l := range links {
+		ri, rj := find(l.i), find(l.j)
+		if ri == rj || doi[ri] != "" && doi[rj] != "" && doi[ri] != doi[rj] {
+			continue
+		}
+		if rj < ri {
+			ri, rj = rj, ri
+		}
+		parent[rj] = ri
+		confidence[ri] = min(confidence[ri], confidence[rj], l.confidence)
+		if doi[ri] == "" {
+			doi[ri] = doi[rj]
+		}
+	}
+
+	var groups []DuplicateGroup
+	index := make(map[int]int)
+	for i, entry := range bib.Entries {
+		root := find(i)
+		if root == i {
+			continue
+		}
+		g, ok := index[root]
+		if !ok {
+			g = len(groups)
+			index[root] = g
+			groups = append(groups, DuplicateGroup{
+				Entries:    []*BibEntry{bib.Entries[root]},
+				Confidence: confidence[root],
+			})
+		}
+		groups[g].Entries = append(groups[g].Entries, entry)
+	}
+	return groups
+}
+
+// dedupKey holds the normalized values of an entry compared by
+// FindDuplicates.
+type dedupKey struct {
+	doi, isbn, arxiv string
+	surname, year    string
+	title            string
+}
+
+var (
+	doiPrefix     = regexp.MustCompile(`^(?i)(https?://(dx\.)?doi\.org/|doi:\s*)`)
+	arxivURL      = regexp.MustCompile(`(?i)arxiv\.org/(abs|pdf)/([^\s?#]+?)(\.pdf)?$`)
+	arxivVersion  = regexp.MustCompile(`v\d+$`)
+	arxivIdentity = regexp.MustCompile(`^(\d{4}\.\d{4,5}|[a-z-]+(\.[a-z]{2})?/\d{7})$`)
+)
+
+func newDedupKey(entry *BibEntry) dedupKey {
+	var k dedupKey
+	if doi, _ := foldedField(entry, "doi"); doi != "" {
+		k.doi = strings.ToLower(doiPrefix.ReplaceAllString(strings.TrimSpace(doi), ""))
+	}
+	switch entry.Type {
+	case "book", "mvbook", "booklet", "manual", "proceedings", "mvproceedings", "thesis", "phdthesis", "mastersthesis", "techreport", "report":
+		isbn, _ := foldedField(entry, "isbn")
+		k.isbn, _ = isbn13(isbn)
+	}
+	k.arxiv = arxivID(entry)
+	if authors, ok := foldedField(entry, "author"); ok {
+		k.surname = firstSurname(authors)
+	} else if editors, ok := foldedField(entry, "editor"); ok {
+		k.surname = firstSurname(editors)
+	}
+	k.year, _ = queryField(entry, "year")
+	title, _ := foldedField(entry, "title")
+	k.title = normalizeTitle(title)
+	return k
+}
+
+// ids returns the identifiers of k, prefixed by their kind.
+func (k dedupKey) ids() []string {
+	var ids []string
+	if k.doi != "" {
+		ids = append(ids, "doi:"+k.doi)
+	}
+	if k.isbn != "" {
+		ids = append(ids, "isbn:"+k.isbn)
+	}
+	if k.arxiv != "" {
+		ids = append(ids, "arxiv:"+k.arxiv)
+	}
+	return ids
+}
+
+// arxivID returns the arXiv identifier of entry without its version, or "".
+func arxivID(entry *BibEntry) string {
+	var id string
+	eprintType, _ := foldedField(entry, "eprinttype")
+	archive, _ := foldedField(entry, "archiveprefix")
+	if eprint, ok := foldedField(entry, "eprint"); ok {
+		if strings.EqualFold(eprintType, "arxiv") || strings.EqualFold(archive, "arxiv") {
+			id = eprint
+		}
+	}
+	if url, ok := foldedField(entry, "url"); ok && id == "" {
+		if m := arxivURL.FindStringSubmatch(strings.TrimSpace(url)); m != nil {
+			id = m[2]
+		}
+	}
+	id = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(id)), "arxiv:")
+	id = arxivVersion.ReplaceAllString(id, "")
+	if !arxivIdentity.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+// firstSurname returns the normalized last name of the first name of a
+// name list.
+func firstSurname(names string) string {
+	parsed := ParseNames(names)
+	if len(parsed) == 0 {
+		return ""
+	}
+	return normalizeTitle(parsed[0].Last)
+}
+
+// normalizeTitle folds s to lowercase ASCII letters and digits separated by
+// single spaces.
+func normalizeTitle(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(ASCIIFold(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// similarity returns 1 minus the edit distance between a and b relative to
+// the longer of the two.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// titleFields are the fields that Merge compares as titles.
+var titleFields = map[string]bool{
+	"title": true, "subtitle": true, "titleaddon": true,
+	"booktitle": true, "maintitle": true, "shorttitle": true,
+}
+
+// equalFieldValues reports whether a and b are the same value of the field name.
+func equalFieldValues(name, a, b string) bool {
+	if titleFields[strings.ToLower(name)] {
+		return normalizeTitle(a) == normalizeTitle(b)
+	}
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// MergePolicy decides which value Merge keeps when two entries have
+// different values for the same field.
+type MergePolicy int
+
+const (
+	// PreferLonger keeps the longer of the two values.
+	PreferLonger MergePolicy = iota
+	// PreferFirst keeps the value of the first entry.
+	PreferFirst
+	// KeepBoth keeps the value of the first entry and records the value of
+	// the second entry in the note field.
+	KeepBoth
+)
+
+// Merge combines the fields of a and b into a new entry with the type and
+// cite key of a. Fields present in only one entry are copied; field names
+// are matched case-insensitively and values are compared ignoring case and
+// spacing, and for titles also punctuation and accents. Conflicting values
+// are resolved by policy.
+func Merge(a, b *BibEntry, policy MergePolicy) *BibEntry {
+	merged := &BibEntry{Type: a.Type, CiteName: a.CiteName, Fields: map[string]BibString{}}
+	names := make(map[string]string) // Lowercase name -> name in merged.
+	for name, value := range a.Fields {
+		merged.Fields[name] = value
+		names[strings.ToLower(name)] = name
+	}
+	var notes []string
+	bNames := make([]string, 0, len(b.Fields))
+	for name := range b.Fields {
+		bNames = append(bNames, name)
+	}
+	sort.Strings(bNames)
+	for _, name := range bNames {
+		value := b.Fields[name]
+		existing, ok := names[strings.ToLower(name)]
+		if !ok {
+			merged.Fields[name] = value
+			names[strings.ToLower(name)] = name
+			continue
+		}
+		old := merged.Fields[existing]
+		if equalFieldValues(name, old.String(), value.String()) {
+			continue
+		}
+		switch policy {
+		case PreferLonger:
+			if len(value.String()) > len(old.String()) {
+				merged.Fields[existing] = value
+			}
+		case KeepBoth:
+			notes = append(notes, strings.ToLower(name)+": "+value.String())
+		}
+	}
+	if len(notes) > 0 {
+		note := strings.Join(notes, "; ")
+		if existing, ok := names["note"]; ok {
+			merged.Fields[existing] = NewBibConst(merged.Fields[existing].String() + "; " + note)
+		} else {
+			merged.Fields["note"] = NewBibConst(note)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,249 @@
+package bibtex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BibDiff is the semantic difference between two bibliographies, as
+// returned by Diff.
+type BibDiff struct {
+	Added   []EntryDiff   `json:"added,omitempty"`   // Entries only in the new bibliography.
+	Removed []EntryDiff   `json:"removed,omitempty"` // Entries only in the old bibliography.
+	Changed []EntryDiff   `json:"changed,omitempty"` // Renamed or modified entries.
+	Strings []FieldChange `json:"strings,omitempty"` // Changed @string macros.
+}
+
+// EntryDiff is the difference between two versions of an entry. OldKey is
+// empty for added entries and NewKey is empty for removed entries.
+type EntryDiff struct {
+	OldKey  string        `json:"old_key,omitempty"`
+	NewKey  string        `json:"new_key,omitempty"`
+	OldType string        `json:"old_type,omitempty"`
+	NewType string        `json:"new_type,omitempty"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+}
+
+// Renamed returns true if the cite key of the entry changed.
+func (d EntryDiff) Renamed() bool {
+	return d.OldKey != "" && d.NewKey != "" && d.OldKey != d.NewKey
+}
+
+// FieldChange is a changed field (or @string macro). Old is nil for added
+// fields and New is nil for removed fields, so that they are distinct from
+// changes from or to an empty value.
+type FieldChange struct {
+	Name string  `json:"name"`
+	Old  *string `json:"old,omitempty"`
+	New  *string `json:"new,omitempty"`
+}
+
+// Diff compares two bibliographies.
+//
+// Entries are paired by cite key. Unpaired entries with the same DOI, or the
+// same year and a similar title, are reported as renamed. Field names are
+// compared case-insensitively and values are compared with @string macros
+// expanded and whitespace collapsed, so reordering or rewrapping fields or
+// entries is not a change.
+func Diff(old, new *BibTex) *BibDiff {
+	d := &BibDiff{}
+	oldByKey := make(map[string]*BibEntry, len(old.Entries))
+	for _, entry := range old.Entries {
+		if _, ok := oldByKey[entry.CiteName]; !ok {
+			oldByKey[entry.CiteName] = entry
+		}
+	}
+	newByKey := make(map[string]*BibEntry, len(new.Entries))
+	for _, entry := range new.Entries {
+		if _, ok := newByKey[entry.CiteName]; !ok {
+			newByKey[entry.CiteName] = entry
+		}
+	}
+
+	var removed, added []*BibEntry
+	for _, entry := range old.Entries {
+		if oldByKey[entry.CiteName] == entry && newByKey[entry.CiteName] == nil {
+			removed = append(removed, entry)
+		}
+	}
+	for _, entry := range new.Entries {
+		if newByKey[entry.CiteName] == entry && oldByKey[entry.CiteName] == nil {
+			added = append(added, entry)
+		}
+	}
+	renamed := pairRenamed(removed, added)
+
+	for _, entry := range new.Entries {
+		if newByKey[entry.CiteName] != entry {
+			continue
+		}
+		oldEntry := oldByKey[entry.CiteName]
+		if oldEntry == nil {
+			oldEntry = renamed[entry]
+		}
+		if oldEntry == nil {
+			d.Added = append(d.Added, diffEntries(nil, entry))
+		} else if ed := diffEntries(oldEntry, entry); ed.Renamed() || ed.OldType != ed.NewType || len(ed.Fields) > 0 {
+			d.Changed = append(d.Changed, ed)
+		}
+	}
+	renamedFrom := make(map[*BibEntry]bool, len(renamed))
+	for _, oldEntry := range renamed {
+		renamedFrom[oldEntry] = true
+	}
+	for _, entry := range removed {
+		if !renamedFrom[entry] {
+			d.Removed = append(d.Removed, diffEntries(entry, nil))
+		}
+	}
+	d.Strings = diffFields(stringVarFields(old), stringVarFields(new))
+	return d
+}
+
+// pairRenamed pairs removed and added entries that are probably the same
+// work, and returns a map from added to removed entry.
+func pairRenamed(removed, added []*BibEntry) map[*BibEntry]*BibEntry {
+	renamed := make(map[*BibEntry]*BibEntry)
+	if len(removed) == 0 || len(added) == 0 {
+		return renamed
+	}
+	removedKeys := make([]dedupKey, len(removed))
+	for i, entry := range removed {
+		removedKeys[i] = newDedupKey(entry)
+	}
+	used := make([]bool, len(removed))
+	for _, entry := range added {
+		k := newDedupKey(entry)
+		best, bestScore := -1, 0.0
+		for i, rk := range removedKeys {
+			if used[i] {
+				continue
+			}
+			score := 0.0
+			switch {
+			case k.doi != "" && k.doi == rk.doi:
+				score = 2
+			case k.doi != "" && rk.doi != "" || k.year != rk.year || k.title == "":
+			default:
+				if sim := similarity(k.title, rk.title); sim >= minTitleSimilarity {
+					score = sim
+				}
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best >= 0 {
+			used[best] = true
+			renamed[entry] = removed[best]
+		}
+	}
+	return renamed
+}
+
+// diffEntries compares two versions of an entry, either of which may be nil.
+func diffEntries(old, new *BibEntry) EntryDiff {
+	var d EntryDiff
+	var oldFields, newFields map[string]string
+	if old != nil {
+		d.OldKey, d.OldType = old.CiteName, old.Type
+		oldFields = entryFields(old)
+	}
+	if new != nil {
+		d.NewKey, d.NewType = new.CiteName, new.Type
+		newFields = entryFields(new)
+	}
+	d.Fields = diffFields(oldFields, newFields)
+	return d
+}
+
+// entryFields returns the field values of entry by lowercase name, with
+// runs of whitespace collapsed.
+func entryFields(entry *BibEntry) map[string]string {
+	fields := make(map[string]string, len(entry.Fields))
+	for name, value := range entry.Fields {
+		fields[strings.ToLower(name)] = strings.Join(strings.Fields(value.String()), " ")
+	}
+	return fields
+}
+
+func stringVarFields(bib *BibTex) map[string]string {
+	fields := make(map[string]string, len(bib.StringVar))
+	for key, v := range bib.StringVar {
+		if bib.isImplicitVar(key, v) {
+			continue
+		}
+		fields[key] = v.String()
+	}
+	return fields
+}
+
+// diffFields returns the changes from old to new, sorted by name.
+func diffFields(old, new map[string]string) []FieldChange {
+	var changes []FieldChange
+	for name, value := range old {
+		if newValue, ok := new[name]; !ok {
+			changes = append(changes, FieldChange{Name: name, Old: &value})
+		} else if newValue != value {
+			changes = append(changes, FieldChange{Name: name, Old: &value, New: &newValue})
+		}
+	}
+	for name, value := range new {
+		if _, ok := old[name]; !ok {
+			changes = append(changes, FieldChange{Name: name, New: &value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// Empty returns true if there are no differences.
+func (d *BibDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Strings) == 0
+}
+
+// String returns a human-readable summary of the differences, with one
+// line per added (+), removed (-) or changed (~) entry followed by its
+// changed fields.
+func (d *BibDiff) String() string {
+	var buf strings.Builder
+	for _, c := range d.Strings {
+		writeChange(&buf, "", fmt.Sprintf("@string{%s}", c.Name), c)
+	}
+	for _, ed := range d.Removed {
+		fmt.Fprintf(&buf, "- @%s{%s}\n", ed.OldType, ed.OldKey)
+		writeFieldChanges(&buf, ed.Fields)
+	}
+	for _, ed := range d.Added {
+		fmt.Fprintf(&buf, "+ @%s{%s}\n", ed.NewType, ed.NewKey)
+		writeFieldChanges(&buf, ed.Fields)
+	}
+	for _, ed := range d.Changed {
+		typ, key := ed.NewType, ed.NewKey
+		if ed.OldType != ed.NewType {
+			typ = ed.OldType + " -> @" + ed.NewType
+		}
+		if ed.Renamed() {
+			key = ed.OldKey + " -> " + ed.NewKey
+		}
+		fmt.Fprintf(&buf, "~ @%s{%s}\n", typ, key)
+		writeFieldChanges(&buf, ed.Fields)
+	}
+	return buf.String()
+}
+
+func writeFieldChanges(buf *strings.Builder, changes []FieldChange) {
+	for _, c := range changes {
+		writeChange(buf, "    ", c.Name, c)
+	}
+}
+
+func writeChange(buf *strings.Builder, indent, name string, c FieldChange) {
+	if c.Old != nil {
+		fmt.Fprintf(buf, "%s- %s = {%s}\n", indent, name, *c.Old)
+	}
+	if c.New != nil {
+		fmt.Fprintf(buf, "%s+ %s = {%s}\n", indent, name, *c.New)
+	}
+}
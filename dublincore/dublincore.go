@@ -0,0 +1,222 @@
+// Package dublincore converts BibTeX entries to simple (unqualified) Dublin
+// Core records in the OAI-PMH oai_dc XML format.
+//
+// See https://www.openarchives.org/OAI/openarchivesprotocol.html#dublincore
+// for the oai_dc schema.
+package dublincore // import "github.com/nickng/bibtex/dublincore"
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/nickng/bibtex"
+)
+
+const (
+	// NamespaceOAIDC is the oai_dc container namespace.
+	NamespaceOAIDC = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	// NamespaceDC is the Dublin Core elements 1.1 namespace.
+	NamespaceDC = "http://purl.org/dc/elements/1.1/"
+	// SchemaLocation is the location of the oai_dc XML schema.
+	SchemaLocation = NamespaceOAIDC + " http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+
+	namespaceXSI = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// Record is an oai_dc:dc record holding the fifteen Dublin Core elements.
+// Every element is optional and repeatable.
+type Record struct {
+	XMLName        xml.Name `xml:"oai_dc:dc"`
+	OAIDC          string   `xml:"xmlns:oai_dc,attr"`
+	DC             string   `xml:"xmlns:dc,attr"`
+	XSI            string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+
+	Title       []string `xml:"dc:title"`
+	Creator     []string `xml:"dc:creator"`
+	Subject     []string `xml:"dc:subject"`
+	Description []string `xml:"dc:description"`
+	Publisher   []string `xml:"dc:publisher"`
+	Contributor []string `xml:"dc:contributor"`
+	Date        []string `xml:"dc:date"`
+	Type        []string `xml:"dc:type"`
+	Format      []string `xml:"dc:format"`
+	Identifier  []string `xml:"dc:identifier"`
+	Source      []string `xml:"dc:source"`
+	Language    []string `xml:"dc:language"`
+	Relation    []string `xml:"dc:relation"`
+	Coverage    []string `xml:"dc:coverage"`
+	Rights      []string `xml:"dc:rights"`
+}
+
+// Collection is a sequence of records wrapped in a plain root element, since
+// oai_dc defines no container of its own.
+type Collection struct {
+	XMLName xml.Name  `xml:"records"`
+	Records []*Record `xml:"oai_dc:dc"`
+}
+
+// dcmiTypes maps entry types to the DCMI Type Vocabulary.
+var dcmiTypes = map[string]string{
+	"software": "Software",
+	"dataset":  "Dataset",
+	"online":   "InteractiveResource",
+	"image":    "StillImage",
+	"audio":    "Sound",
+	"video":    "MovingImage",
+}
+
+// FromEntry converts a single BibTeX entry into a Dublin Core record.
+func FromEntry(entry *bibtex.BibEntry) *Record {
+	f := make(map[string]string, len(entry.Fields))
+	for key, val := range entry.Fields {
+		f[strings.ToLower(key)] = bibtex.DecodeTeX(val.String())
+	}
+
+	r := &Record{
+		OAIDC:          NamespaceOAIDC,
+		DC:             NamespaceDC,
+		XSI:            namespaceXSI,
+		SchemaLocation: SchemaLocation,
+	}
+	if title := f["title"]; title != "" {
+		if f["subtitle"] != "" {
+			title += ": " + f["subtitle"]
+		}
+		r.Title = append(r.Title, title)
+	}
+	r.Creator = names(entry, "author")
+	r.Contributor = append(names(entry, "editor"), names(entry, "translator")...)
+
+	for _, key := range []string{"publisher", "institution", "school", "organization"} {
+		if f[key] != "" {
+			r.Publisher = append(r.Publisher, f[key])
+		}
+	}
+	if f["date"] != "" {
+		r.Date = append(r.Date, f["date"])
+	} else if f["year"] != "" {
+		r.Date = append(r.Date, f["year"])
+	}
+
+	if typ, ok := dcmiTypes[entry.Type]; ok {
+		r.Type = append(r.Type, typ)
+	} else {
+		r.Type = append(r.Type, "Text")
+	}
+	r.Type = append(r.Type, entry.Type)
+
+	if doi := f["doi"]; doi != "" {
+		r.Identifier = append(r.Identifier, "https://doi.org/"+strings.TrimPrefix(doi, "https://doi.org/"))
+	}
+	if f["isbn"] != "" {
+		r.Identifier = append(r.Identifier, "urn:isbn:"+f["isbn"])
+	}
+	if f["issn"] != "" {
+		r.Identifier = append(r.Identifier, "urn:issn:"+f["issn"])
+	}
+	if f["eprint"] != "" && strings.EqualFold(f["eprinttype"], "arxiv") {
+		r.Identifier = append(r.Identifier, "arXiv:"+f["eprint"])
+	}
+	if f["url"] != "" {
+		r.Identifier = append(r.Identifier, f["url"])
+	}
+
+	if source := source(f); source != "" {
+		r.Source = append(r.Source, source)
+	}
+	for _, kw := range strings.Split(f["keywords"], ",") {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			r.Subject = append(r.Subject, kw)
+		}
+	}
+	if f["abstract"] != "" {
+		r.Description = append(r.Description, f["abstract"])
+	}
+	if f["note"] != "" {
+		r.Description = append(r.Description, f["note"])
+	}
+	if lang := f["language"]; lang != "" {
+		r.Language = append(r.Language, lang)
+	} else if f["langid"] != "" {
+		r.Language = append(r.Language, f["langid"])
+	}
+	if f["series"] != "" {
+		r.Relation = append(r.Relation, f["series"])
+	}
+	return r
+}
+
+// FromBibTex converts all entries of bib into Dublin Core records.
+func FromBibTex(bib *bibtex.BibTex) *Collection {
+	c := &Collection{}
+	for _, entry := range bib.Entries {
+		c.Records = append(c.Records, FromEntry(entry))
+	}
+	return c
+}
+
+// Encode writes the entries of bib as indented Dublin Core records to w.
+func Encode(w io.Writer, bib *bibtex.BibTex) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(FromBibTex(bib)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// names formats the name list in field as "Last, First" strings.
+func names(entry *bibtex.BibEntry, field string) []string {
+	val, ok := entry.Fields[field]
+	if !ok {
+		return nil
+	}
+	var result []string
+	for _, n := range bibtex.ParseNames(val.String()) {
+		if n.IsOthers() {
+			continue
+		}
+		name := strings.TrimSpace(n.Von + " " + n.Last)
+		if n.Jr != "" {
+			name += ", " + n.Jr
+		}
+		if n.First != "" {
+			name += ", " + n.First
+		}
+		result = append(result, bibtex.DecodeTeX(name))
+	}
+	return result
+}
+
+// source builds a bibliographic citation of the containing resource, e.g.
+// "Journal of Things 12(3): 45–67".
+func source(f map[string]string) string {
+	container := f["journaltitle"]
+	if container == "" {
+		container = f["journal"]
+	}
+	if container == "" {
+		container = f["booktitle"]
+	}
+	if container == "" {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteString(container)
+	if f["volume"] != "" {
+		buf.WriteString(" " + f["volume"])
+	}
+	if issue := f["number"]; issue != "" && f["booktitle"] == "" {
+		buf.WriteString("(" + issue + ")")
+	}
+	if f["pages"] != "" {
+		buf.WriteString(": " + f["pages"])
+	}
+	return buf.String()
+}
@@ -0,0 +1,69 @@
+package dublincore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nickng/bibtex"
+)
+
+// Tests that the whole example corpus encodes to well-formed XML.
+func TestEncodeExamples(t *testing.T) {
+	b, err := os.ReadFile("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib, err := bibtex.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, bib); err != nil {
+		t.Fatal(err)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	records := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Space == NamespaceOAIDC && se.Name.Local == "dc" {
+			records++
+		}
+	}
+	if want, got := len(bib.Entries), records; want != got {
+		t.Errorf("Expecting %d records but got %d", want, got)
+	}
+}
+
+func TestFromEntry(t *testing.T) {
+	entry := bibtex.NewBibEntry("article", "a")
+	entry.AddField("author", bibtex.NewBibConst(`G{\"o}del, Kurt and others`))
+	entry.AddField("title", bibtex.NewBibConst("On Formally Undecidable Propositions"))
+	entry.AddField("journal", bibtex.NewBibConst("Monatshefte"))
+	entry.AddField("volume", bibtex.NewBibConst("38"))
+	entry.AddField("year", bibtex.NewBibConst("1931"))
+	entry.AddField("doi", bibtex.NewBibConst("10.1007/BF01700692"))
+	r := FromEntry(entry)
+
+	if len(r.Creator) != 1 || r.Creator[0] != "Gödel, Kurt" {
+		t.Errorf("Unexpected creators %q", r.Creator)
+	}
+	if len(r.Identifier) != 1 || r.Identifier[0] != "https://doi.org/10.1007/BF01700692" {
+		t.Errorf("Unexpected identifiers %q", r.Identifier)
+	}
+	out, err := xml.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "<dc:date>1931</dc:date>") {
+		t.Errorf("Missing dc:date in %s", out)
+	}
+}
@@ -0,0 +1,106 @@
+package bibtex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoder writes a BibTex as a .bib file.
+//
+// Unlike PrettyString, the output keeps @string definitions, preambles and
+// the use of string variables in field values, so that parsing the output
+// gives back an equivalent BibTex.
+type Encoder struct {
+	w      io.Writer
+	config prettyStringConfig
+}
+
+// NewEncoder returns an encoder that writes to w, formatting entries with
+// the given options.
+func NewEncoder(w io.Writer, options ...PrettyStringOpt) *Encoder {
+	config := defaultPrettyStringConfig
+	for _, option := range options {
+		option(&config)
+	}
+	config.format = rawFormat
+	return &Encoder{w: w, config: config}
+}
+
+// Encode writes the @string definitions (sorted by name), the preambles and
+// the entries of bib.
+func (e *Encoder) Encode(bib *BibTex) error {
+	var buf bytes.Buffer
+	keys := make([]string, 0, len(bib.StringVar))
+	for key, v := range bib.StringVar {
+		if bib.isImplicitVar(key, v) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "@string{%s = %s}\n", key, rawFormat(bib.StringVar[key].Value))
+	}
+	for _, preamble := range bib.Preambles {
+		fmt.Fprintf(&buf, "@preamble{%s}\n", formatWith(preamble, quotedFormat))
+	}
+	for _, entry := range bib.Entries {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		entry.prettyStringAppend(&buf, e.config)
+	}
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// isImplicitVar returns true if the string variable was added by a lookup
+// of a default variable (e.g. a month) rather than defined in the file.
+func (bib *BibTex) isImplicitVar(key string, v *BibVar) bool {
+	value, ok := bib.defaultVars[key]
+	return ok && v.Value.String() == value
+}
+
+// rawFormat formats a value as written in a .bib file, with string
+// variables by name.
+func rawFormat(s BibString) string {
+	return formatWith(s, bracedFormat)
+}
+
+// formatWith formats a value with string variables by name and constants
+// formatted by constFormat.
+func formatWith(s BibString, constFormat func(string) string) string {
+	switch s := s.(type) {
+	case BibConst:
+		return constFormat(string(s))
+	case *BibConst:
+		return constFormat(string(*s))
+	case *BibVar:
+		return s.Key
+	case *BibComposite:
+		parts := make([]string, len(*s))
+		for i, part := range *s {
+			parts[i] = formatWith(part, constFormat)
+		}
+		return strings.Join(parts, " # ")
+	}
+	return constFormat(s.String())
+}
+
+// bracedFormat formats a constant as a number or a braced string.
+func bracedFormat(v string) string {
+	if _, err := strconv.Atoi(v); err == nil {
+		return v
+	}
+	return "{" + v + "}"
+}
+
+// quotedFormat formats a constant as a quoted string, as required by
+// @preamble.
+func quotedFormat(v string) string {
+	return `"` + v + `"`
+}
@@ -10,6 +10,22 @@ var (
 	ErrUnexpectedAtsign = errors.New("unexpected @ sign")
 	// ErrUnknownStringVar is an error for looking up undefined string var.
 	ErrUnknownStringVar = errors.New("unknown string variable")
+	// ErrQuery is an error for a malformed query.
+	ErrQuery = errors.New("bad query")
+	// ErrKeyPattern is an error for a malformed cite key pattern.
+	ErrKeyPattern = errors.New("bad cite key pattern")
+	// ErrInvalidISBN is an error for an ISBN with a wrong length or checksum.
+	ErrInvalidISBN = errors.New("invalid ISBN")
+	// ErrDuplicateKey is an error for a cite key used by more than one entry.
+	ErrDuplicateKey = errors.New("duplicate cite key")
+	// ErrUnknownKey is an error for a cite key without entry.
+	ErrUnknownKey = errors.New("unknown cite key")
+	// ErrDuplicateField is an error for a field name used twice in an entry.
+	ErrDuplicateField = errors.New("duplicate field")
+	// ErrUnknownField is an error for a missing field.
+	ErrUnknownField = errors.New("unknown field")
+	// ErrLimit is an error for input exceeding a parse limit.
+	ErrLimit = errors.New("parse limit exceeded")
 )
 
 // ErrParse is a parse error.
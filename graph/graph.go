@@ -0,0 +1,183 @@
+// Package graph builds co-authorship and citation graphs of a bibliography
+// and writes them as GraphML, GEXF or Graphviz DOT.
+//
+// In a co-authorship graph, nodes are authors and an undirected edge joins
+// two authors with the number of entries they wrote together as its weight.
+// In a citation graph, nodes are entries and a directed edge goes from an
+// entry to each entry named by its crossref, xref or related fields.
+package graph // import "github.com/nickng/bibtex/graph"
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nickng/bibtex"
+)
+
+// Graph is a weighted graph.
+type Graph struct {
+	Name     string
+	Directed bool
+	Nodes    []Node // Sorted by ID.
+	Edges    []Edge // Sorted by source, then target.
+}
+
+// Node is a node of a graph. Weight is the number of entries of an author,
+// or 1 for an entry.
+type Node struct {
+	ID     string
+	Label  string
+	Weight int
+}
+
+// Edge is a weighted edge of a graph. The source of an undirected edge is
+// the smaller ID.
+type Edge struct {
+	Source string
+	Target string
+	Weight int
+}
+
+// ReferenceFields are the fields whose cite keys are edges of a citation
+// graph.
+var ReferenceFields = []string{"crossref", "xref", "related"}
+
+// CoAuthors returns the co-authorship graph of the authors of bib.
+//
+// Names are matched by a normalized form of the last name, von part and
+// first initial, ignoring accents and case, so that "Knuth, Donald E." and
+// "D. Knuth" are the same node. A node is labelled by the longest form of
+// the name in bib.
+func CoAuthors(bib *bibtex.BibTex) *Graph {
+	b := newBuilder("coauthors", false)
+	for _, entry := range bib.Entries {
+		var ids []string
+		seen := make(map[string]bool)
+		for _, name := range bibtex.ParseNames(fieldValue(entry, "author")) {
+			if name.IsOthers() {
+				continue
+			}
+			id := nameID(name)
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			b.node(id, displayName(name))
+			ids = append(ids, id)
+		}
+		for i := range ids {
+			for j := i + 1; j < len(ids); j++ {
+				b.edge(ids[i], ids[j])
+			}
+		}
+	}
+	return b.graph()
+}
+
+// Citations returns the citation graph of the entries of bib. Entries that
+// are referenced but missing from bib are nodes labelled by their keys.
+func Citations(bib *bibtex.BibTex) *Graph {
+	b := newBuilder("citations", true)
+	for _, entry := range bib.Entries {
+		label := bibtex.DecodeTeX(fieldValue(entry, "title"))
+		if label == "" {
+			label = entry.CiteName
+		}
+		b.labels[entry.CiteName] = label
+		b.weights[entry.CiteName] = 1
+	}
+	for _, entry := range bib.Entries {
+		for _, name := range ReferenceFields {
+			for _, key := range strings.Split(fieldValue(entry, name), ",") {
+				if key = strings.TrimSpace(key); key == "" || key == entry.CiteName {
+					continue
+				}
+				if _, ok := b.labels[key]; !ok {
+					b.labels[key] = key
+				}
+				b.edge(entry.CiteName, key)
+			}
+		}
+	}
+	return b.graph()
+}
+
+// fieldValue returns the value of a field, ignoring the case of its name.
+func fieldValue(entry *bibtex.BibEntry, name string) string {
+	for key, value := range entry.Fields {
+		if strings.EqualFold(key, name) {
+			return value.String()
+		}
+	}
+	return ""
+}
+
+// nameID returns the normalized form of a name: "von last f".
+func nameID(name bibtex.Name) string {
+	id := strings.ToLower(bibtex.ASCIIFold(strings.TrimSpace(name.Von + " " + name.Last)))
+	if first := strings.ToLower(bibtex.ASCIIFold(name.First)); first != "" {
+		id += " " + string([]rune(first)[:1])
+	}
+	return strings.Join(strings.Fields(id), " ")
+}
+
+// displayName returns a name as "First von Last, Jr", TeX decoded.
+func displayName(name bibtex.Name) string {
+	parts := []string{name.First, name.Von, name.Last}
+	s := bibtex.DecodeTeX(strings.Join(parts, " "))
+	if name.Jr != "" {
+		s += ", " + bibtex.DecodeTeX(name.Jr)
+	}
+	return s
+}
+
+// builder accumulates the nodes and edges of a graph.
+type builder struct {
+	name     string
+	directed bool
+	labels   map[string]string
+	weights  map[string]int
+	edges    map[[2]string]int
+}
+
+func newBuilder(name string, directed bool) *builder {
+	return &builder{
+		name:     name,
+		directed: directed,
+		labels:   make(map[string]string),
+		weights:  make(map[string]int),
+		edges:    make(map[[2]string]int),
+	}
+}
+
+// node adds a node, or increments its weight, keeping the longest label.
+func (b *builder) node(id, label string) {
+	if len([]rune(label)) > len([]rune(b.labels[id])) {
+		b.labels[id] = label
+	}
+	b.weights[id]++
+}
+
+// edge adds an edge, or increments its weight.
+func (b *builder) edge(source, target string) {
+	if !b.directed && target < source {
+		source, target = target, source
+	}
+	b.edges[[2]string{source, target}]++
+}
+
+func (b *builder) graph() *Graph {
+	g := &Graph{Name: b.name, Directed: b.directed}
+	for id, label := range b.labels {
+		g.Nodes = append(g.Nodes, Node{ID: id, Label: label, Weight: b.weights[id]})
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	for e, weight := range b.edges {
+		g.Edges = append(g.Edges, Edge{Source: e[0], Target: e[1], Weight: weight})
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		return a.Source < b.Source || a.Source == b.Source && a.Target < b.Target
+	})
+	return g
+}
@@ -0,0 +1,136 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nickng/bibtex"
+)
+
+const testBib = `
+@article{a, author = {Knuth, Donald E. and Lamport, Leslie}, title = {A}}
+@article{b, author = {D. Knuth and L. Lamport and G{\"o}del, Kurt}, title = {B}, crossref = {proc}}
+@inproceedings{c, author = {Kurt G\"{o}del and others}, title = {C}, crossref = {proc}, related = {a, missing}}
+@proceedings{proc, title = {Proceedings}}
+`
+
+func TestCoAuthors(t *testing.T) {
+	bib, err := bibtex.Parse(strings.NewReader(testBib))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := CoAuthors(bib)
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, fmt.Sprintf("%s=%s/%d", n.ID, n.Label, n.Weight))
+	}
+	if want, got := "godel k=Kurt Gödel/2 knuth d=Donald E. Knuth/2 lamport l=Leslie Lamport/2", strings.Join(nodes, " "); want != got {
+		t.Errorf("expected nodes %q but got %q", want, got)
+	}
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, fmt.Sprintf("%s-%s/%d", e.Source, e.Target, e.Weight))
+	}
+	if want, got := "godel k-knuth d/1 godel k-lamport l/1 knuth d-lamport l/2", strings.Join(edges, " "); want != got {
+		t.Errorf("expected edges %q but got %q", want, got)
+	}
+}
+
+func TestCoAuthorsNonLatin(t *testing.T) {
+	bib, err := bibtex.Parse(strings.NewReader(`@article{a, author = {Иванов, Иван and Иванов, Пётр}, title = {A}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := CoAuthors(bib)
+	var ids []string
+	for _, n := range g.Nodes {
+		if !utf8.ValidString(n.ID) {
+			t.Errorf("expected a valid UTF-8 ID but got %q", n.ID)
+		}
+		ids = append(ids, n.ID)
+	}
+	if want, got := "иванов и иванов п", strings.Join(ids, " "); want != got {
+		t.Errorf("expected nodes %q but got %q", want, got)
+	}
+	var buf bytes.Buffer
+	if err := g.WriteGraphML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.Valid(buf.Bytes()) {
+		t.Errorf("expected valid UTF-8 GraphML")
+	}
+}
+
+func TestCitations(t *testing.T) {
+	bib, err := bibtex.Parse(strings.NewReader(testBib))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := Citations(bib)
+	if !g.Directed {
+		t.Errorf("expected a directed graph")
+	}
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.Source+"->"+e.Target)
+	}
+	if want, got := "b->proc c->a c->missing c->proc", strings.Join(edges, " "); want != got {
+		t.Errorf("expected edges %q but got %q", want, got)
+	}
+	if want, got := 5, len(g.Nodes); want != got {
+		t.Errorf("expected %d nodes but got %d", want, got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	b, err := os.ReadFile("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib, err := bibtex.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := CoAuthors(bib)
+	for name, write := range map[string]func(io.Writer) error{"graphml": g.WriteGraphML, "gexf": g.WriteGEXF} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		nodes, edges := 0, 0
+		dec := xml.NewDecoder(&buf)
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: invalid XML: %v", name, err)
+			}
+			if se, ok := tok.(xml.StartElement); ok {
+				switch se.Name.Local {
+				case "node":
+					nodes++
+				case "edge":
+					edges++
+				}
+			}
+		}
+		if nodes != len(g.Nodes) || edges != len(g.Edges) {
+			t.Errorf("%s: expected %d nodes and %d edges but got %d and %d", name, len(g.Nodes), len(g.Edges), nodes, edges)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Citations(bib).WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), `digraph "citations" {`) || !strings.Contains(buf.String(), ` -> `) {
+		t.Errorf("expected a DOT digraph with edges but got\n%s", buf.String())
+	}
+}
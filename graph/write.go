@@ -0,0 +1,177 @@
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GraphMLNamespace is the GraphML XML namespace.
+	GraphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+	// GEXFNamespace is the GEXF 1.3 XML namespace.
+	GEXFNamespace = "http://gexf.net/1.3"
+)
+
+type graphML struct {
+	XMLName xml.Name     `xml:"http://graphml.graphdrawing.org/xmlns graphml"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// WriteGraphML writes g as GraphML, with label and weight attributes.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{Keys: []graphMLKey{
+		{ID: "label", For: "node", Name: "label", Type: "string"},
+		{ID: "nweight", For: "node", Name: "weight", Type: "int"},
+		{ID: "weight", For: "edge", Name: "weight", Type: "int"},
+	}}
+	doc.Graph.ID = g.Name
+	doc.Graph.EdgeDefault = "undirected"
+	if g.Directed {
+		doc.Graph.EdgeDefault = "directed"
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: n.ID, Data: []graphMLData{
+			{Key: "label", Value: n.Label},
+			{Key: "nweight", Value: strconv.Itoa(n.Weight)},
+		}})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: e.Source, Target: e.Target, Data: []graphMLData{
+			{Key: "weight", Value: strconv.Itoa(e.Weight)},
+		}})
+	}
+	return writeXML(w, doc)
+}
+
+type gexf struct {
+	XMLName xml.Name `xml:"http://gexf.net/1.3 gexf"`
+	Version string   `xml:"version,attr"`
+	Graph   struct {
+		Mode            string `xml:"mode,attr"`
+		DefaultEdgeType string `xml:"defaultedgetype,attr"`
+		Attributes      struct {
+			Class     string          `xml:"class,attr"`
+			Attribute []gexfAttribute `xml:"attribute"`
+		} `xml:"attributes"`
+		Nodes []gexfNode `xml:"nodes>node"`
+		Edges []gexfEdge `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Weight int    `xml:"weight,attr"`
+}
+
+// WriteGEXF writes g as GEXF 1.3, with node weights as the "weight" node
+// attribute.
+func (g *Graph) WriteGEXF(w io.Writer) error {
+	doc := gexf{Version: "1.3"}
+	doc.Graph.Mode = "static"
+	doc.Graph.DefaultEdgeType = "undirected"
+	if g.Directed {
+		doc.Graph.DefaultEdgeType = "directed"
+	}
+	doc.Graph.Attributes.Class = "node"
+	doc.Graph.Attributes.Attribute = []gexfAttribute{{ID: "weight", Title: "weight", Type: "integer"}}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{
+			ID:        n.ID,
+			Label:     n.Label,
+			AttValues: []gexfAttValue{{For: "weight", Value: strconv.Itoa(n.Weight)}},
+		})
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{ID: strconv.Itoa(i), Source: e.Source, Target: e.Target, Weight: e.Weight})
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteDOT writes g in the Graphviz DOT language, with edge weights as the
+// weight and label attributes.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var buf strings.Builder
+	kind, op := "graph", "--"
+	if g.Directed {
+		kind, op = "digraph", "->"
+	}
+	fmt.Fprintf(&buf, "%s %s {\n", kind, dotID(g.Name))
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&buf, "  %s [label=%s, weight=%d];\n", dotID(n.ID), dotID(n.Label), n.Weight)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "  %s %s %s [weight=%d, label=%d];\n", dotID(e.Source), op, dotID(e.Target), e.Weight, e.Weight)
+	}
+	buf.WriteString("}\n")
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// dotID quotes s as a DOT ID.
+func dotID(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,188 @@
+package bibtex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entry returns the entry with the given cite key, or nil. If the key is
+// duplicated (see CheckKeys), Entry returns the first of its entries.
+//
+// Lookups use an index of the entries, kept up to date by AddEntry, Rekey,
+// RenameKeys and the editing methods below. The index is rebuilt when the
+// length of Entries was changed directly, or when a lookup finds an entry
+// whose cite key was changed directly. A cite key set directly on an entry,
+// without changing the length of Entries, is not found until then; use
+// RenameEntry instead.
+func (bib *BibTex) Entry(key string) *BibEntry {
+	if i, ok := bib.entryIndex(key); ok {
+		return bib.Entries[i]
+	}
+	return nil
+}
+
+// entryIndex returns the position of the first entry with the cite key,
+// rebuilding the index if Entries was changed directly.
+func (bib *BibTex) entryIndex(key string) (int, bool) {
+	if bib.index == nil || bib.indexed != len(bib.Entries) {
+		bib.reindex()
+	}
+	i, ok := bib.index[key]
+	if ok && (i >= len(bib.Entries) || bib.Entries[i].CiteName != key) {
+		bib.reindex()
+		i, ok = bib.index[key]
+	}
+	return i, ok
+}
+
+// reindex rebuilds the index of all entries.
+func (bib *BibTex) reindex() {
+	bib.index = make(map[string]int, len(bib.Entries))
+	for i, entry := range bib.Entries {
+		if _, ok := bib.index[entry.CiteName]; !ok {
+			bib.index[entry.CiteName] = i
+		}
+	}
+	bib.indexed = len(bib.Entries)
+}
+
+// keysChanged updates the index and the references of bib after the cite
+// keys of entries were changed from the keys to the values of renames.
+func (bib *BibTex) keysChanged(renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	if bib.index != nil {
+		bib.reindex()
+	}
+	bib.renameReferences(renames)
+}
+
+// indexKey indexes the first entry with the cite key, if any, after the
+// entry indexed for it was removed or renamed.
+func (bib *BibTex) indexKey(key string) {
+	for i, entry := range bib.Entries {
+		if entry.CiteName == key {
+			bib.index[key] = i
+			return
+		}
+	}
+}
+
+// CheckKeys returns an ErrDuplicateKey listing the cite keys used by more
+// than one entry, or nil.
+func (bib *BibTex) CheckKeys() error {
+	count := make(map[string]int, len(bib.Entries))
+	var duplicates []string
+	for _, entry := range bib.Entries {
+		if count[entry.CiteName]++; count[entry.CiteName] == 2 {
+			duplicates = append(duplicates, entry.CiteName)
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, strings.Join(duplicates, ", "))
+	}
+	return nil
+}
+
+// AddUniqueEntry adds an entry like AddEntry, but returns an ErrDuplicateKey
+// if bib already has an entry with its cite key.
+func (bib *BibTex) AddUniqueEntry(entry *BibEntry) error {
+	if _, ok := bib.entryIndex(entry.CiteName); ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, entry.CiteName)
+	}
+	bib.AddEntry(entry)
+	return nil
+}
+
+// RemoveEntry removes the entry with the given cite key, or returns an
+// ErrUnknownKey. References to it are kept.
+func (bib *BibTex) RemoveEntry(key string) error {
+	i, ok := bib.entryIndex(key)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+	bib.Entries = append(bib.Entries[:i], bib.Entries[i+1:]...)
+	bib.indexed--
+	delete(bib.index, key)
+	for k, j := range bib.index {
+		if j > i {
+			bib.index[k] = j - 1
+		}
+	}
+	bib.indexKey(key)
+	return nil
+}
+
+// RenameEntry changes the cite key of the entries with oldKey to newKey
+// like RenameKeys. It returns an ErrUnknownKey if there is no entry with
+// oldKey, or an ErrDuplicateKey if there is already an entry with newKey.
+func (bib *BibTex) RenameEntry(oldKey, newKey string) error {
+	if _, ok := bib.entryIndex(oldKey); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, oldKey)
+	}
+	_, err := bib.RenameKeys(map[string]string{oldKey: newKey})
+	return err
+}
+
+// ReplaceEntry replaces the entry with the given cite key by entry, which
+// may have a different key. It returns an ErrUnknownKey if there is no entry
+// with the key, or an ErrDuplicateKey if the key of entry is used by another
+// entry. References to a changed key are not updated; use RenameEntry.
+func (bib *BibTex) ReplaceEntry(key string, entry *BibEntry) error {
+	i, ok := bib.entryIndex(key)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+	if j, ok := bib.entryIndex(entry.CiteName); ok && j != i {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, entry.CiteName)
+	}
+	bib.Entries[i] = entry
+	if entry.CiteName != key {
+		delete(bib.index, key)
+		bib.index[entry.CiteName] = i
+		bib.indexKey(key)
+	}
+	return nil
+}
+
+// fieldName returns the name of the field of entry with the given name,
+// ignoring case.
+func (entry *BibEntry) fieldName(name string) (string, bool) {
+	if _, ok := entry.Fields[name]; ok {
+		return name, true
+	}
+	for key := range entry.Fields {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// RemoveField removes the field with the given name, ignoring case, and
+// returns true if it was present.
+func (entry *BibEntry) RemoveField(name string) bool {
+	key, ok := entry.fieldName(name)
+	if ok {
+		delete(entry.Fields, key)
+	}
+	return ok
+}
+
+// RenameField renames the field oldName (ignoring case) to newName,
+// keeping its value. It returns an ErrUnknownField if there is no field
+// oldName, or an ErrDuplicateField if there is another field newName.
+func (entry *BibEntry) RenameField(oldName, newName string) error {
+	key, ok := entry.fieldName(oldName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownField, oldName)
+	}
+	if other, ok := entry.fieldName(newName); ok && other != key {
+		return fmt.Errorf("%w: %s", ErrDuplicateField, newName)
+	}
+	value := entry.Fields[key]
+	delete(entry.Fields, key)
+	entry.Fields[strings.TrimSpace(newName)] = value
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package journals abbreviates and expands journal titles with ISO 4
+// abbreviation lists.
+//
+// Lists are read from CSV files in the format of the JabRef journal
+// abbreviation lists: one "full title","abbreviation" pair per line,
+// separated by a comma or a semicolon, with any further columns (such as a
+// shortest unique abbreviation) ignored. Lines starting with # are comments.
+// Default returns a list of common journals shipped with the package.
+//
+// Titles are matched exactly first, then normalized: TeX decoded and folded
+// to ASCII, case, punctuation, a leading "The" and the difference between
+// "&" and "and" are ignored, so that {Phys.~Rev.~Lett.} matches
+// "Phys. Rev. Lett.".
+package journals // import "github.com/nickng/bibtex/journals"
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/nickng/bibtex"
+)
+
+// Fields are the fields rewritten by AbbreviateAll and ExpandAll.
+var Fields = []string{"journal", "journaltitle"}
+
+//go:embed data/*.csv
+var data embed.FS
+
+var (
+	defaultList     *List
+	defaultListOnce sync.Once
+)
+
+// Default returns the abbreviation list shipped with the package. The list
+// is shared and must not be modified; use Clone to extend it.
+func Default() *List {
+	defaultListOnce.Do(func() {
+		defaultList = NewList()
+		files, err := fs.Glob(data, "data/*.csv")
+		if err != nil {
+			panic(err)
+		}
+		for _, name := range files {
+			f, err := data.Open(name)
+			if err != nil {
+				panic(err)
+			}
+			if err := defaultList.ReadCSV(f); err != nil {
+				panic(fmt.Sprintf("%s: %v", name, err))
+			}
+			f.Close()
+		}
+	})
+	return defaultList
+}
+
+// Abbreviation is a journal title and its abbreviation.
+type Abbreviation struct {
+	Full   string
+	Abbrev string
+}
+
+// List is a list of journal abbreviations.
+type List struct {
+	entries []Abbreviation
+	full    map[string]int // Exact and normalized full title -> entry.
+	abbrev  map[string]int // Exact and normalized abbreviation -> entry.
+}
+
+// NewList returns an empty list.
+func NewList() *List {
+	return &List{full: make(map[string]int), abbrev: make(map[string]int)}
+}
+
+// Clone returns a copy of l.
+func (l *List) Clone() *List {
+	c := NewList()
+	for _, a := range l.entries {
+		c.Add(a.Full, a.Abbrev)
+	}
+	return c
+}
+
+// Len returns the number of abbreviations in l.
+func (l *List) Len() int {
+	return len(l.entries)
+}
+
+// Add adds an abbreviation to l. Later abbreviations of the same title
+// replace earlier ones.
+func (l *List) Add(full, abbrev string) {
+	full, abbrev = strings.TrimSpace(full), strings.TrimSpace(abbrev)
+	if full == "" || abbrev == "" {
+		return
+	}
+	i := len(l.entries)
+	l.entries = append(l.entries, Abbreviation{Full: full, Abbrev: abbrev})
+	for _, key := range []string{full, normalize(full)} {
+		l.full[key] = i
+	}
+	for _, key := range []string{abbrev, normalize(abbrev)} {
+		if _, ok := l.abbrev[key]; !ok { // Keep the first title of an ambiguous abbreviation.
+			l.abbrev[key] = i
+		}
+	}
+}
+
+// ReadCSV adds the abbreviations of a JabRef-style CSV file to l.
+func (l *List) ReadCSV(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	cr := csv.NewReader(br)
+	cr.Comma = detectComma(br)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) < 2 {
+			line, _ := cr.FieldPos(0)
+			return fmt.Errorf("line %d: expected a title and an abbreviation", line)
+		}
+		l.Add(record[0], record[1])
+	}
+}
+
+// detectComma returns the separator of the first data line of a CSV file:
+// a semicolon if the line has more semicolons than commas, else a comma.
+func detectComma(br *bufio.Reader) rune {
+	peek, _ := br.Peek(br.Size())
+	for _, line := range bytes.Split(peek, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+			return ';'
+		}
+		break
+	}
+	return ','
+}
+
+// ReadFile adds the abbreviations of a JabRef-style CSV file to l.
+func (l *List) ReadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := l.ReadCSV(f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// Abbreviate returns the abbreviation of a full journal title.
+func (l *List) Abbreviate(title string) (string, bool) {
+	if i, ok := lookup(l.full, title); ok {
+		return l.entries[i].Abbrev, true
+	}
+	return "", false
+}
+
+// Expand returns the full journal title of an abbreviation.
+func (l *List) Expand(abbrev string) (string, bool) {
+	if i, ok := lookup(l.abbrev, abbrev); ok {
+		return l.entries[i].Full, true
+	}
+	return "", false
+}
+
+func lookup(m map[string]int, title string) (int, bool) {
+	if i, ok := m[strings.TrimSpace(title)]; ok {
+		return i, true
+	}
+	i, ok := m[normalize(title)]
+	return i, ok
+}
+
+// AbbreviateAll replaces the full journal titles in the journal and
+// journaltitle fields of bib by their abbreviations, and returns the number
+// of fields changed. Titles given by @string macros are replaced by
+// constants; titles that are not in l are kept.
+func (l *List) AbbreviateAll(bib *bibtex.BibTex) int {
+	return rewriteFields(bib, l.Abbreviate)
+}
+
+// ExpandAll replaces the abbreviated journal titles in the journal and
+// journaltitle fields of bib by the full titles, and returns the number of
+// fields changed.
+func (l *List) ExpandAll(bib *bibtex.BibTex) int {
+	return rewriteFields(bib, l.Expand)
+}
+
+func rewriteFields(bib *bibtex.BibTex, rewrite func(string) (string, bool)) int {
+	n := 0
+	for _, entry := range bib.Entries {
+		for name, value := range entry.Fields {
+			if !isJournalField(name) {
+				continue
+			}
+			title, ok := rewrite(value.String())
+			if !ok || title == value.String() {
+				continue
+			}
+			entry.Fields[name] = bibtex.NewBibConst(title)
+			n++
+		}
+	}
+	return n
+}
+
+func isJournalField(name string) bool {
+	for _, field := range Fields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize returns the title for normalized matching: lowercase ASCII
+// words, without a leading "the", with "&" as "and".
+func normalize(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(bibtex.ASCIIFold(title)), func(r rune) bool {
+		return r != '&' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	for i, w := range words {
+		if w == "&" {
+			words[i] = "and"
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,93 @@
+package journals
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nickng/bibtex"
+)
+
+func TestAbbreviate(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Journal of the ACM", "J. ACM"},
+		{"journal of the acm", "J. ACM"},
+		{"The Journal of the ACM", "J. ACM"},
+		{"Proceedings of the {IEEE}", "Proc. IEEE"},
+		{"Software: Practice & Experience", "Softw. Pract. Exp."},
+		{"J. ACM", ""},
+		{"Journal of Nothing", ""},
+	}
+	for _, tt := range tests {
+		got, ok := Default().Abbreviate(tt.title)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: want %q but got %q (%t)", tt.title, tt.want, got, ok)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		abbrev string
+		want   string
+	}{
+		{"J. ACM", "Journal of the ACM"},
+		{`Phys.~Rev.~Lett.`, "Physical Review Letters"},
+		{"Proc Natl Acad Sci U S A", "Proceedings of the National Academy of Sciences of the United States of America"},
+		{"Journal of the ACM", ""},
+	}
+	for _, tt := range tests {
+		got, ok := Default().Expand(tt.abbrev)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: want %q but got %q (%t)", tt.abbrev, tt.want, got, ok)
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	l := NewList()
+	src := "# A CASSI-style list.\nJournal of Foo;J. Foo;JF\nAnnals of Bar, Baz;Ann. Bar, Baz\n"
+	if err := l.ReadCSV(strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, l.Len(); want != got {
+		t.Fatalf("expected %d abbreviations but got %d", want, got)
+	}
+	if got, _ := l.Abbreviate("Annals of Bar, Baz"); got != "Ann. Bar, Baz" {
+		t.Errorf("expected semicolon-separated abbreviation but got %q", got)
+	}
+	if err := NewList().ReadCSV(strings.NewReader("Journal of Foo\n")); err == nil {
+		t.Errorf("expected an error for a line without abbreviation")
+	}
+}
+
+func TestAbbreviateAll(t *testing.T) {
+	b, err := os.ReadFile("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib, err := bibtex.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Default().Clone()
+	l.Add("Journal of Chemical Physics", "J. Chem. Phys.")
+	abbreviated := l.AbbreviateAll(bib)
+	if abbreviated < 7 {
+		t.Errorf("expected at least 7 abbreviated titles but got %d", abbreviated)
+	}
+	for _, entry := range bib.Entries {
+		if entry.CiteName == "sigfridsson" {
+			if want, got := "J. Comput. Chem.", entry.Fields["journaltitle"].String(); want != got {
+				t.Errorf("expected %q but got %q", want, got)
+			}
+		}
+	}
+	if want, got := abbreviated, l.ExpandAll(bib); want > got {
+		t.Errorf("expected at least %d expanded titles but got %d", want, got)
+	}
+}
@@ -0,0 +1,185 @@
+package latex
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Citations returns the cite keys of the citation commands in the LaTeX
+// source src, in order of first citation.
+func Citations(src []byte) []string {
+	var keys []string
+	for _, span := range citeKeys(src) {
+		keys = append(keys, string(src[span.start:span.end]))
+	}
+	return uniqueKeys(keys)
+}
+
+// AuxCitations returns the cite keys of the \citation lines of a LaTeX .aux
+// file, in order of first citation.
+func AuxCitations(r io.Reader) ([]string, error) {
+	keys, _, err := readAux(r)
+	return keys, err
+}
+
+// readAux returns the cite keys and the \@input files of a .aux file.
+func readAux(r io.Reader) ([]string, []string, error) {
+	var keys, inputs []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if arg, ok := auxArg(line, `\citation`); ok {
+			for _, key := range strings.Split(arg, ",") {
+				if key = strings.TrimSpace(key); key != "" {
+					keys = append(keys, key)
+				}
+			}
+		} else if arg, ok := auxArg(line, `\@input`); ok {
+			inputs = append(inputs, arg)
+		}
+	}
+	return uniqueKeys(keys), inputs, scanner.Err()
+}
+
+// auxArg returns the argument of a .aux line of the form \cmd{arg}.
+func auxArg(line, cmd string) (string, bool) {
+	if !strings.HasPrefix(line, cmd+"{") || !strings.HasSuffix(line, "}") {
+		return "", false
+	}
+	return line[len(cmd)+1 : len(line)-1], true
+}
+
+// BCFCitations returns the cite keys of the citekey elements of a BibLaTeX
+// .bcf file, in order of first citation.
+func BCFCitations(r io.Reader) ([]string, error) {
+	var keys []string
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "citekey" {
+			var key string
+			if err := d.DecodeElement(&key, &start); err != nil {
+				return nil, err
+			}
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return uniqueKeys(keys), nil
+}
+
+// ReadCitations returns the cite keys cited in the given files, in order of
+// first citation. Each path is read by its extension: a .aux file (and the
+// .aux files it includes with \@input), a .bcf file, or a .tex file; the
+// .tex files under a directory are scanned.
+func ReadCitations(paths ...string) ([]string, error) {
+	var keys []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		var found []string
+		switch ext := filepath.Ext(path); {
+		case info.IsDir():
+			found, err = texTreeCitations(path)
+		case ext == ".aux":
+			found, err = auxFileCitations(path, make(map[string]bool))
+		case ext == ".bcf":
+			found, err = readFile(path, BCFCitations)
+		case ext == ".tex":
+			found, err = readFile(path, func(r io.Reader) ([]string, error) {
+				src, err := io.ReadAll(r)
+				return Citations(src), err
+			})
+		default:
+			err = fmt.Errorf("%s: not a .aux, .bcf or .tex file", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, found...)
+	}
+	return uniqueKeys(keys), nil
+}
+
+func readFile(path string, read func(io.Reader) ([]string, error)) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+// auxFileCitations reads a .aux file and the files it includes, which are
+// relative to the directory of the top-level file as written by LaTeX.
+func auxFileCitations(path string, seen map[string]bool) ([]string, error) {
+	if seen[path] {
+		return nil, nil
+	}
+	seen[path] = true
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, inputs, err := readAux(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range inputs {
+		included, err := auxFileCitations(filepath.Join(filepath.Dir(path), input), seen)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		keys = append(keys, included...)
+	}
+	return keys, nil
+}
+
+func texTreeCitations(root string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".tex" {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, Citations(src)...)
+		return nil
+	})
+	return keys, err
+}
+
+// uniqueKeys removes repeated keys, keeping the first.
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	unique := keys[:0]
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,71 @@
+package latex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuxCitations(t *testing.T) {
+	aux := `\relax
+\citation{knuth84,lamport}
+\citation{knuth84}
+\bibstyle{plain}
+\@input{chapter.aux}
+`
+	keys, err := AuxCitations(strings.NewReader(aux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "knuth84 lamport", strings.Join(keys, " "); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+}
+
+func TestBCFCitations(t *testing.T) {
+	bcf := `<?xml version="1.0" encoding="UTF-8"?>
+<bcf:controlfile version="3.8" xmlns:bcf="https://sourceforge.net/projects/biblatex">
+  <bcf:section number="0">
+    <bcf:citekey order="1" intorder="1">knuth84</bcf:citekey>
+    <bcf:citekey order="2" intorder="1">lamport</bcf:citekey>
+    <bcf:citekey order="3" intorder="1">knuth84</bcf:citekey>
+  </bcf:section>
+</bcf:controlfile>
+`
+	keys, err := BCFCitations(strings.NewReader(bcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "knuth84 lamport", strings.Join(keys, " "); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+}
+
+func TestReadCitations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.aux":     "\\citation{a}\n\\@input{ch1.aux}\n\\@input{missing.aux}\n",
+		"ch1.aux":      "\\citation{b,a}\n",
+		"tex/main.tex": `\cite{c} \citep[p.~1]{d,a}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := ReadCitations(filepath.Join(dir, "main.aux"), filepath.Join(dir, "tex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "a b c d", strings.Join(keys, " "); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+	if _, err := ReadCitations(filepath.Join(dir, "tex", "main.pdf")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
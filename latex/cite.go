@@ -0,0 +1,206 @@
+// Package latex works with the citations in LaTeX sources of a
+// bibliography: it finds and renames the cite keys of \cite-like commands
+// in .tex files, and reads the cite keys recorded in .aux and BibLaTeX .bcf
+// files.
+//
+// All natbib and biblatex citation commands are recognized, i.e. any
+// command whose name contains "cite" (\cite, \citep, \citet, \autocite,
+// \parencite, \textcite, \nocite, ...), with or without a star, with
+// optional arguments, and with multiple key lists for the multicite
+// commands (\cites, \parencites, ...).
+package latex // import "github.com/nickng/bibtex/latex"
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keySpan is the position of a cite key in a source: src[start:end].
+type keySpan struct {
+	start, end int
+}
+
+// citeKeys returns the positions of all cite keys in the citation commands
+// of src.
+func citeKeys(src []byte) []keySpan {
+	var spans []keySpan
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '%': // Skip comments.
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case '\\':
+		default:
+			continue
+		}
+		j := i + 1
+		for j < len(src) && isLetter(src[j]) {
+			j++
+		}
+		name := string(src[i+1 : j])
+		if !strings.Contains(strings.ToLower(name), "cite") || isNonCitation(name) {
+			if j == i+1 {
+				j++ // Skip an escaped character such as \%.
+			}
+			i = j - 1
+			continue
+		}
+		multi := strings.HasSuffix(name, "s")
+		if j < len(src) && src[j] == '*' {
+			j++
+		}
+		for j < len(src) {
+			k := skipSpace(src, j)
+			if k >= len(src) {
+				break
+			}
+			switch src[k] {
+			case '[':
+				j = skipGroup(src, k, ']')
+				continue
+			case '(':
+				if !multi {
+					break
+				}
+				j = skipGroup(src, k, ')')
+				continue
+			case '{':
+				end := skipGroup(src, k, '}')
+				spans = append(spans, splitKeys(src, k+1, end-1)...)
+				j = end
+				if multi {
+					continue
+				}
+			}
+			break
+		}
+		i = j - 1
+	}
+	return spans
+}
+
+// isNonCitation returns true for commands with "cite" in their names that
+// do not take cite keys.
+func isNonCitation(name string) bool {
+	switch name {
+	case "citestyle", "citesetup", "citename", "citefield", "citelist":
+		return true
+	}
+	return false
+}
+
+// splitKeys returns the positions of the comma-separated keys in
+// src[start:end], without surrounding whitespace.
+func splitKeys(src []byte, start, end int) []keySpan {
+	var spans []keySpan
+	for start < end {
+		comma := start
+		for comma < end && src[comma] != ',' {
+			comma++
+		}
+		s, e := start, comma
+		for s < e && isSpace(src[s]) {
+			s++
+		}
+		for e > s && isSpace(src[e-1]) {
+			e--
+		}
+		if s < e {
+			spans = append(spans, keySpan{start: s, end: e})
+		}
+		start = comma + 1
+	}
+	return spans
+}
+
+// skipGroup returns the position after the group that starts at src[i]
+// and ends with close, skipping braced groups and escaped characters.
+func skipGroup(src []byte, i int, close byte) int {
+	depth := 0
+	for j := i + 1; j < len(src); j++ {
+		switch c := src[j]; {
+		case c == '\\':
+			j++
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == close && depth == 0:
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+func skipSpace(src []byte, i int) int {
+	for i < len(src) && isSpace(src[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func isLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// RenameCitations returns src with the cite keys of its citation commands
+// renamed by renames (old to new key), and the number of keys renamed.
+func RenameCitations(src []byte, renames map[string]string) ([]byte, int) {
+	var out []byte
+	n, last := 0, 0
+	for _, span := range citeKeys(src) {
+		newKey, ok := renames[string(src[span.start:span.end])]
+		if !ok {
+			continue
+		}
+		out = append(out, src[last:span.start]...)
+		out = append(out, newKey...)
+		last = span.end
+		n++
+	}
+	if n == 0 {
+		return src, 0
+	}
+	return append(out, src[last:]...), n
+}
+
+// RenameCitationsInTree renames cite keys in all .tex files under root (a
+// file or directory), rewriting only the files that change, and returns the
+// number of keys renamed in each changed file.
+func RenameCitationsInTree(root string, renames map[string]string) (map[string]int, error) {
+	changed := make(map[string]int)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".tex" {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out, n := RenameCitations(src, renames)
+		if n == 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, out, info.Mode().Perm()); err != nil {
+			return err
+		}
+		changed[path] = n
+		return nil
+	})
+	return changed, err
+}
@@ -0,0 +1,70 @@
+package latex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameCitations(t *testing.T) {
+	renames := map[string]string{"knuth84": "knuth1984", "lamport": "lamport1994", "x": "y"}
+	tests := []struct {
+		src  string
+		want string
+		n    int
+	}{
+		{`\cite{knuth84}`, `\cite{knuth1984}`, 1},
+		{`\citep[see][p.~5]{knuth84, lamport,other}`, `\citep[see][p.~5]{knuth1984, lamport1994,other}`, 2},
+		{`\citet*{lamport}`, `\citet*{lamport1994}`, 1},
+		{`\autocite[{[}a{]}]{knuth84}`, `\autocite[{[}a{]}]{knuth1984}`, 1},
+		{"\\parencite\n  {knuth84}", "\\parencite\n  {knuth1984}", 1},
+		{`\textcites(pre)(post)[a]{knuth84}[b]{lamport} {x}`, `\textcites(pre)(post)[a]{knuth1984}[b]{lamport1994} {y}`, 3},
+		{`\textcite{knuth84} {x}`, `\textcite{knuth1984} {x}`, 1},
+		{`\nocite{*}`, `\nocite{*}`, 0},
+		{`\label{knuth84} \ref{x} 50\% \cite{x} % \cite{x}`, `\label{knuth84} \ref{x} 50\% \cite{y} % \cite{x}`, 1},
+		{`\citestyle{x} \Citeauthor{x}`, `\citestyle{x} \Citeauthor{y}`, 1},
+	}
+	for _, tt := range tests {
+		got, n := RenameCitations([]byte(tt.src), renames)
+		if string(got) != tt.want || n != tt.n {
+			t.Errorf("%s: want %s (%d) but got %s (%d)", tt.src, tt.want, tt.n, got, n)
+		}
+	}
+}
+
+func TestRenameCitationsInTree(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.tex":           `\input{chapters/intro} \cite{old}`,
+		"chapters/intro.tex": `\citep{other}`,
+		"notes.txt":          `\cite{old}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changed, err := RenameCitationsInTree(dir, map[string]string{"old": "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(changed); want != got || changed[filepath.Join(dir, "main.tex")] != 1 {
+		t.Errorf("expected only main.tex to change but got %v", changed)
+	}
+	for name, want := range map[string]string{
+		"main.tex":  `\input{chapters/intro} \cite{new}`,
+		"notes.txt": `\cite{old}`,
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want != string(got) {
+			t.Errorf("%s: want %s but got %s", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package bibtex
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseLenient parses r item by item, skipping the items that fail to parse.
+func parseLenient(r io.Reader, config parseConfig) (*BibTex, error) {
+	items := &itemReader{r: bufio.NewReader(r), maxSize: config.maxEntrySize, pos: tokenPos{Lines: []int{}}}
+	bib := (&lexer{config: config}).newBibTex()
+	ctx, report := config.ctx, config.report
+	config.ctx, config.report = nil, nil // Checked here between items.
+	var errs []error
+	for {
+		if report != nil {
+			report(Progress{Bytes: items.offset, Entries: len(bib.Entries)})
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		item, pos, err := items.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		l := newLexer(bytes.NewReader(item), config)
+		l.scanner.pos = pos
+		l.bib = bib
+		bibtexParse(l)
+		if err := l.err(); err != nil {
+			errs = append(errs, err)
+			if max := config.maxEntries; max > 0 && len(bib.Entries) >= max && errors.Is(err, ErrLimit) {
+				break
+			}
+		}
+	}
+	if report != nil {
+		report(Progress{Bytes: items.offset, Entries: len(bib.Entries)})
+	}
+	return bib, errors.Join(errs...)
+}
+
+// itemReader splits a bib file into items, each from its @ to its closing
+// delimiter. Text between items and @comment items are skipped.
+type itemReader struct {
+	r       *bufio.Reader
+	maxSize int
+	pos     tokenPos // Position as in scanner.
+	offset  int64    // Bytes read from r.
+	start   int64    // Offset of the @ of the last item.
+}
+
+// next returns the next item and its position, or io.EOF.
+func (ir *itemReader) next() ([]byte, tokenPos, error) {
+	for {
+		ch, err := ir.read()
+		if err != nil {
+			return nil, tokenPos{}, err
+		}
+		if ch != '@' {
+			continue
+		}
+		pos := tokenPos{Char: ir.pos.Char - 1, Lines: ir.pos.Lines[:len(ir.pos.Lines):len(ir.pos.Lines)]}
+		ir.start = ir.offset - 1
+		item, err := ir.readItem()
+		if err == errComment {
+			continue
+		} else if err != nil {
+			return nil, tokenPos{}, fmt.Errorf("%w at %s", err, pos)
+		}
+		return item, pos, nil
+	}
+}
+
+var errComment = errors.New("comment")
+
+// readItem reads the rest of an item after its @. A @comment item, which
+// ends at the next @ as in the scanner, is skipped with errComment.
+func (ir *itemReader) readItem() ([]byte, error) {
+	var buf bytes.Buffer
+	_, _ = buf.WriteRune('@')
+	size := 0 // Bytes after the @, as counted by the scanner.
+	write := func(ch rune) {
+		if size += utf8.RuneLen(ch); ir.maxSize == 0 || size <= ir.maxSize {
+			_, _ = buf.WriteRune(ch)
+		}
+	}
+	var open rune
+	for open == 0 {
+		ch, err := ir.read()
+		if err != nil {
+			return buf.Bytes(), nil
+		}
+		switch ch {
+		case '@':
+			ir.unread()
+			return buf.Bytes(), nil
+		case '{', '(':
+			open = ch
+		}
+		write(ch)
+	}
+	if typ := strings.TrimSuffix(buf.String()[1:], string(open)); strings.EqualFold(strings.TrimSpace(typ), "comment") {
+		for {
+			ch, err := ir.read()
+			if err != nil {
+				return nil, errComment
+			}
+			if ch == '@' {
+				ir.unread()
+				return nil, errComment
+			}
+		}
+	}
+	// An @ starting a line, which is an error inside a value, ends an item
+	// with unbalanced braces.
+	depth, lineStart := 1, false
+	for depth > 0 {
+		ch, err := ir.read()
+		if err != nil {
+			break
+		}
+		switch {
+		case ch == '@' && lineStart:
+			ir.unread()
+			depth = 0
+			continue
+		case ch == '{':
+			depth++
+		case ch == '}', ch == ')' && open == '(' && depth == 1:
+			depth--
+		}
+		lineStart = ch == '\n' || lineStart && isWhitespace(ch)
+		write(ch)
+	}
+	if ir.maxSize > 0 && size > ir.maxSize {
+		return nil, fmt.Errorf("%w: item larger than %d bytes", ErrLimit, ir.maxSize)
+	}
+	return buf.Bytes(), nil
+}
+
+func (ir *itemReader) read() (rune, error) {
+	ch, size, err := ir.r.ReadRune()
+	if err != nil {
+		return eof, err
+	}
+	ir.offset += int64(size)
+	if ch == '\n' {
+		ir.pos.Lines = append(ir.pos.Lines, ir.pos.Char)
+		ir.pos.Char = 0
+	} else {
+		ir.pos.Char++
+	}
+	return ch, nil
+}
+
+// unread places back an @ read by readItem.
+func (ir *itemReader) unread() {
+	_ = ir.r.UnreadRune()
+	ir.pos.Char--
+	ir.offset--
+}
@@ -10,26 +10,151 @@ import (
 // lexer for bibtex.
 type lexer struct {
 	scanner     *scanner
-	ParseErrors []error // Parse errors from yacc
-	Errors      []error // Other errors
+	config      parseConfig
+	bib         *BibTex         // Bibliography being parsed.
+	keys        map[string]bool // Cite keys seen, in strict mode.
+	last        [3]token        // Last tokens, to find the cite key.
+	lastTags    []*bibTag       // Fields of the last entry, in order.
+	ParseErrors []error         // Parse errors from yacc
+	Errors      []error         // Other errors
 }
 
 // newLexer returns a new yacc-compatible lexer.
-func newLexer(r io.Reader) *lexer {
+func newLexer(r io.Reader, config parseConfig) *lexer {
+	s := newScanner(r)
+	s.maxSize, s.maxDepth = config.maxEntrySize, config.maxDepth
 	return &lexer{
-		scanner: newScanner(r),
+		scanner: s,
+		config:  config,
+	}
+}
+
+// newBibTex returns the BibTex that the parser fills, with the predefined
+// macros of the parse options.
+func (l *lexer) newBibTex() *BibTex {
+	if l.bib != nil {
+		return l.bib
+	}
+	l.bib = NewBibTex()
+	if l.config.months != nil {
+		for i, key := range monthMacros {
+			l.bib.defaultVars[key] = l.config.months[i]
+		}
+	}
+	for key, value := range l.config.macros {
+		l.bib.defaultVars[key] = value
+	}
+	l.bib.hideDefaultVars = l.config.hideDefaultVars
+	return l.bib
+}
+
+// newBibEntry returns the entry parsed from entryType, citeName and tags,
+// checking the parse options.
+func (l *lexer) newBibEntry(entryType, citeName string, tags []*bibTag) *BibEntry {
+	if max := l.config.maxEntries; max > 0 && len(l.bib.Entries) >= max {
+		l.fail(fmt.Errorf("%w: more than %d entries", ErrLimit, max))
+	}
+	entry := &BibEntry{
+		Type:     l.config.typeCase.apply(entryType),
+		CiteName: citeName,
+		Fields:   map[string]BibString{},
+	}
+	l.lastTags = tags
+	for _, t := range tags {
+		name := l.config.fieldCase.apply(t.key)
+		if _, ok := entry.Fields[name]; ok && l.config.mode == strictMode {
+			l.fail(fmt.Errorf("%w: %s in %s", ErrDuplicateField, name, citeName))
+		}
+		entry.AddField(name, t.val)
+	}
+	if l.config.mode == strictMode {
+		if l.keys[citeName] {
+			l.fail(fmt.Errorf("%w: %s", ErrDuplicateKey, citeName))
+		}
+		if l.keys == nil {
+			l.keys = make(map[string]bool)
+		}
+		l.keys[citeName] = true
+	}
+	return entry
+}
+
+// stringVar returns the macro key. Unknown macros are errors, except in
+// lenient mode where they are undefined.
+func (l *lexer) stringVar(key string) *BibVar {
+	if v, ok := l.bib.StringVar[key]; ok {
+		return v
+	}
+	if v, ok := l.bib.getDefaultVar(key); ok {
+		return v
+	}
+	if l.config.mode != lenientMode {
+		l.fail(fmt.Errorf("%w: %s", ErrUnknownStringVar, key))
+	}
+	return &BibVar{Key: key, Value: NewBibConst("")}
+}
+
+// progress reports the progress to the callback of the parse options.
+func (l *lexer) progress() {
+	if l.config.report == nil {
+		return
+	}
+	p := Progress{Bytes: l.scanner.offset}
+	if l.bib != nil {
+		p.Entries = len(l.bib.Entries)
+	}
+	l.config.report(p)
+}
+
+// fail records err at the current position. The next Lex ends the input.
+func (l *lexer) fail(err error) {
+	l.Errors = append(l.Errors, fmt.Errorf("%w at %s", err, l.scanner.pos))
+}
+
+// err returns the first error of the parse.
+func (l *lexer) err() error {
+	switch {
+	case len(l.Errors) > 0: // Non-yacc errors
+		return l.Errors[0]
+	case len(l.ParseErrors) > 0:
+		return l.ParseErrors[0]
+	default:
+		return nil
 	}
 }
 
 // Lex is provided for yacc-compatible parser.
 func (l *lexer) Lex(yylval *bibtexSymType) int {
-	token, strval, err := l.scanner.Scan()
+	if len(l.Errors) > 0 {
+		return int(0)
+	}
+	var (
+		tok    token
+		strval string
+		err    error
+	)
+	if l.config.citeKeySpaces && l.last == [3]token{tATSIGN, tBAREIDENT, tLBRACE} {
+		tok, strval = l.scanner.scanKey()
+	} else {
+		tok, strval, err = l.scanner.Scan()
+	}
+	if err == nil {
+		err = l.scanner.err
+	}
 	if err != nil {
-		l.Errors = append(l.Errors, fmt.Errorf("%w at %s", err, l.scanner.pos))
+		l.fail(err)
 		return int(0)
 	}
+	if tok == tATSIGN { // Between items.
+		l.progress()
+		if l.config.ctx != nil && l.config.ctx.Err() != nil {
+			l.fail(l.config.ctx.Err())
+			return int(0)
+		}
+	}
+	l.last = [3]token{l.last[1], l.last[2], tok}
 	yylval.strval = strval
-	return int(token)
+	return int(tok)
 }
 
 // Error handles error.
@@ -0,0 +1,242 @@
+package bibtex
+
+import (
+	"sort"
+	"strings"
+)
+
+// collapseFields are the fields whose values CollapseStrings replaces with
+// @string macros by default.
+var collapseFields = []string{
+	"journal", "journaltitle", "booktitle", "publisher", "series",
+	"institution", "organization", "school",
+}
+
+// ExpandStrings replaces every use of a @string macro in the fields,
+// preambles and macro definitions of bib by its value, so that values are
+// constants. Uses of the predefined month macros are kept, as bibliography
+// styles localize them. The macro definitions are kept; RemoveUnusedStrings
+// removes them.
+func (bib *BibTex) ExpandStrings() {
+	bib.rewriteValues(bib.expandString)
+}
+
+// expandString returns s with all but the predefined macros expanded.
+func (bib *BibTex) expandString(s BibString) BibString {
+	switch s := s.(type) {
+	case *BibVar:
+		if bib.isImplicitVar(s.Key, s) {
+			return s
+		}
+		return bib.expandString(s.Value)
+	case *BibComposite:
+		var parts BibComposite
+		for _, part := range *s {
+			part = bib.expandString(part)
+			if c, ok := part.(BibConst); ok && len(parts) > 0 {
+				if last, ok := parts[len(parts)-1].(BibConst); ok {
+					parts[len(parts)-1] = last + c
+					continue
+				}
+			}
+			parts = append(parts, part)
+		}
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		return &parts
+	case *BibConst:
+		return *s
+	}
+	return s
+}
+
+// CollapseStrings replaces constant values that occur at least minCount
+// times in the given fields (by default journal, journaltitle, booktitle,
+// publisher, series, institution, organization and school) with @string
+// macros, and returns the names of the macros it defined, sorted.
+//
+// Values equal to an existing macro use that macro, even if they occur fewer
+// than minCount times. New macros are named by the initials of the words of
+// the value other than stop words, keeping acronyms whole, e.g. jacm for
+// "Journal of the ACM", with a suffix if the name is taken.
+func (bib *BibTex) CollapseStrings(minCount int, fields ...string) []string {
+	if len(fields) == 0 {
+		fields = collapseFields
+	}
+	collapse := make(map[string]bool, len(fields))
+	for _, name := range fields {
+		collapse[strings.ToLower(name)] = true
+	}
+	macros := make(map[string]*BibVar) // Value -> macro.
+	for key, v := range bib.StringVar {
+		if _, ok := v.Value.(BibConst); ok && !bib.isImplicitVar(key, v) {
+			if m, ok := macros[v.String()]; !ok || key < m.Key {
+				macros[v.String()] = v
+			}
+		}
+	}
+	count := make(map[string]int)
+	bib.forEachCollapsible(collapse, func(value string) { count[value]++ })
+
+	var defined []string
+	values := make([]string, 0, len(count))
+	for value := range count {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		if _, ok := macros[value]; ok || count[value] < minCount {
+			continue
+		}
+		key := bib.newMacroName(value)
+		bib.AddStringVar(key, NewBibConst(value))
+		macros[value] = bib.StringVar[key]
+		defined = append(defined, key)
+	}
+	sort.Strings(defined)
+
+	for _, entry := range bib.Entries {
+		for name, value := range entry.Fields {
+			if c, ok := value.(BibConst); ok && collapse[strings.ToLower(name)] {
+				if v, ok := macros[string(c)]; ok {
+					entry.Fields[name] = v
+				}
+			}
+		}
+	}
+	return defined
+}
+
+// forEachCollapsible calls fn with each constant value of the given fields.
+func (bib *BibTex) forEachCollapsible(fields map[string]bool, fn func(string)) {
+	for _, entry := range bib.Entries {
+		for name, value := range entry.Fields {
+			if c, ok := value.(BibConst); ok && c != "" && fields[strings.ToLower(name)] {
+				fn(string(c))
+			}
+		}
+	}
+}
+
+// newMacroName returns an unused macro name for value.
+func (bib *BibTex) newMacroName(value string) string {
+	var initials strings.Builder
+	for _, w := range keyWords(value) {
+		switch {
+		case strings.ToUpper(w) == w && len(w) > 1: // Acronym.
+			initials.WriteString(w)
+		case !keyStopWords[strings.ToLower(w)]:
+			initials.WriteString(w[:1])
+		}
+	}
+	base := strings.ToLower(initials.String())
+	if base == "" || base[0] >= '0' && base[0] <= '9' {
+		base = "str" + base
+	}
+	taken := func(key string) bool {
+		_, defined := bib.StringVar[key]
+		_, predefined := bib.defaultVars[key]
+		return defined || predefined
+	}
+	key := base
+	for n := 0; taken(key); n++ {
+		key = base + keySuffix(n)
+	}
+	return key
+}
+
+// RemoveUnusedStrings removes the @string macros that are not used by any
+// entry or preamble (directly or through other macros), and returns their
+// names, sorted.
+func (bib *BibTex) RemoveUnusedStrings() []string {
+	used := NewBibTex()
+	for _, entry := range bib.Entries {
+		for _, value := range entry.Fields {
+			addStringVars(used, value)
+		}
+	}
+	for _, preamble := range bib.Preambles {
+		addStringVars(used, preamble)
+	}
+	var removed []string
+	for key := range bib.StringVar {
+		if _, ok := used.StringVar[key]; !ok {
+			removed = append(removed, key)
+			delete(bib.StringVar, key)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// ApplyStrings applies the @string macros of another bibliography, such as
+// a journal abbreviation list, to bib, and returns the number of field
+// values changed.
+//
+// The macros of macros replace the macros of bib with the same names, so
+// that existing uses get the new values, and constant values of the given
+// fields (by default those of CollapseStrings) equal to the value of a macro
+// of macros (ignoring runs of whitespace) are replaced by the macro.
+func (bib *BibTex) ApplyStrings(macros *BibTex, fields ...string) int {
+	if len(fields) == 0 {
+		fields = collapseFields
+	}
+	apply := make(map[string]bool, len(fields))
+	for _, name := range fields {
+		apply[strings.ToLower(name)] = true
+	}
+	byValue := make(map[string]*BibVar)
+	keys := make([]string, 0, len(macros.StringVar))
+	for key, v := range macros.StringVar {
+		if !macros.isImplicitVar(key, v) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		bib.AddStringVar(key, macros.StringVar[key].Value)
+		value := strings.Join(strings.Fields(macros.StringVar[key].String()), " ")
+		if _, ok := byValue[value]; !ok {
+			byValue[value] = bib.StringVar[key]
+		}
+	}
+	// Point uses of replaced macros at the new definitions.
+	bib.rewriteValues(func(s BibString) BibString {
+		return bib.relinkVars(s)
+	})
+
+	n := 0
+	for _, entry := range bib.Entries {
+		for name, value := range entry.Fields {
+			c, ok := value.(BibConst)
+			if !ok || !apply[strings.ToLower(name)] {
+				continue
+			}
+			if v, ok := byValue[strings.Join(strings.Fields(string(c)), " ")]; ok {
+				entry.Fields[name] = v
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// relinkVars returns s with its string variables replaced by the variables
+// of the same names in bib.
+func (bib *BibTex) relinkVars(s BibString) BibString {
+	return RewriteString(s, func(s BibString) BibString {
+		if v, ok := s.(*BibVar); ok && bib.StringVar[v.Key] != nil {
+			return bib.StringVar[v.Key]
+		}
+		return s
+	})
+}
+
+// rewriteValues replaces every field value, preamble and macro value of bib
+// by fn applied to it.
+func (bib *BibTex) rewriteValues(fn func(BibString) BibString) {
+	for _, loc := range bib.locations() {
+		loc.setValue(bib, fn(loc.value(bib)))
+	}
+}
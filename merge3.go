@@ -0,0 +1,688 @@
+package bibtex
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ConflictField is the field that records entry-level conflicts of
+// ThreeWayMerge, such as an entry deleted on one side and modified on the
+// other.
+const ConflictField = "mergeconflict"
+
+// Conflict markers written into conflicting field values by ThreeWayMerge.
+const (
+	conflictOurs   = "<<<<<<< ours"
+	conflictSep    = "======="
+	conflictTheirs = ">>>>>>> theirs"
+)
+
+// MergeConflict is a conflict found by ThreeWayMerge. Key is the cite key
+// of the entry, or empty for a conflicting @string macro named Field; Field
+// is ConflictField for entry-level conflicts.
+type MergeConflict struct {
+	Key   string
+	Field string
+}
+
+func (c MergeConflict) String() string {
+	if c.Key == "" {
+		return "@string{" + c.Field + "}"
+	}
+	return c.Key + "." + c.Field
+}
+
+// ThreeWayMerge merges the changes from base to ours and from base to
+// theirs, field by field.
+//
+// Entries are paired by cite key and fields by case-insensitive name, so
+// concurrent edits of different entries or different fields of the same
+// entry never conflict. If both sides change a field differently, the
+// merged field value holds both versions between conflict markers (the
+// value stays valid BibTeX) and the conflict is returned. Entry-level
+// conflicts (an entry deleted on one side and changed on the other, or a
+// type changed differently) keep the changed entry and are described in
+// its ConflictField field. @string macros are merged like fields.
+//
+// Entries of a cite key used more than once are not merged field by field.
+// If both sides change them, the entries of ours are kept, followed by the
+// other entries of theirs marked in ConflictField, and the cite key is a
+// conflict.
+//
+// The merged entries are in the order of ours, with entries added by
+// theirs after the entry that precedes them in theirs.
+func ThreeWayMerge(base, ours, theirs *BibTex) (*BibTex, []MergeConflict) {
+	m := mergeBibs(base, ours, theirs)
+	merged := NewBibTex()
+	merged.Entries = append(merged.Entries, m.head...)
+	for _, entry := range ours.Entries {
+		merged.Entries = append(merged.Entries, m.at[entry]...)
+	}
+	merged.Entries = append(merged.Entries, m.tail...)
+	for key, value := range m.strings {
+		merged.AddStringVar(key, value)
+	}
+	merged.Preambles = m.preambles
+	return merged, m.conflicts
+}
+
+// bibMerge is the result of merging three bibliographies, with the merged
+// entries placed relative to the entries of ours.
+type bibMerge struct {
+	head      []*BibEntry               // Entries before the first entry of ours.
+	at        map[*BibEntry][]*BibEntry // Entries in place of and after each entry of ours.
+	tail      []*BibEntry               // Entries after the last entry of ours.
+	strings   map[string]BibString      // Merged @string macros.
+	preambles []BibString
+	conflicts []MergeConflict // Sorted.
+}
+
+func mergeBibs(base, ours, theirs *BibTex) *bibMerge {
+	m := &bibMerge{at: make(map[*BibEntry][]*BibEntry), strings: make(map[string]BibString)}
+
+	baseByKey, oursByKey, theirsByKey := entryLists(base), entryLists(ours), entryLists(theirs)
+	entries := make(map[string][]*BibEntry)
+	for key := range union(oursByKey, theirsByKey) {
+		merged, conflict := mergeKey(baseByKey[key], oursByKey[key], theirsByKey[key])
+		entries[key] = merged
+		for _, field := range conflict {
+			m.conflicts = append(m.conflicts, MergeConflict{Key: key, Field: field})
+		}
+	}
+
+	// Entries of ours take their own place, other entries with the same key
+	// follow the last entry of ours with the key.
+	kept := make(map[*BibEntry]bool)
+	for _, list := range oursByKey {
+		for _, entry := range list {
+			kept[entry] = true
+		}
+	}
+	for _, entry := range ours.Entries {
+		list := entries[entry.CiteName]
+		if containsPtr(list, entry) {
+			m.at[entry] = append(m.at[entry], entry)
+		}
+		if last := oursByKey[entry.CiteName]; last[len(last)-1] == entry {
+			for _, e := range list {
+				if !kept[e] {
+					m.at[entry] = append(m.at[entry], e)
+				}
+			}
+		}
+	}
+
+	// Keys only in theirs follow the entry that precedes them in theirs, or
+	// go last if it was deleted in ours.
+	after := make(map[string][]string) // Predecessor key -> keys.
+	prev := ""
+	for _, entry := range theirs.Entries {
+		if _, ok := oursByKey[entry.CiteName]; !ok && len(entries[entry.CiteName]) > 0 {
+			after[prev] = append(after[prev], entry.CiteName)
+		}
+		prev = entry.CiteName
+	}
+	seen := make(map[string]bool)
+	var place func(dst *[]*BibEntry, key string)
+	place = func(dst *[]*BibEntry, key string) {
+		for _, k := range after[key] {
+			if !seen[k] {
+				seen[k] = true
+				*dst = append(*dst, entries[k]...)
+				place(dst, k)
+			}
+		}
+	}
+	place(&m.head, "")
+	for _, entry := range ours.Entries {
+		if last := oursByKey[entry.CiteName]; last[len(last)-1] == entry {
+			list := m.at[entry]
+			place(&list, entry.CiteName)
+			m.at[entry] = list
+		}
+	}
+	for _, entry := range theirs.Entries {
+		if _, ok := oursByKey[entry.CiteName]; !ok && !seen[entry.CiteName] {
+			seen[entry.CiteName] = true
+			m.tail = append(m.tail, entries[entry.CiteName]...)
+		}
+	}
+
+	baseVars, oursVars, theirsVars := stringVars(base), stringVars(ours), stringVars(theirs)
+	for key := range union(oursVars, theirsVars) {
+		value, ok, conflict := mergeValues(baseVars[key], oursVars[key], theirsVars[key])
+		if conflict {
+			m.conflicts = append(m.conflicts, MergeConflict{Field: key})
+		}
+		if ok {
+			m.strings[key] = value
+		}
+	}
+	m.preambles = mergePreambles(base.Preambles, ours.Preambles, theirs.Preambles)
+	sort.Slice(m.conflicts, func(i, j int) bool { return m.conflicts[i].String() < m.conflicts[j].String() })
+	return m
+}
+
+// entriesByKey maps cite keys to the first entry with the key.
+func entriesByKey(bib *BibTex) map[string]*BibEntry {
+	m := make(map[string]*BibEntry, len(bib.Entries))
+	for _, entry := range bib.Entries {
+		if _, ok := m[entry.CiteName]; !ok {
+			m[entry.CiteName] = entry
+		}
+	}
+	return m
+}
+
+// entryLists maps cite keys to the entries with the key, in order.
+func entryLists(bib *BibTex) map[string][]*BibEntry {
+	m := make(map[string][]*BibEntry, len(bib.Entries))
+	for _, entry := range bib.Entries {
+		m[entry.CiteName] = append(m[entry.CiteName], entry)
+	}
+	return m
+}
+
+func containsPtr(list []*BibEntry, entry *BibEntry) bool {
+	for _, e := range list {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeKey merges the entries with a cite key, and returns the merged
+// entries and the names of conflicting fields. Entries of a key used more
+// than once on any side are merged as a whole, see ThreeWayMerge.
+func mergeKey(base, ours, theirs []*BibEntry) ([]*BibEntry, []string) {
+	if len(base) <= 1 && len(ours) <= 1 && len(theirs) <= 1 {
+		entry, conflicts := mergeEntries(first(base), first(ours), first(theirs))
+		if entry == nil {
+			return nil, conflicts
+		}
+		return []*BibEntry{entry}, conflicts
+	}
+	switch {
+	case sameEntries(ours, theirs), sameEntries(base, theirs):
+		return ours, nil
+	case sameEntries(base, ours):
+		return theirs, nil
+	}
+	merged := append([]*BibEntry{}, ours...)
+	for _, entry := range theirs {
+		if !containsEntry(ours, entry) {
+			merged = append(merged, withConflict(entry, "duplicate cite key in theirs"))
+		}
+	}
+	return merged, []string{ConflictField}
+}
+
+func first(entries []*BibEntry) *BibEntry {
+	if len(entries) == 0 {
+		return nil
+	}
+	return entries[0]
+}
+
+// sameEntries returns true if a and b have the same entries in order.
+func sameEntries(a, b []*BibEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameEntry(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsEntry(list []*BibEntry, entry *BibEntry) bool {
+	for _, e := range list {
+		if sameEntry(e, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// withConflict returns a copy of entry with the conflict described in
+// ConflictField.
+func withConflict(entry *BibEntry, conflict string) *BibEntry {
+	c := &BibEntry{Type: entry.Type, CiteName: entry.CiteName, Fields: make(map[string]BibString, len(entry.Fields)+1)}
+	for name, value := range entry.Fields {
+		c.Fields[name] = value
+	}
+	c.Fields[ConflictField] = NewBibConst(conflict)
+	return c
+}
+
+// stringVars returns the explicitly defined string variables of bib.
+func stringVars(bib *BibTex) map[string]BibString {
+	m := make(map[string]BibString, len(bib.StringVar))
+	for key, v := range bib.StringVar {
+		if !bib.isImplicitVar(key, v) {
+			m[key] = v.Value
+		}
+	}
+	return m
+}
+
+func union[V any](a, b map[string]V) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return keys
+}
+
+// mergeEntries merges two versions of an entry, any of which may be nil
+// (absent), and returns the merged entry (nil if deleted) and the names of
+// conflicting fields.
+func mergeEntries(base, ours, theirs *BibEntry) (*BibEntry, []string) {
+	switch {
+	case sameEntry(ours, theirs):
+		return ours, nil
+	case sameEntry(base, ours):
+		return theirs, nil
+	case sameEntry(base, theirs):
+		return ours, nil
+	case ours == nil || theirs == nil: // Deleted on one side, changed on the other.
+		entry, side := ours, "theirs"
+		if ours == nil {
+			entry, side = theirs, "ours"
+		}
+		return withConflict(entry, "entry deleted in "+side), []string{ConflictField}
+	}
+
+	merged := &BibEntry{Type: ours.Type, CiteName: ours.CiteName, Fields: map[string]BibString{}}
+	var conflicts []string
+	if base == nil || base.Type != ours.Type && base.Type != theirs.Type {
+		if ours.Type != theirs.Type {
+			merged.Fields[ConflictField] = NewBibConst(fmt.Sprintf("type is %s in ours and %s in theirs", ours.Type, theirs.Type))
+			conflicts = append(conflicts, ConflictField)
+		}
+	} else if base.Type == ours.Type {
+		merged.Type = theirs.Type
+	}
+
+	baseFields, oursFields, theirsFields := foldedFields(base), foldedFields(ours), foldedFields(theirs)
+	for name := range union(oursFields, theirsFields) {
+		value, ok, conflict := mergeValues(baseFields[name].value, oursFields[name].value, theirsFields[name].value)
+		if !ok {
+			continue
+		}
+		fieldName := oursFields[name].name
+		if fieldName == "" {
+			fieldName = theirsFields[name].name
+		}
+		merged.Fields[fieldName] = value
+		if conflict {
+			conflicts = append(conflicts, fieldName)
+		}
+	}
+	return merged, conflicts
+}
+
+// sameEntry returns true if a and b are both absent, or have the same type
+// and fields.
+func sameEntry(a, b *BibEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Type != b.Type || len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	fa, fb := foldedFields(a), foldedFields(b)
+	for name, f := range fa {
+		if !sameValue(f.value, fb[name].value) {
+			return false
+		}
+	}
+	return true
+}
+
+type namedValue struct {
+	name  string // Field name as written.
+	value BibString
+}
+
+// foldedFields returns the fields of entry by lowercase name.
+func foldedFields(entry *BibEntry) map[string]namedValue {
+	m := make(map[string]namedValue)
+	if entry == nil {
+		return m
+	}
+	for name, value := range entry.Fields {
+		m[strings.ToLower(name)] = namedValue{name: name, value: value}
+	}
+	return m
+}
+
+// sameValue compares values as written, ignoring runs of whitespace.
+func sameValue(a, b BibString) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return strings.Join(strings.Fields(rawFormat(a)), " ") == strings.Join(strings.Fields(rawFormat(b)), " ")
+}
+
+// mergeValues merges three versions of a value (nil if absent), and returns
+// the merged value, whether it is present and whether it is a conflict.
+func mergeValues(base, ours, theirs BibString) (BibString, bool, bool) {
+	switch {
+	case sameValue(ours, theirs):
+		return ours, ours != nil, false
+	case sameValue(base, ours):
+		return theirs, theirs != nil, false
+	case sameValue(base, theirs):
+		return ours, ours != nil, false
+	}
+	var buf strings.Builder
+	buf.WriteString(conflictOurs + "\n")
+	if ours != nil {
+		buf.WriteString(rawFormat(ours) + "\n")
+	}
+	buf.WriteString(conflictSep + "\n")
+	if theirs != nil {
+		buf.WriteString(rawFormat(theirs) + "\n")
+	}
+	buf.WriteString(conflictTheirs)
+	return NewBibConst(buf.String()), true, true
+}
+
+// mergePreambles keeps the preambles of ours, removes those removed by
+// theirs and adds those added by theirs.
+func mergePreambles(base, ours, theirs []BibString) []BibString {
+	merged := []BibString{}
+	for _, p := range ours {
+		if !containsValue(base, p) || containsValue(theirs, p) {
+			merged = append(merged, p)
+		}
+	}
+	for _, p := range theirs {
+		if !containsValue(base, p) && !containsValue(ours, p) {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+func containsValue(list []BibString, s BibString) bool {
+	for _, p := range list {
+		if sameValue(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ThreeWayMergeText merges three versions of a bib file like ThreeWayMerge,
+// and returns the merged file in the layout of ours. Text between items,
+// @comment items and the items of ours unchanged by the merge are kept as
+// written, entries taken from theirs keep their text, and the other merged
+// entries are written with their fields in the order of ours, then theirs.
+// Added @string macros and preambles follow the last ones of ours. Macros
+// that are not defined in the files, such as those of a .bst style, are
+// kept by name.
+func ThreeWayMergeText(base, ours, theirs io.Reader) ([]byte, []MergeConflict, error) {
+	var srcs [3]*bibSource
+	for i, r := range []io.Reader{base, ours, theirs} {
+		src, err := readSource(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		srcs[i] = src
+	}
+	m := mergeBibs(srcs[0].bib, srcs[1].bib, srcs[2].bib)
+	w := &mergeWriter{m: m, ours: srcs[1], texts: make(map[*BibEntry][]byte), order: make(map[string][]string)}
+	ordered := make(map[[2]string]bool) // Cite key and field name.
+	for _, src := range srcs[1:] {
+		for _, item := range src.items {
+			if item.entry == nil {
+				continue
+			}
+			key := item.entry.CiteName
+			w.texts[item.entry] = src.text[item.start:item.end]
+			for _, name := range item.fields {
+				if !ordered[[2]string{key, name}] {
+					ordered[[2]string{key, name}] = true
+					w.order[key] = append(w.order[key], name)
+				}
+			}
+		}
+	}
+	return w.write(), m.conflicts, nil
+}
+
+// bibSource is a bib file parsed item by item, keeping the text of each.
+type bibSource struct {
+	text  []byte
+	bib   *BibTex
+	items []sourceItem
+}
+
+// sourceItem is an entry, @string or @preamble of a bibSource.
+type sourceItem struct {
+	start, end int       // Offsets of the text of the item.
+	entry      *BibEntry // Entry, or nil.
+	fields     []string  // Field names of the entry, in order.
+	key        string    // Key of a @string, or empty.
+	value      BibString // Value of a @string or @preamble.
+}
+
+// readSource parses r like Parse, item by item. Undefined macros, such as
+// those of a .bst style, are kept as in lenient mode.
+func readSource(r io.Reader) (*bibSource, error) {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	config := newParseConfig()
+	config.mode = lenientMode
+	src := &bibSource{text: text, bib: (&lexer{config: config}).newBibTex()}
+	items := &itemReader{r: bufio.NewReader(bytes.NewReader(text)), pos: tokenPos{Lines: []int{}}}
+	for {
+		_, pos, err := items.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		item := sourceItem{start: int(items.start), end: int(items.offset)}
+		entries, preambles := len(src.bib.Entries), len(src.bib.Preambles)
+		l := newLexer(bytes.NewReader(text[item.start:item.end]), config)
+		l.scanner.pos = pos
+		l.bib = src.bib
+		bibtexParse(l)
+		if err := l.err(); err != nil {
+			return nil, err
+		}
+		switch {
+		case len(src.bib.Entries) > entries:
+			item.entry = src.bib.Entries[entries]
+			for _, t := range l.lastTags {
+				item.fields = append(item.fields, config.fieldCase.apply(t.key))
+			}
+		case len(src.bib.Preambles) > preambles:
+			item.value = src.bib.Preambles[preambles]
+		default:
+			item.key = stringKey(text[item.start:item.end])
+			v, ok := src.bib.StringVar[item.key]
+			if !ok {
+				continue
+			}
+			item.value = v.Value
+		}
+		src.items = append(src.items, item)
+	}
+	return src, nil
+}
+
+// stringKey returns the key of a @string item.
+func stringKey(item []byte) string {
+	i, j := bytes.IndexAny(item, "{("), bytes.IndexByte(item, '=')
+	if i < 0 || j < i {
+		return ""
+	}
+	return strings.TrimSpace(string(item[i+1 : j]))
+}
+
+// mergeWriter writes a bibMerge in the layout of ours.
+type mergeWriter struct {
+	buf   bytes.Buffer
+	sep   string // Space between entries, as before the current item.
+	m     *bibMerge
+	ours  *bibSource
+	texts map[*BibEntry][]byte // Text of the entries of ours and theirs.
+	order map[string][]string  // Field order by cite key.
+}
+
+func (w *mergeWriter) write() []byte {
+	firstEntry, lastEntry, lastString, lastPreamble := -1, -1, -1, -1
+	var oursPreambles []BibString
+	oursStrings := make(map[string]bool)
+	for i, item := range w.ours.items {
+		switch {
+		case item.entry != nil:
+			if firstEntry < 0 {
+				firstEntry = i
+			}
+			lastEntry = i
+		case item.key != "":
+			lastString = i
+			oursStrings[item.key] = true
+		default:
+			lastPreamble = i
+			oursPreambles = append(oursPreambles, item.value)
+		}
+	}
+	var strs []string
+	for key := range w.m.strings {
+		if !oursStrings[key] {
+			strs = append(strs, fmt.Sprintf("@string{%s = %s}", key, rawFormat(w.m.strings[key])))
+		}
+	}
+	sort.Strings(strs)
+	var preambles []string
+	for _, p := range w.m.preambles {
+		if !containsValue(oursPreambles, p) {
+			preambles = append(preambles, fmt.Sprintf("@preamble{%s}", formatWith(p, quotedFormat)))
+		}
+	}
+
+	text := w.ours.text
+	w.sep = "\n\n"
+	if len(w.ours.items) == 0 {
+		w.buf.Write(bytes.TrimRight(text, " \t\r\n"))
+		w.writeLines(0, append(strs, preambles...))
+		w.writeEntries(0, w.m.head)
+		w.writeEntries(0, w.m.tail)
+		if w.buf.Len() > 0 {
+			w.buf.WriteString("\n")
+		}
+		return w.buf.Bytes()
+	}
+	pos := 0
+	for i, item := range w.ours.items {
+		gap := text[pos:item.start]
+		if len(bytes.TrimSpace(gap)) == 0 && bytes.ContainsRune(gap, '\n') {
+			w.sep = string(gap)
+		}
+		w.buf.Write(gap)
+		pos = item.end
+		if i == 0 {
+			// Added macros and preambles without ones of ours to follow.
+			var top []string
+			if lastString < 0 {
+				top = append(top, strs...)
+			}
+			if lastPreamble < 0 {
+				top = append(top, preambles...)
+			}
+			if len(top) > 0 {
+				w.buf.WriteString(strings.Join(top, "\n") + "\n\n")
+			}
+		}
+		start := w.buf.Len()
+		switch {
+		case item.entry != nil:
+			if i == firstEntry {
+				w.writeEntries(start, w.m.head)
+			}
+			w.writeEntries(start, w.m.at[item.entry])
+			if i == lastEntry {
+				w.writeEntries(start, w.m.tail)
+			}
+		case item.key != "":
+			if value, ok := w.m.strings[item.key]; ok && sameValue(value, item.value) {
+				w.buf.Write(text[item.start:item.end])
+			} else if ok {
+				fmt.Fprintf(&w.buf, "@string{%s = %s}", item.key, rawFormat(value))
+			}
+			if i == lastString {
+				w.writeLines(start, strs)
+			}
+		default:
+			if containsValue(w.m.preambles, item.value) {
+				w.buf.Write(text[item.start:item.end])
+			}
+			if i == lastPreamble {
+				w.writeLines(start, preambles)
+			}
+		}
+		if w.buf.Len() == start { // Removed, with the space before it.
+			w.buf.Truncate(len(bytes.TrimRight(w.buf.Bytes(), " \t\r\n")))
+		}
+	}
+	if firstEntry < 0 {
+		w.writeEntries(0, w.m.head)
+		w.writeEntries(0, w.m.tail)
+	}
+	w.buf.Write(text[pos:])
+	return w.buf.Bytes()
+}
+
+// writeEntries writes entries separated by sep from what was written since
+// start.
+func (w *mergeWriter) writeEntries(start int, entries []*BibEntry) {
+	for _, entry := range entries {
+		if w.buf.Len() > start {
+			w.buf.WriteString(w.sep)
+		}
+		w.buf.Write(w.entryText(entry))
+	}
+}
+
+// writeLines writes lines separated by newlines from what was written
+// since start.
+func (w *mergeWriter) writeLines(start int, lines []string) {
+	for _, line := range lines {
+		if w.buf.Len() > start {
+			w.buf.WriteString("\n")
+		}
+		w.buf.WriteString(line)
+	}
+}
+
+// entryText returns the text of entry as written in ours or theirs, or
+// formatted like Encoder with the field order of its cite key.
+func (w *mergeWriter) entryText(entry *BibEntry) []byte {
+	if text, ok := w.texts[entry]; ok {
+		return text
+	}
+	config := defaultPrettyStringConfig
+	WithKeyOrder(w.order[entry.CiteName])(&config)
+	config.format = rawFormat
+	var buf bytes.Buffer
+	entry.prettyStringAppend(&buf, config)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
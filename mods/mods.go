@@ -0,0 +1,583 @@
+// Package mods converts BibTeX entries to MODS (Metadata Object Description
+// Schema) version 3 XML records.
+//
+// The mapping follows the Library of Congress BibTeX-to-MODS guidelines:
+// titles go to titleInfo, people to name elements with a MARC relator role,
+// publication details to originInfo and the containing journal, book or
+// proceedings to a relatedItem of type "host".
+//
+// See https://www.loc.gov/standards/mods/ for the schema.
+package mods // import "github.com/nickng/bibtex/mods"
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/nickng/bibtex"
+)
+
+const (
+	// Namespace is the MODS version 3 XML namespace.
+	Namespace = "http://www.loc.gov/mods/v3"
+	// SchemaLocation is the location of the MODS 3.8 XML schema.
+	SchemaLocation = Namespace + " http://www.loc.gov/standards/mods/v3/mods-3-8.xsd"
+	// Version is the MODS version written to records.
+	Version = "3.8"
+)
+
+// Collection is a modsCollection document.
+type Collection struct {
+	XMLName        xml.Name `xml:"http://www.loc.gov/mods/v3 modsCollection"`
+	XSI            string   `xml:"xmlns:xsi,attr,omitempty"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr,omitempty"`
+	Records        []*MODS  `xml:"mods"`
+}
+
+// MODS is a single mods record.
+type MODS struct {
+	XMLName        xml.Name      `xml:"http://www.loc.gov/mods/v3 mods"`
+	ID             string        `xml:"ID,attr,omitempty"`
+	Version        string        `xml:"version,attr,omitempty"`
+	TitleInfo      []TitleInfo   `xml:"titleInfo"`
+	Name           []Name        `xml:"name"`
+	TypeOfResource string        `xml:"typeOfResource,omitempty"`
+	Genre          []Genre       `xml:"genre"`
+	OriginInfo     *OriginInfo   `xml:"originInfo"`
+	Language       []Language    `xml:"language"`
+	Abstract       string        `xml:"abstract,omitempty"`
+	Note           []string      `xml:"note"`
+	Subject        []Subject     `xml:"subject"`
+	RelatedItem    []RelatedItem `xml:"relatedItem"`
+	Identifier     []Identifier  `xml:"identifier"`
+	Location       *Location     `xml:"location"`
+	Part           *Part         `xml:"part"`
+	RecordInfo     *RecordInfo   `xml:"recordInfo"`
+}
+
+// TitleInfo is a title, optionally split into subtitle and part number.
+type TitleInfo struct {
+	Type       string `xml:"type,attr,omitempty"`
+	NonSort    string `xml:"nonSort,omitempty"`
+	Title      string `xml:"title"`
+	SubTitle   string `xml:"subTitle,omitempty"`
+	PartNumber string `xml:"partNumber,omitempty"`
+}
+
+// Name is a personal or corporate name with its roles.
+type Name struct {
+	Type     string     `xml:"type,attr,omitempty"`
+	NamePart []NamePart `xml:"namePart"`
+	Role     []Role     `xml:"role"`
+}
+
+// NamePart is part of a name, typed as "given", "family" or
+// "termsOfAddress", or untyped for a full corporate name.
+type NamePart struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// Role is the relation of a name to the resource.
+type Role struct {
+	RoleTerm []RoleTerm `xml:"roleTerm"`
+}
+
+// RoleTerm is a textual or coded role, e.g. "author" or "aut".
+type RoleTerm struct {
+	Type      string `xml:"type,attr,omitempty"`
+	Authority string `xml:"authority,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+// Genre describes the intellectual category of the resource.
+type Genre struct {
+	Authority string `xml:"authority,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+// OriginInfo holds publication, creation and edition information.
+type OriginInfo struct {
+	Place        []Place `xml:"place"`
+	Publisher    string  `xml:"publisher,omitempty"`
+	DateIssued   string  `xml:"dateIssued,omitempty"`
+	DateCaptured string  `xml:"dateCaptured,omitempty"`
+	Edition      string  `xml:"edition,omitempty"`
+	Issuance     string  `xml:"issuance,omitempty"`
+}
+
+// Place is a place of publication.
+type Place struct {
+	PlaceTerm PlaceTerm `xml:"placeTerm"`
+}
+
+// PlaceTerm is the textual name of a place.
+type PlaceTerm struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// Language is the language of the resource.
+type Language struct {
+	LanguageTerm LanguageTerm `xml:"languageTerm"`
+}
+
+// LanguageTerm is a textual language name.
+type LanguageTerm struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// Subject holds a topical subject term.
+type Subject struct {
+	Topic []string `xml:"topic"`
+}
+
+// RelatedItem is another resource related to this one, e.g. the host
+// journal of an article or the series of a book.
+type RelatedItem struct {
+	Type       string       `xml:"type,attr,omitempty"`
+	TitleInfo  []TitleInfo  `xml:"titleInfo"`
+	Name       []Name       `xml:"name"`
+	Genre      []Genre      `xml:"genre"`
+	OriginInfo *OriginInfo  `xml:"originInfo"`
+	Identifier []Identifier `xml:"identifier"`
+	Part       *Part        `xml:"part"`
+}
+
+// Identifier is a standard identifier such as a DOI or ISBN.
+type Identifier struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// Location holds the URL of an online resource.
+type Location struct {
+	URL []URL `xml:"url"`
+}
+
+// URL is a URL with an optional access date.
+type URL struct {
+	DateLastAccessed string `xml:"dateLastAccessed,attr,omitempty"`
+	Value            string `xml:",chardata"`
+}
+
+// Part locates the resource within its host, e.g. volume and pages.
+type Part struct {
+	Detail []Detail `xml:"detail"`
+	Extent *Extent  `xml:"extent"`
+	Date   string   `xml:"date,omitempty"`
+}
+
+// Detail is a numbered division of the host, e.g. a volume or issue.
+type Detail struct {
+	Type   string `xml:"type,attr,omitempty"`
+	Number string `xml:"number"`
+}
+
+// Extent is a page range.
+type Extent struct {
+	Unit  string `xml:"unit,attr,omitempty"`
+	Start string `xml:"start,omitempty"`
+	End   string `xml:"end,omitempty"`
+	List  string `xml:"list,omitempty"`
+}
+
+// RecordInfo records the source of the metadata.
+type RecordInfo struct {
+	RecordIdentifier string `xml:"recordIdentifier,omitempty"`
+}
+
+// FromBibTex converts all entries of bib into a MODS collection.
+func FromBibTex(bib *bibtex.BibTex) *Collection {
+	c := &Collection{
+		XSI:            "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: SchemaLocation,
+	}
+	ids := make(map[string]bool)
+	for _, entry := range bib.Entries {
+		m := FromEntry(entry)
+		// IDs must be unique in the document; keys may collide after
+		// recordID or be duplicated.
+		for n := 2; m.ID != "" && ids[m.ID]; n++ {
+			m.ID = fmt.Sprintf("%s-%d", recordID(entry.CiteName), n)
+		}
+		ids[m.ID] = true
+		c.Records = append(c.Records, m)
+	}
+	return c
+}
+
+// Encode writes bib as an indented MODS collection document to w.
+func Encode(w io.Writer, bib *bibtex.BibTex) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(FromBibTex(bib)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// hostGenres maps entry types to the genre of their host item, for types
+// published inside another resource.
+var hostGenres = map[string]string{
+	"article":        "periodical",
+	"inproceedings":  "conference publication",
+	"conference":     "conference publication",
+	"incollection":   "book",
+	"inbook":         "book",
+	"inreference":    "book",
+	"suppbook":       "book",
+	"suppperiodical": "periodical",
+}
+
+// genres maps entry types to a MODS genre term.
+var genres = map[string]string{
+	"article":       "article",
+	"book":          "book",
+	"mvbook":        "book",
+	"booklet":       "book",
+	"collection":    "book",
+	"mvcollection":  "book",
+	"proceedings":   "conference publication",
+	"mvproceedings": "conference publication",
+	"inproceedings": "conference publication",
+	"conference":    "conference publication",
+	"incollection":  "book chapter",
+	"inbook":        "book chapter",
+	"manual":        "instruction",
+	"mastersthesis": "thesis",
+	"phdthesis":     "thesis",
+	"thesis":        "thesis",
+	"techreport":    "technical report",
+	"report":        "technical report",
+	"patent":        "patent",
+	"periodical":    "periodical",
+	"online":        "web site",
+	"software":      "software",
+	"dataset":       "dataset",
+	"unpublished":   "unpublished",
+}
+
+// FromEntry converts a single BibTeX entry into a MODS record.
+func FromEntry(entry *bibtex.BibEntry) *MODS {
+	f := fields(entry)
+	m := &MODS{
+		ID:             recordID(entry.CiteName),
+		Version:        Version,
+		TypeOfResource: "text",
+		RecordInfo:     &RecordInfo{RecordIdentifier: entry.CiteName},
+	}
+	switch entry.Type {
+	case "software":
+		m.TypeOfResource = "software, multimedia"
+	case "dataset":
+		m.TypeOfResource = "mixed material"
+	}
+	if genre, ok := genres[entry.Type]; ok {
+		m.Genre = append(m.Genre, Genre{Authority: "local", Value: genre})
+	}
+
+	if t := titleInfo(f["title"], f["subtitle"]); t != nil {
+		m.TitleInfo = append(m.TitleInfo, *t)
+	}
+	if f["shorttitle"] != "" {
+		m.TitleInfo = append(m.TitleInfo, TitleInfo{Type: "abbreviated", Title: f["shorttitle"]})
+	}
+
+	m.Name = append(m.Name, names(entry, "author", "author")...)
+	m.Name = append(m.Name, names(entry, "translator", "translator")...)
+	if entry.Type == "patent" {
+		m.Name = append(m.Name, names(entry, "holder", "patent holder")...)
+	}
+
+	hostGenre, hosted := hostGenres[entry.Type]
+	origin := &OriginInfo{
+		Publisher: firstOf(f, "publisher", "institution", "school", "organization"),
+		Edition:   f["edition"],
+	}
+	if loc := firstOf(f, "location", "address"); loc != "" {
+		origin.Place = []Place{{PlaceTerm: PlaceTerm{Type: "text", Value: loc}}}
+	}
+	if !hosted {
+		origin.DateIssued = date(f)
+		origin.Issuance = "monographic"
+		m.Name = append(m.Name, names(entry, "editor", "editor")...)
+	}
+	if entry.Type == "online" {
+		origin.DateCaptured = f["urldate"]
+	}
+	if len(origin.Place) > 0 || origin.Publisher != "" || origin.DateIssued != "" || origin.Edition != "" {
+		m.OriginInfo = origin
+	}
+
+	if hosted {
+		host := RelatedItem{
+			Type:  "host",
+			Genre: []Genre{{Authority: "local", Value: hostGenre}},
+			Part:  part(f),
+		}
+		if hostGenre == "periodical" {
+			host.TitleInfo = titleInfoList(firstOf(f, "journaltitle", "journal"), f["journalsubtitle"])
+			host.OriginInfo = &OriginInfo{Issuance: "continuing"}
+			if f["issn"] != "" {
+				host.Identifier = append(host.Identifier, Identifier{Type: "issn", Value: f["issn"]})
+			}
+		} else {
+			host.TitleInfo = titleInfoList(firstOf(f, "booktitle", "maintitle"), f["booksubtitle"])
+			host.Name = names(entry, "editor", "editor")
+			host.OriginInfo = &OriginInfo{Issuance: "monographic"}
+			if m.OriginInfo != nil {
+				host.OriginInfo.Publisher = m.OriginInfo.Publisher
+				host.OriginInfo.Place = m.OriginInfo.Place
+				host.OriginInfo.Edition = m.OriginInfo.Edition
+				m.OriginInfo = nil
+			}
+			if f["isbn"] != "" {
+				host.Identifier = append(host.Identifier, Identifier{Type: "isbn", Value: f["isbn"]})
+				delete(f, "isbn")
+			}
+		}
+		host.OriginInfo.DateIssued = date(f)
+		m.RelatedItem = append(m.RelatedItem, host)
+	} else if p := part(f); p != nil && (entry.Type == "book" || entry.Type == "collection") {
+		m.Part = p
+	}
+
+	if f["series"] != "" {
+		m.RelatedItem = append(m.RelatedItem, RelatedItem{
+			Type:      "series",
+			TitleInfo: []TitleInfo{{Title: f["series"]}},
+		})
+	}
+
+	for _, id := range []struct{ field, typ string }{
+		{"doi", "doi"}, {"isbn", "isbn"}, {"issn", "issn"},
+		{"eprint", "eprint"}, {"number", "patent number"},
+	} {
+		switch {
+		case f[id.field] == "":
+		case id.field == "issn" && hosted:
+		case id.field == "number" && entry.Type != "patent":
+		case id.field == "eprint" && strings.EqualFold(f["eprinttype"], "arxiv"):
+			m.Identifier = append(m.Identifier, Identifier{Type: "arxiv", Value: f["eprint"]})
+		default:
+			m.Identifier = append(m.Identifier, Identifier{Type: id.typ, Value: f[id.field]})
+		}
+	}
+	m.Identifier = append(m.Identifier, Identifier{Type: "citekey", Value: entry.CiteName})
+
+	if f["url"] != "" {
+		m.Location = &Location{URL: []URL{{Value: f["url"], DateLastAccessed: f["urldate"]}}}
+	}
+	if lang := firstOf(f, "language", "langid"); lang != "" {
+		m.Language = []Language{{LanguageTerm: LanguageTerm{Type: "text", Value: lang}}}
+	}
+	m.Abstract = f["abstract"]
+	if f["note"] != "" {
+		m.Note = append(m.Note, f["note"])
+	}
+	if f["keywords"] != "" {
+		var topics []string
+		for _, kw := range strings.Split(f["keywords"], ",") {
+			if kw = strings.TrimSpace(kw); kw != "" {
+				topics = append(topics, kw)
+			}
+		}
+		m.Subject = []Subject{{Topic: topics}}
+	}
+	return m
+}
+
+// recordID returns a cite key as an xs:ID, which must be an XML NCName:
+// characters not allowed in an NCName, such as the colons of knuth:ct:a, are
+// replaced by '_', and a key not starting with a letter or '_' is prefixed
+// with '_'. The cite key itself is kept in recordInfo/recordIdentifier.
+func recordID(key string) string {
+	if key == "" {
+		return ""
+	}
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case unicode.IsDigit(r) || r == '-' || r == '.' || unicode.In(r, unicode.Mn, unicode.Mc):
+			if i == 0 {
+				b.WriteRune('_')
+			}
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fields returns the decoded field values of entry keyed by lower-case name.
+func fields(entry *bibtex.BibEntry) map[string]string {
+	f := make(map[string]string, len(entry.Fields))
+	for key, val := range entry.Fields {
+		f[strings.ToLower(key)] = bibtex.DecodeTeX(val.String())
+	}
+	return f
+}
+
+// rawField returns the value of the field with the given lowercase name,
+// ignoring the case of the field names of entry.
+func rawField(entry *bibtex.BibEntry, name string) (bibtex.BibString, bool) {
+	for key, val := range entry.Fields {
+		if strings.ToLower(key) == name {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// firstOf returns the first non-empty field out of keys.
+func firstOf(f map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if f[key] != "" {
+			return f[key]
+		}
+	}
+	return ""
+}
+
+// date returns the publication date in W3CDTF form (year, year-month or
+// full date) from the date field or the year and month fields.
+func date(f map[string]string) string {
+	if f["date"] != "" {
+		return f["date"]
+	}
+	if f["year"] == "" {
+		return ""
+	}
+	if month := monthNumber(f["month"]); month != "" {
+		return f["year"] + "-" + month
+	}
+	return f["year"]
+}
+
+// monthNumber converts a month field value to a two-digit month number.
+func monthNumber(month string) string {
+	month = strings.ToLower(strings.TrimSpace(month))
+	if len(month) == 1 && month[0] >= '1' && month[0] <= '9' {
+		return "0" + month
+	}
+	if len(month) == 2 && (month == "10" || month == "11" || month == "12" || month[0] == '0') {
+		return month
+	}
+	for i, name := range []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"} {
+		if strings.HasPrefix(month, name) {
+			return fmt.Sprintf("%02d", i+1)
+		}
+	}
+	return ""
+}
+
+// nonSortArticles are leading articles moved to titleInfo/nonSort.
+var nonSortArticles = []string{"The ", "A ", "An "}
+
+// titleInfo returns a titleInfo for title, or nil if there is no title.
+func titleInfo(title, subtitle string) *TitleInfo {
+	if title == "" {
+		return nil
+	}
+	t := &TitleInfo{Title: title, SubTitle: subtitle}
+	for _, article := range nonSortArticles {
+		if strings.HasPrefix(title, article) && len(title) > len(article) {
+			t.NonSort, t.Title = article, title[len(article):]
+			break
+		}
+	}
+	return t
+}
+
+func titleInfoList(title, subtitle string) []TitleInfo {
+	if t := titleInfo(title, subtitle); t != nil {
+		return []TitleInfo{*t}
+	}
+	return nil
+}
+
+// marcRelators maps role names to MARC relator codes.
+var marcRelators = map[string]string{
+	"author":        "aut",
+	"editor":        "edt",
+	"translator":    "trl",
+	"patent holder": "pth",
+}
+
+// names converts the name list in field into MODS names with role.
+func names(entry *bibtex.BibEntry, field, role string) []Name {
+	val, ok := rawField(entry, field)
+	if !ok {
+		return nil
+	}
+	roleElem := Role{RoleTerm: []RoleTerm{
+		{Type: "text", Authority: "marcrelator", Value: role},
+		{Type: "code", Authority: "marcrelator", Value: marcRelators[role]},
+	}}
+	var result []Name
+	for _, n := range bibtex.ParseNames(val.String()) {
+		if n.IsOthers() {
+			continue
+		}
+		name := Name{Role: []Role{roleElem}}
+		if n.First == "" && n.Von == "" && strings.HasPrefix(n.Last, "{") {
+			// A fully braced name is a corporate name.
+			name.Type = "corporate"
+			name.NamePart = []NamePart{{Value: bibtex.DecodeTeX(n.Last)}}
+		} else {
+			name.Type = "personal"
+			family := strings.TrimSpace(n.Von + " " + n.Last)
+			if n.First != "" {
+				name.NamePart = append(name.NamePart, NamePart{Type: "given", Value: bibtex.DecodeTeX(n.First)})
+			}
+			name.NamePart = append(name.NamePart, NamePart{Type: "family", Value: bibtex.DecodeTeX(family)})
+			if n.Jr != "" {
+				name.NamePart = append(name.NamePart, NamePart{Type: "termsOfAddress", Value: bibtex.DecodeTeX(n.Jr)})
+			}
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+// part returns the volume, issue and page details of f, or nil if none.
+func part(f map[string]string) *Part {
+	p := &Part{}
+	if f["volume"] != "" {
+		p.Detail = append(p.Detail, Detail{Type: "volume", Number: f["volume"]})
+	}
+	if issue := firstOf(f, "number", "issue"); issue != "" && f["journaltitle"]+f["journal"] != "" {
+		p.Detail = append(p.Detail, Detail{Type: "issue", Number: issue})
+	}
+	if f["chapter"] != "" {
+		p.Detail = append(p.Detail, Detail{Type: "chapter", Number: f["chapter"]})
+	}
+	if pages := f["pages"]; pages != "" {
+		p.Extent = &Extent{Unit: "pages"}
+		start, end, found := strings.Cut(pages, "–")
+		if !found {
+			start, end, found = strings.Cut(pages, "-")
+		}
+		if found && !strings.ContainsAny(end, ",") {
+			p.Extent.Start, p.Extent.End = strings.TrimSpace(start), strings.TrimSpace(end)
+		} else if found || strings.Contains(pages, ",") {
+			p.Extent.List = pages
+		} else {
+			p.Extent.Start = pages
+		}
+	}
+	if len(p.Detail) == 0 && p.Extent == nil {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,134 @@
+package mods
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/nickng/bibtex"
+)
+
+func parseExamples(t *testing.T) *bibtex.BibTex {
+	t.Helper()
+	b, err := os.ReadFile("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib, err := bibtex.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bib
+}
+
+// Tests that the whole example corpus encodes to well-formed XML that decodes
+// back into the same number of records.
+func TestEncodeExamples(t *testing.T) {
+	bib := parseExamples(t)
+	var buf bytes.Buffer
+	if err := Encode(&buf, bib); err != nil {
+		t.Fatal(err)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+	}
+	var c Collection
+	if err := xml.Unmarshal(buf.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := len(bib.Entries), len(c.Records); want != got {
+		t.Errorf("Expecting %d records but got %d", want, got)
+	}
+	// ID is an xs:ID: a unique NCName.
+	ncName := regexp.MustCompile(`^[\pL_][\pL\pN\pM._-]*$`)
+	ids := make(map[string]bool)
+	for _, m := range c.Records {
+		if !ncName.MatchString(m.ID) || ids[m.ID] {
+			t.Errorf("Expecting a unique NCName ID but got %q", m.ID)
+		}
+		ids[m.ID] = true
+	}
+	for key, want := range map[string]string{"aristotle:anima": "aristotle_anima", "knuth:ct:a": "knuth_ct_a", "1984": "_1984"} {
+		if got := recordID(key); want != got {
+			t.Errorf("Expecting ID %q for %q but got %q", want, key, got)
+		}
+	}
+}
+
+func TestArticle(t *testing.T) {
+	bib := parseExamples(t)
+	var m *MODS
+	for _, entry := range bib.Entries {
+		if entry.CiteName == "aksin" {
+			m = FromEntry(entry)
+		}
+	}
+	if m == nil {
+		t.Fatal("entry aksin not found")
+	}
+	if want, got := 7, len(m.Name); want != got {
+		t.Fatalf("Expecting %d names but got %d", want, got)
+	}
+	if want, got := "Özge", m.Name[0].NamePart[0].Value; want != got {
+		t.Errorf("Expecting given name %q but got %q", want, got)
+	}
+	if want, got := "author", m.Name[0].Role[0].RoleTerm[0].Value; want != got {
+		t.Errorf("Expecting role %q but got %q", want, got)
+	}
+	if len(m.RelatedItem) != 1 || m.RelatedItem[0].Type != "host" {
+		t.Fatalf("Expecting a host relatedItem but got %+v", m.RelatedItem)
+	}
+	host := m.RelatedItem[0]
+	if want, got := "J. Organomet. Chem.", host.TitleInfo[0].Title; want != got {
+		t.Errorf("Expecting host title %q but got %q", want, got)
+	}
+	if want, got := "3027", host.Part.Extent.Start; want != got {
+		t.Errorf("Expecting start page %q but got %q", want, got)
+	}
+	if want, got := "2006", host.OriginInfo.DateIssued; want != got {
+		t.Errorf("Expecting date %q but got %q", want, got)
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	entry := bibtex.NewBibEntry("book", "b")
+	entry.AddField("title", bibtex.NewBibConst("The Book"))
+	entry.AddField("isbn", bibtex.NewBibConst("978-0-201-89683-1"))
+	entry.AddField("doi", bibtex.NewBibConst("10.1000/xyz"))
+	m := FromEntry(entry)
+	if want, got := "The ", m.TitleInfo[0].NonSort; want != got {
+		t.Errorf("Expecting nonSort %q but got %q", want, got)
+	}
+	ids := map[string]string{}
+	for _, id := range m.Identifier {
+		ids[id.Type] = id.Value
+	}
+	if ids["isbn"] != "978-0-201-89683-1" || ids["doi"] != "10.1000/xyz" {
+		t.Errorf("Unexpected identifiers %v", ids)
+	}
+}
+
+func TestFieldCase(t *testing.T) {
+	entry := bibtex.NewBibEntry("book", "b")
+	entry.AddField("Title", bibtex.NewBibConst("The Book"))
+	entry.AddField("Author", bibtex.NewBibConst("Knuth, Donald E."))
+	entry.AddField("EDITOR", bibtex.NewBibConst("Lamport, Leslie"))
+	m := FromEntry(entry)
+	if want, got := 2, len(m.Name); want != got {
+		t.Fatalf("Expecting %d names but got %d", want, got)
+	}
+	if want, got := "Knuth", m.Name[0].NamePart[1].Value; want != got {
+		t.Errorf("Expecting family name %q but got %q", want, got)
+	}
+	if want, got := "editor", m.Name[1].Role[0].RoleTerm[0].Value; want != got {
+		t.Errorf("Expecting role %q but got %q", want, got)
+	}
+}
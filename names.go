@@ -0,0 +1,204 @@
+package bibtex
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Name is a personal name split into the four parts used by BibTeX.
+//
+// The parts keep their TeX encoding; use DecodeTeX for display.
+type Name struct {
+	First string // Given names, e.g. "Donald E."
+	Von   string // Lower-case particle, e.g. "van der"
+	Last  string // Family name, e.g. "Knuth"
+	Jr    string // Suffix, e.g. "Jr."
+}
+
+// IsOthers returns true if the name is the "others" placeholder used to
+// truncate a name list (rendered as "et al.").
+func (n Name) IsOthers() bool {
+	return n.First == "" && n.Von == "" && n.Jr == "" && strings.EqualFold(n.Last, "others")
+}
+
+// String returns the name in the unambiguous "von Last, Jr, First" form.
+func (n Name) String() string {
+	var buf strings.Builder
+	if n.Von != "" {
+		buf.WriteString(n.Von + " ")
+	}
+	buf.WriteString(n.Last)
+	if n.Jr != "" {
+		buf.WriteString(", " + n.Jr)
+	}
+	if n.First != "" {
+		buf.WriteString(", " + n.First)
+	}
+	return buf.String()
+}
+
+// ParseNames splits a name list such as an author or editor field value
+// into names. Names are separated by "and" outside of braces.
+func ParseNames(s string) []Name {
+	var names []Name
+	for _, part := range splitTopLevel(s, isAndSeparator) {
+		if part = strings.TrimSpace(part); part != "" {
+			names = append(names, ParseName(part))
+		}
+	}
+	return names
+}
+
+// ParseName parses a single name written in any of the three BibTeX forms:
+// "First von Last", "von Last, First" or "von Last, Jr, First".
+func ParseName(s string) Name {
+	var parts []string
+	for _, part := range splitTopLevel(s, func(words []rune, i int) int {
+		if words[i] == ',' {
+			return 1
+		}
+		return 0
+	}) {
+		parts = append(parts, strings.TrimSpace(part))
+	}
+
+	var n Name
+	switch len(parts) {
+	case 1:
+		words := nameWords(parts[0])
+		if len(words) == 0 {
+			return n
+		}
+		// von starts at the first lower-case word and ends at the last one;
+		// the final word always belongs to Last.
+		first, last := -1, -1
+		for i, w := range words[:len(words)-1] {
+			if isVonWord(w) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			n.First = strings.Join(words[:len(words)-1], " ")
+			n.Last = words[len(words)-1]
+		} else {
+			n.First = strings.Join(words[:first], " ")
+			n.Von = strings.Join(words[first:last+1], " ")
+			n.Last = strings.Join(words[last+1:], " ")
+		}
+	default:
+		n.Von, n.Last = splitVonLast(nameWords(parts[0]))
+		if len(parts) == 2 {
+			n.First = parts[1]
+		} else {
+			n.Jr = parts[1]
+			n.First = strings.Join(parts[2:], ", ")
+		}
+	}
+	return n
+}
+
+// splitVonLast splits the words before the first comma into von and Last.
+// A von part runs from a lower-case first word to the last lower-case word,
+// leaving at least one word for Last.
+func splitVonLast(words []string) (von, last string) {
+	i := 0
+	if len(words) > 1 && isVonWord(words[0]) {
+		for j := len(words) - 2; j >= 0; j-- {
+			if isVonWord(words[j]) {
+				i = j + 1
+				break
+			}
+		}
+	}
+	return strings.Join(words[:i], " "), strings.Join(words[i:], " ")
+}
+
+// nameWords splits a name into whitespace-separated words outside braces.
+func nameWords(s string) []string {
+	var words []string
+	for _, w := range splitTopLevel(s, func(rs []rune, i int) int {
+		if isWhitespace(rs[i]) || rs[i] == '~' {
+			return 1
+		}
+		return 0
+	}) {
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// isVonWord returns true if the first letter of w at brace level 0 is
+// lower-case. Special characters such as {\"u} count by their letter.
+func isVonWord(w string) bool {
+	rs := []rune(w)
+	for i := 0; i < len(rs); i++ {
+		switch ch := rs[i]; {
+		case ch == '{':
+			if i+1 < len(rs) && rs[i+1] == '\\' {
+				// Special character: skip the command and look at its letter.
+				j := i + 2
+				for j < len(rs) && unicode.IsLetter(rs[j]) && rs[j] <= unicode.MaxASCII {
+					j++
+				}
+				for ; j < len(rs) && rs[j] != '}'; j++ {
+					if unicode.IsLetter(rs[j]) {
+						return unicode.IsLower(rs[j])
+					}
+				}
+			}
+			return false // Braced text is caseless.
+		case ch == '\\':
+			for i+1 < len(rs) && unicode.IsLetter(rs[i+1]) && rs[i+1] <= unicode.MaxASCII {
+				i++
+			}
+		case unicode.IsLetter(ch):
+			return unicode.IsLower(ch)
+		}
+	}
+	return false
+}
+
+// isAndSeparator matches " and " between names, case-insensitively.
+func isAndSeparator(rs []rune, i int) int {
+	if i == 0 || !isWhitespace(rs[i-1]) || i+4 > len(rs) {
+		return 0
+	}
+	if !strings.EqualFold(string(rs[i:i+3]), "and") || !isWhitespace(rs[i+3]) {
+		return 0
+	}
+	return 3
+}
+
+// splitTopLevel splits s at brace level 0 wherever sep matches, sep returning
+// the length of the separator at position i (or 0 if there is none).
+func splitTopLevel(s string, sep func(rs []rune, i int) int) []string {
+	rs := []rune(s)
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(rs); i++ {
+		switch rs[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '\\':
+			if i+1 < len(rs) && (rs[i+1] == '{' || rs[i+1] == '}') {
+				i++
+			}
+		default:
+			if depth == 0 {
+				if n := sep(rs, i); n > 0 {
+					parts = append(parts, string(rs[start:i]))
+					start = i + n
+					i += n - 1
+				}
+			}
+		}
+	}
+	return append(parts, string(rs[start:]))
+}
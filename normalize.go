@@ -0,0 +1,303 @@
+package bibtex
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Normalizer is a step of a normalization pipeline that cleans up the fields
+// of an entry in place. It returns an error for a value it cannot
+// normalize, which it leaves unchanged.
+type Normalizer func(entry *BibEntry) error
+
+// Normalizers are the built-in normalizers by name.
+var Normalizers = map[string]Normalizer{
+	"lowercase":    LowercaseFieldNames,
+	"space":        CollapseSpace,
+	"pages":        NormalizePages,
+	"doi":          NormalizeDOI,
+	"isbn":         NormalizeISBN,
+	"url":          NormalizeURL,
+	"months":       MonthsToMacros,
+	"monthnumbers": MonthsToNumbers,
+}
+
+// DefaultNormalizers are the names of the normalizers run by default, in
+// order.
+var DefaultNormalizers = []string{"lowercase", "space", "pages", "doi", "isbn", "url", "months"}
+
+// Pipeline returns a normalizer that runs steps in order. All steps run even
+// if some fail, and the errors are joined.
+func Pipeline(steps ...Normalizer) Normalizer {
+	return func(entry *BibEntry) error {
+		var errs []error
+		for _, step := range steps {
+			if err := step(entry); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// Normalize runs the normalizers steps on all entries of bib, and returns
+// the joined errors of all entries, prefixed by their cite keys.
+func (bib *BibTex) Normalize(steps ...Normalizer) error {
+	pipeline := Pipeline(steps...)
+	var errs []error
+	for _, entry := range bib.Entries {
+		if err := pipeline(entry); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.CiteName, err))
+		}
+		bib.resolveMacros(entry)
+	}
+	return errors.Join(errs...)
+}
+
+// resolveMacros replaces the string variables that are field values of
+// entry, such as those added by MonthsToMacros, by the macros of bib with
+// the same names.
+func (bib *BibTex) resolveMacros(entry *BibEntry) {
+	for name, value := range entry.Fields {
+		v, ok := value.(*BibVar)
+		if !ok || bib.StringVar[v.Key] == v {
+			continue
+		}
+		if macro, ok := bib.StringVar[v.Key]; ok {
+			entry.Fields[name] = macro
+		} else if macro, ok := bib.getDefaultVar(v.Key); ok {
+			entry.Fields[name] = macro
+		}
+	}
+}
+
+// normalizeField replaces the constant value of the field with the given
+// lowercase name by fn applied to it. Values using string variables are
+// left unchanged.
+func normalizeField(entry *BibEntry, name string, fn func(string) (string, error)) error {
+	for key, value := range entry.Fields {
+		if strings.ToLower(key) != name {
+			continue
+		}
+		c, ok := value.(BibConst)
+		if !ok {
+			continue
+		}
+		normalized, err := fn(string(c))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		entry.Fields[key] = NewBibConst(normalized)
+	}
+	return nil
+}
+
+// LowercaseFieldNames lower-cases the field names of entry. A field is
+// kept as it is if its lowercase name is already taken.
+func LowercaseFieldNames(entry *BibEntry) error {
+	for key, value := range entry.Fields {
+		lower := strings.ToLower(key)
+		if _, taken := entry.Fields[lower]; lower == key || taken {
+			continue
+		}
+		delete(entry.Fields, key)
+		entry.Fields[lower] = value
+	}
+	return nil
+}
+
+// CollapseSpace trims the constants of all fields and collapses runs of
+// whitespace (such as line breaks) to single spaces.
+func CollapseSpace(entry *BibEntry) error {
+	for key, value := range entry.Fields {
+		entry.Fields[key] = mapConsts(value, collapseSpace)
+	}
+	return nil
+}
+
+// collapseSpace collapses runs of whitespace in s to single spaces, keeping
+// a single leading or trailing space as they may separate the parts of a
+// composite value.
+func collapseSpace(s string) string {
+	collapsed := strings.Join(strings.Fields(s), " ")
+	if collapsed == "" {
+		return strings.TrimRight(s[:min(len(s), 1)], "\t\n\r")
+	}
+	if s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r' {
+		collapsed = " " + collapsed
+	}
+	if last := s[len(s)-1]; last == ' ' || last == '\t' || last == '\n' || last == '\r' {
+		collapsed += " "
+	}
+	return collapsed
+}
+
+var pageRange = regexp.MustCompile(`^\s*([^\s,-]+)\s*(?:-+|\x{2013}|\x{2014}|\\textendash\s*|\\textemdash\s*)\s*([^\s,-]+)\s*$`)
+
+// NormalizePages writes the page ranges of the pages field with an en dash
+// (--), as in "1--10", and separates lists of pages or ranges by ", ".
+func NormalizePages(entry *BibEntry) error {
+	return normalizeField(entry, "pages", func(pages string) (string, error) {
+		parts := strings.Split(pages, ",")
+		for i, part := range parts {
+			if m := pageRange.FindStringSubmatch(part); m != nil {
+				parts[i] = m[1] + "--" + m[2]
+			} else {
+				parts[i] = strings.TrimSpace(part)
+			}
+		}
+		return strings.Join(parts, ", "), nil
+	})
+}
+
+// NormalizeDOI strips the resolver URL (https://doi.org/) or doi: prefix,
+// \url{} and TeX escapes from the doi field.
+func NormalizeDOI(entry *BibEntry) error {
+	return normalizeField(entry, "doi", func(doi string) (string, error) {
+		doi = cleanURL(doi)
+		return doiPrefix.ReplaceAllString(doi, ""), nil
+	})
+}
+
+// NormalizeURL strips \url{}, TeX escapes and whitespace from the url
+// field.
+func NormalizeURL(entry *BibEntry) error {
+	return normalizeField(entry, "url", func(url string) (string, error) {
+		return cleanURL(url), nil
+	})
+}
+
+var urlUnescaper = strings.NewReplacer(`\_`, "_", `\%`, "%", `\#`, "#", `\&`, "&", `\~`, "~", `{\textasciitilde}`, "~", `\textasciitilde{}`, "~")
+
+func cleanURL(url string) string {
+	url = strings.TrimSpace(url)
+	if strings.HasPrefix(url, `\url{`) && strings.HasSuffix(url, "}") {
+		url = url[len(`\url{`) : len(url)-1]
+	}
+	return strings.Join(strings.Fields(urlUnescaper.Replace(url)), "")
+}
+
+// NormalizeISBN validates the isbn field and converts an ISBN-10 to the
+// equivalent ISBN-13, written without hyphens or spaces. An ISBN with a
+// wrong length or checksum is an ErrInvalidISBN.
+func NormalizeISBN(entry *BibEntry) error {
+	return normalizeField(entry, "isbn", func(isbn string) (string, error) {
+		if normalized, ok := isbn13(isbn); ok {
+			return normalized, nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrInvalidISBN, isbn)
+	})
+}
+
+// isbnPrefix is an optional label before an ISBN, such as "ISBN-13:".
+var isbnPrefix = regexp.MustCompile(`(?i)^\s*ISBN(-1[03])?:?`)
+
+// isbn13 returns the ISBN-13 form of an ISBN-10 or ISBN-13 with a valid
+// check digit, ignoring hyphens, spaces and an ISBN label.
+func isbn13(isbn string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case '0' <= r && r <= '9', r == 'X':
+			return r
+		case r == 'x':
+			return 'X'
+		case r == '-' || r == ' ':
+			return -1
+		}
+		return '?'
+	}, isbnPrefix.ReplaceAllString(strings.TrimSpace(isbn), ""))
+	switch {
+	case len(digits) == 10 && isbn10Check(digits[:9]) == digits[9]:
+		return "978" + digits[:9] + string(isbn13Check("978"+digits[:9])), true
+	case len(digits) == 13 && isDigits(digits) && isbn13Check(digits[:12]) == digits[12]:
+		return digits, true
+	}
+	return "", false
+}
+
+// isbn10Check returns the check digit of the first 9 digits of an ISBN-10.
+func isbn10Check(digits string) byte {
+	if !isDigits(digits) {
+		return 0
+	}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(digits[i]-'0')
+	}
+	switch check := (11 - sum%11) % 11; check {
+	case 10:
+		return 'X'
+	default:
+		return byte('0' + check)
+	}
+}
+
+// isbn13Check returns the check digit of the first 12 digits of an ISBN-13.
+func isbn13Check(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1 + 2*(i%2)
+		sum += weight * int(digits[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// monthMacros are the predefined month macros, by month number.
+var monthMacros = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// MonthsToMacros replaces month names, abbreviations and numbers in the
+// month field by the predefined month macros, e.g. {March} by mar, which
+// bibliography styles localize. Run by BibTex.Normalize, the macros are
+// those of the bibliography (see WithMonthNames); on an entry alone, they
+// have the English month names.
+func MonthsToMacros(entry *BibEntry) error {
+	return replaceMonth(entry, func(m int) BibString {
+		return &BibVar{Key: monthMacros[m-1], Value: NewBibConst(monthNames[m-1])}
+	})
+}
+
+// MonthsToNumbers replaces month names, abbreviations and macros in the
+// month field by month numbers, as used by BibLaTeX.
+func MonthsToNumbers(entry *BibEntry) error {
+	return replaceMonth(entry, func(m int) BibString {
+		return NewBibConst(strconv.Itoa(m))
+	})
+}
+
+var monthNames = []string{
+	"January", "February", "March", "April", "May", "June", "July",
+	"August", "September", "October", "November", "December",
+}
+
+func replaceMonth(entry *BibEntry, replace func(month int) BibString) error {
+	for key, value := range entry.Fields {
+		if strings.ToLower(key) != "month" {
+			continue
+		}
+		if m := parseMonth(value); m > 0 {
+			entry.Fields[key] = replace(m)
+		}
+	}
+	return nil
+}
+
+// parseMonth returns the month number of a month field value, or 0.
+func parseMonth(value BibString) int {
+	s := strings.ToLower(strings.TrimSpace(value.String()))
+	if v, ok := value.(*BibVar); ok {
+		s = strings.ToLower(v.Key)
+	}
+	if n, err := strconv.Atoi(s); err == nil && 1 <= n && n <= 12 {
+		return n
+	}
+	s = strings.TrimSuffix(s, ".")
+	for i, name := range monthNames {
+		if name = strings.ToLower(name); s == name || len(s) >= 3 && strings.HasPrefix(name, s) {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+package bibtex
+
+import (
+	"context"
+	"strings"
+)
+
+// ParseOpt configures ParseWithOptions.
+type ParseOpt func(config *parseConfig)
+
+type parseConfig struct {
+	// months are the values of the month macros jan to dec, or nil for
+	// English.
+	months *[12]string
+	// macros are predefined macros in addition to the months.
+	macros map[string]string
+	// hideDefaultVars keeps predefined macros out of StringVar.
+	hideDefaultVars bool
+	// mode is the error handling: default, strict or lenient.
+	mode parseMode
+	// typeCase and fieldCase are the case of entry types and field names.
+	typeCase, fieldCase NameCase
+	// citeKeySpaces allows spaces inside cite keys.
+	citeKeySpaces bool
+	// maxEntrySize, maxDepth and maxEntries are limits, 0 for none.
+	maxEntrySize, maxDepth, maxEntries int
+	// ctx is checked between items.
+	ctx context.Context
+	// report is called with the progress between items.
+	report func(Progress)
+}
+
+// newParseConfig returns the configuration of options.
+func newParseConfig(options ...ParseOpt) parseConfig {
+	config := parseConfig{typeCase: LowerCase}
+	for _, option := range options {
+		option(&config)
+	}
+	return config
+}
+
+type parseMode int
+
+const (
+	defaultMode parseMode = iota
+	strictMode
+	lenientMode
+)
+
+// WithStrictParsing makes the parser also reject entries with a field given
+// twice (ErrDuplicateField) and cite keys used twice (ErrDuplicateKey),
+// which are otherwise kept as the last field value and both entries.
+func WithStrictParsing() ParseOpt {
+	return func(config *parseConfig) {
+		config.mode = strictMode
+	}
+}
+
+// WithLenientParsing makes the parser skip the items (entries, @string and
+// @preamble) that fail to parse instead of failing, and keep unknown macros
+// as undefined BibVars with an empty value, as BibTeX does.
+func WithLenientParsing() ParseOpt {
+	return func(config *parseConfig) {
+		config.mode = lenientMode
+	}
+}
+
+// Progress is the progress of a parse.
+type Progress struct {
+	Bytes   int64 // Bytes of the input read.
+	Entries int   // Entries parsed.
+}
+
+// WithProgress calls report with the progress of the parse before each item
+// of the file and once at the end of a successful parse.
+func WithProgress(report func(Progress)) ParseOpt {
+	return func(config *parseConfig) {
+		config.report = report
+	}
+}
+
+// NameCase is the case of entry types or field names after parsing.
+type NameCase int
+
+const (
+	// KeepCase keeps names as written in the file.
+	KeepCase NameCase = iota
+	// LowerCase lowercases names.
+	LowerCase
+)
+
+func (c NameCase) apply(name string) string {
+	if c == LowerCase {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// WithEntryTypeCase sets the case of entry types, LowerCase by default.
+func WithEntryTypeCase(c NameCase) ParseOpt {
+	return func(config *parseConfig) {
+		config.typeCase = c
+	}
+}
+
+// WithFieldNameCase sets the case of field names, KeepCase by default.
+func WithFieldNameCase(c NameCase) ParseOpt {
+	return func(config *parseConfig) {
+		config.fieldCase = c
+	}
+}
+
+// WithCiteKeySpaces allows cite keys with spaces, such as {Knuth 1984,
+// which are kept with runs of spaces collapsed to one. Leading and trailing
+// spaces are removed. By default a space ends the cite key.
+func WithCiteKeySpaces() ParseOpt {
+	return func(config *parseConfig) {
+		config.citeKeySpaces = true
+	}
+}
+
+// WithMaxEntrySize limits the size of an item (entry, @string, @preamble or
+// @comment) to n bytes. Larger items fail with ErrLimit.
+func WithMaxEntrySize(n int) ParseOpt {
+	return func(config *parseConfig) {
+		config.maxEntrySize = n
+	}
+}
+
+// WithMaxDepth limits the nesting of braces in a value to n levels, where
+// the braces delimiting the value count as the first level. Deeper values
+// fail with ErrLimit.
+func WithMaxDepth(n int) ParseOpt {
+	return func(config *parseConfig) {
+		config.maxDepth = n
+	}
+}
+
+// WithMaxEntries limits the number of entries to n. Parsing fails with
+// ErrLimit at the entry after the n-th, also with WithLenientParsing.
+func WithMaxEntries(n int) ParseOpt {
+	return func(config *parseConfig) {
+		config.maxEntries = n
+	}
+}
+
+// Dialect is a flavour of the bib format.
+type Dialect int
+
+const (
+	// BibTeX099 is the format of BibTeX 0.99, the default.
+	BibTeX099 Dialect = iota
+	// BibLaTeX is the format read by biber: field names are lowercased and
+	// the month macros jan to dec are the numbers 1 to 12.
+	BibLaTeX
+	// JabRef is the format written by JabRef: field names are lowercased.
+	JabRef
+)
+
+// WithDialect sets the defaults of dialect d. Options after WithDialect
+// override them.
+func WithDialect(d Dialect) ParseOpt {
+	return func(config *parseConfig) {
+		config.typeCase = LowerCase
+		config.fieldCase = KeepCase
+		config.months = nil
+		switch d {
+		case BibLaTeX:
+			config.fieldCase = LowerCase
+			config.months = &[12]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+		case JabRef:
+			config.fieldCase = LowerCase
+		}
+	}
+}
+
+// WithMonthNames sets the values of the predefined month macros jan to dec,
+// e.g. to LocalizedMonths["de"]. By default they are English month names.
+func WithMonthNames(names [12]string) ParseOpt {
+	return func(config *parseConfig) {
+		config.months = &names
+	}
+}
+
+// WithMacros predefines macros, such as PlainMacros, which can be used
+// without @string definitions. Later options and @string definitions in the
+// file take precedence.
+func WithMacros(macros map[string]string) ParseOpt {
+	return func(config *parseConfig) {
+		if config.macros == nil {
+			config.macros = make(map[string]string)
+		}
+		for key, value := range macros {
+			config.macros[key] = value
+		}
+	}
+}
+
+// WithMacroFile predefines the @string macros of macros, e.g. a macro file
+// parsed before the bibliography. The macros are expanded. Like all
+// predefined macros, they are not written by Encoder, so the macro file is
+// still needed with the output.
+func WithMacroFile(macros *BibTex) ParseOpt {
+	values := make(map[string]string, len(macros.StringVar))
+	for key, v := range stringVars(macros) {
+		values[key] = v.String()
+	}
+	return WithMacros(values)
+}
+
+// WithoutImplicitStringVars keeps predefined macros (months and those of
+// WithMacros) out of BibTex.StringVar. By default, the first use of a
+// predefined macro adds it to StringVar.
+func WithoutImplicitStringVars() ParseOpt {
+	return func(config *parseConfig) {
+		config.hideDefaultVars = true
+	}
+}
+
+// LocalizedMonths are month names by ISO 639-1 language code, for
+// WithMonthNames.
+var LocalizedMonths = map[string][12]string{
+	"en": {"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	"de": {"Januar", "Februar", "M{\\\"a}rz", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+	"fr": {"janvier", "f{\\'e}vrier", "mars", "avril", "mai", "juin", "juillet", "ao{\\^u}t", "septembre", "octobre", "novembre", "d{\\'e}cembre"},
+	"es": {"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+	"it": {"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+	"nl": {"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+	"pt": {"janeiro", "fevereiro", "mar{\\c{c}}o", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+}
+
+// PlainMacros are the journal macros predefined by the standard BibTeX
+// styles, such as plain.bst.
+var PlainMacros = map[string]string{
+	"acmcs":    "ACM Computing Surveys",
+	"acta":     "Acta Informatica",
+	"cacm":     "Communications of the ACM",
+	"ibmjrd":   "IBM Journal of Research and Development",
+	"ibmsj":    "IBM Systems Journal",
+	"ieeese":   "IEEE Transactions on Software Engineering",
+	"ieeetc":   "IEEE Transactions on Computers",
+	"ieeetcad": "IEEE Transactions on Computer-Aided Design of Integrated Circuits",
+	"ipl":      "Information Processing Letters",
+	"jacm":     "Journal of the ACM",
+	"jcss":     "Journal of Computer and System Sciences",
+	"scp":      "Science of Computer Programming",
+	"sicomp":   "SIAM Journal on Computing",
+	"tocs":     "ACM Transactions on Computer Systems",
+	"tods":     "ACM Transactions on Database Systems",
+	"tog":      "ACM Transactions on Graphics",
+	"toms":     "ACM Transactions on Mathematical Software",
+	"toois":    "ACM Transactions on Office Information Systems",
+	"toplas":   "ACM Transactions on Programming Languages and Systems",
+	"tcs":      "Theoretical Computer Science",
+}
@@ -0,0 +1,397 @@
+package bibtex
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a compiled predicate over entries, see CompileQuery.
+type Query func(entry *BibEntry) bool
+
+// CompileQuery compiles a query string into a Query.
+//
+// A query is a boolean combination of terms with AND (&&), OR (||), NOT (!)
+// and parentheses; juxtaposed terms are implicitly joined by AND, e.g.
+//
+//	type:article AND year>=2020 AND author:"Knuth" AND NOT keywords~"draft"
+//
+// A term is one of
+//
+//	field:text    field contains text
+//	field=text    field equals text
+//	field~regexp  field matches the regular expression, ignoring case
+//	field<value   field is less than value (also <=, > and >=)
+//	has:field     field is present
+//	text          any field contains text
+//
+// Field names are case-insensitive and values are compared after decoding
+// TeX to Unicode, ignoring case; a query text without accents also matches
+// accented values (author:Godel matches G{\"o}del). Comparisons are numeric
+// if both sides are numbers. The pseudo-fields type, key and year match the
+// entry type, the cite key and the year (or the year of the date field);
+// type:text is an exact match.
+func CompileQuery(query string) (Query, error) {
+	p := &queryParser{tokens: lexQuery(query)}
+	if p.peek().kind == qEOF {
+		return func(*BibEntry) bool { return true }, nil
+	}
+	q, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != qEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return q, nil
+}
+
+// Filter returns a copy of bib with only the entries matching query (see
+// CompileQuery). Preambles and string variables are kept. The lists of
+// preambles and macros are copied, but the entries, preambles and macros
+// themselves are shared with bib; see Clone for a deep copy.
+func (bib *BibTex) Filter(query string) (*BibTex, error) {
+	q, err := CompileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	filtered := &BibTex{
+		Preambles:   append([]BibString{}, bib.Preambles...),
+		Entries:     []*BibEntry{},
+		StringVar:   make(map[string]*BibVar, len(bib.StringVar)),
+		defaultVars: make(map[string]string, len(bib.defaultVars)),
+
+		hideDefaultVars: bib.hideDefaultVars,
+	}
+	for key, v := range bib.StringVar {
+		filtered.StringVar[key] = v
+	}
+	for key, value := range bib.defaultVars {
+		filtered.defaultVars[key] = value
+	}
+	for _, entry := range bib.Entries {
+		if q(entry) {
+			filtered.Entries = append(filtered.Entries, entry)
+		}
+	}
+	return filtered, nil
+}
+
+type queryKind int
+
+const (
+	qEOF queryKind = iota
+	qWord
+	qString // Quoted string.
+	qOp     // One of : = ~ < <= > >=
+	qLParen
+	qRParen
+	qAnd
+	qOr
+	qNot
+	qError
+)
+
+type queryToken struct {
+	kind queryKind
+	text string
+	pos  int
+}
+
+// lexQuery splits a query into tokens, ending with a qEOF token.
+func lexQuery(query string) []queryToken {
+	var tokens []queryToken
+	rs := []rune(query)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: qLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: qRParen, text: ")", pos: i})
+			i++
+		case r == '!':
+			tokens = append(tokens, queryToken{kind: qNot, text: "!", pos: i})
+			i++
+		case r == ':' || r == '=' || r == '~':
+			tokens = append(tokens, queryToken{kind: qOp, text: string(r), pos: i})
+			i++
+		case r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(rs) && rs[i+1] == '=' {
+				op += "="
+			}
+			tokens = append(tokens, queryToken{kind: qOp, text: op, pos: i})
+			i += len(op)
+		case r == '"':
+			var buf strings.Builder
+			start := i
+			for i++; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				buf.WriteRune(rs[i])
+			}
+			if i == len(rs) {
+				tokens = append(tokens, queryToken{kind: qError, text: "unterminated string", pos: start})
+				return tokens
+			}
+			tokens = append(tokens, queryToken{kind: qString, text: buf.String(), pos: start})
+			i++
+		default:
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && !strings.ContainsRune(`()":=~<>!`, rs[i]) {
+				i++
+			}
+			word := string(rs[start:i])
+			kind := qWord
+			switch word {
+			case "AND", "&&":
+				kind = qAnd
+			case "OR", "||":
+				kind = qOr
+			case "NOT":
+				kind = qNot
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: word, pos: start})
+		}
+	}
+	return append(tokens, queryToken{kind: qEOF, pos: len(rs)})
+}
+
+// queryParser is a recursive descent parser for queries.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != qEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) errorf(tok queryToken, format string, args ...interface{}) error {
+	return fmt.Errorf("%w at offset %d: %s", ErrQuery, tok.pos, fmt.Sprintf(format, args...))
+}
+
+// or parses: and { OR and }
+func (p *queryParser) or() (Query, error) {
+	q, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == qOr {
+		p.next()
+		rhs, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		lhs := q
+		q = func(entry *BibEntry) bool { return lhs(entry) || rhs(entry) }
+	}
+	return q, nil
+}
+
+// and parses: not { [AND] not }
+func (p *queryParser) and() (Query, error) {
+	q, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case qAnd:
+			p.next()
+		case qWord, qString, qNot, qLParen:
+		default:
+			return q, nil
+		}
+		rhs, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		lhs := q
+		q = func(entry *BibEntry) bool { return lhs(entry) && rhs(entry) }
+	}
+}
+
+// not parses: NOT not | primary
+func (p *queryParser) not() (Query, error) {
+	if p.peek().kind == qNot {
+		p.next()
+		q, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(entry *BibEntry) bool { return !q(entry) }, nil
+	}
+	return p.primary()
+}
+
+// primary parses: ( or ) | term
+func (p *queryParser) primary() (Query, error) {
+	tok := p.next()
+	switch tok.kind {
+	case qLParen:
+		q, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != qRParen {
+			return nil, p.errorf(tok, "missing )")
+		}
+		return q, nil
+	case qWord, qString:
+		if p.peek().kind == qOp && tok.kind == qWord {
+			op := p.next()
+			val := p.next()
+			if val.kind != qWord && val.kind != qString {
+				return nil, p.errorf(val, "missing value after %s%s", tok.text, op.text)
+			}
+			return p.term(strings.ToLower(tok.text), op, val)
+		}
+		text := queryText(tok.text)
+		return func(entry *BibEntry) bool {
+			for name := range entry.Fields {
+				if text.contains(queryValue(entry, name)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case qError:
+		return nil, p.errorf(tok, "%s", tok.text)
+	case qEOF:
+		return nil, p.errorf(tok, "unexpected end of query")
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// term compiles a field comparison.
+func (p *queryParser) term(field string, op, val queryToken) (Query, error) {
+	if field == "has" && op.text == ":" {
+		name := strings.ToLower(val.text)
+		return func(entry *BibEntry) bool {
+			_, ok := queryField(entry, name)
+			return ok
+		}, nil
+	}
+	switch op.text {
+	case ":":
+		if field != "type" {
+			text := queryText(val.text)
+			return func(entry *BibEntry) bool { return text.contains(queryValue(entry, field)) }, nil
+		}
+		fallthrough
+	case "=":
+		text := queryText(val.text)
+		return func(entry *BibEntry) bool { return text.equals(queryValue(entry, field)) }, nil
+	case "~":
+		re, err := regexp.Compile("(?i)" + val.text)
+		if err != nil {
+			return nil, p.errorf(val, "%v", err)
+		}
+		return func(entry *BibEntry) bool { return re.MatchString(queryValue(entry, field)) }, nil
+	}
+	want := val.text
+	return func(entry *BibEntry) bool {
+		if _, ok := queryField(entry, field); !ok {
+			return false
+		}
+		c := compareQueryValues(queryValue(entry, field), want)
+		switch op.text {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}, nil
+}
+
+// queryField looks up a field by lowercase name or pseudo-field.
+func queryField(entry *BibEntry, name string) (string, bool) {
+	switch name {
+	case "type":
+		return entry.Type, true
+	case "key":
+		return entry.CiteName, true
+	case "year":
+		if _, ok := foldedField(entry, "year"); !ok {
+			date, ok := foldedField(entry, "date")
+			if i := strings.IndexAny(date, "-/"); i >= 0 {
+				date = date[:i]
+			}
+			return date, ok
+		}
+	}
+	return foldedField(entry, name)
+}
+
+// foldedField returns the decoded value of the field with the given
+// lowercase name, ignoring the case of the field names of entry.
+func foldedField(entry *BibEntry, name string) (string, bool) {
+	for key, value := range entry.Fields {
+		if strings.ToLower(key) == name {
+			return DecodeTeX(value.String()), true
+		}
+	}
+	return "", false
+}
+
+// queryValue returns the decoded value of a field, or "" if it is missing.
+func queryValue(entry *BibEntry, name string) string {
+	value, _ := queryField(entry, strings.ToLower(name))
+	return value
+}
+
+// compareQueryValues compares a and b numerically if both are numbers, and
+// as case-insensitive text otherwise.
+func compareQueryValues(a, b string) int {
+	x, errx := strconv.ParseFloat(a, 64)
+	y, erry := strconv.ParseFloat(b, 64)
+	if errx == nil && erry == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// queryText is a query text matched case-insensitively, and also against
+// the accent-folded value if the text itself has no accents.
+type queryText string
+
+func (t queryText) match(value string, fn func(value, text string) bool) bool {
+	text := strings.ToLower(string(t))
+	if fn(strings.ToLower(value), text) {
+		return true
+	}
+	return ASCIIFold(text) == text && fn(strings.ToLower(ASCIIFold(value)), text)
+}
+
+func (t queryText) contains(value string) bool {
+	return t.match(value, strings.Contains)
+}
+
+func (t queryText) equals(value string) bool {
+	return t.match(value, func(value, text string) bool { return value == text })
+}
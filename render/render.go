@@ -0,0 +1,286 @@
+// Package render formats BibTeX entries as reference-list strings.
+//
+// A Style decides which parts of an entry are printed and in what order (for
+// example APA, IEEE or ACM) and a Format decides how the result is marked up
+// (plain text, Markdown or HTML). Field values are decoded from TeX to
+// Unicode and names are parsed with bibtex.ParseNames before rendering.
+//
+//	s := render.Entry(entry, render.WithStyle(render.IEEE), render.WithFormat(render.Markdown))
+package render // import "github.com/nickng/bibtex/render"
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/nickng/bibtex"
+)
+
+// Format is an output markup format.
+type Format int
+
+const (
+	// Text is plain text, with no markup for emphasis.
+	Text Format = iota
+	// Markdown marks emphasis with *asterisks*.
+	Markdown
+	// HTML marks emphasis with <i> elements and escapes special characters.
+	HTML
+)
+
+// config controls the behaviour of Entry and Bibliography.
+type config struct {
+	style  *Style
+	format Format
+}
+
+// Option configures rendering.
+type Option func(config *config)
+
+// WithStyle selects the citation style (default APA).
+func WithStyle(style *Style) Option {
+	return func(config *config) {
+		config.style = style
+	}
+}
+
+// WithFormat selects the output format (default Text).
+func WithFormat(format Format) Option {
+	return func(config *config) {
+		config.format = format
+	}
+}
+
+func newConfig(options []Option) config {
+	config := config{style: APA, format: Text}
+	for _, option := range options {
+		option(&config)
+	}
+	return config
+}
+
+// Entry renders a single entry as a reference-list string, without any
+// label or list markup.
+func Entry(entry *bibtex.BibEntry, options ...Option) string {
+	config := newConfig(options)
+	var t text
+	config.style.entry(&t, newRecord(entry))
+	return t.format(config.format)
+}
+
+// Bibliography renders all entries of bib as a reference list.
+//
+// Author-year styles sort entries by author and year; numeric styles keep
+// the order of the bibliography and label entries [1], [2], ... Text output
+// is one entry per line, Markdown output is a list and HTML output is an
+// <ol> or <ul> element.
+func Bibliography(bib *bibtex.BibTex, options ...Option) string {
+	config := newConfig(options)
+	records := make([]*record, len(bib.Entries))
+	for i, entry := range bib.Entries {
+		records[i] = newRecord(entry)
+	}
+	if !config.style.Numeric {
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].sortKey() < records[j].sortKey()
+		})
+	}
+
+	var buf strings.Builder
+	switch {
+	case config.format == HTML && config.style.Numeric:
+		buf.WriteString("<ol class=\"bibliography\">\n")
+	case config.format == HTML:
+		buf.WriteString("<ul class=\"bibliography\">\n")
+	}
+	for i, r := range records {
+		var t text
+		config.style.entry(&t, r)
+		s := t.format(config.format)
+		switch config.format {
+		case HTML:
+			fmt.Fprintf(&buf, "<li id=\"%s\">%s</li>\n", html.EscapeString(r.key), s)
+		case Markdown:
+			if config.style.Numeric {
+				fmt.Fprintf(&buf, "%d. %s\n", i+1, s)
+			} else {
+				fmt.Fprintf(&buf, "- %s\n", s)
+			}
+		default:
+			if config.style.Numeric {
+				fmt.Fprintf(&buf, "[%d] %s\n", i+1, s)
+			} else {
+				fmt.Fprintf(&buf, "%s\n", s)
+			}
+		}
+	}
+	switch {
+	case config.format == HTML && config.style.Numeric:
+		buf.WriteString("</ol>\n")
+	case config.format == HTML:
+		buf.WriteString("</ul>\n")
+	}
+	return buf.String()
+}
+
+// span is a run of text with uniform emphasis.
+type span struct {
+	s      string
+	italic bool
+}
+
+// text is a rendered reference before markup is applied.
+type text struct {
+	spans []span
+}
+
+// plain appends non-emphasised text.
+func (t *text) plain(s string) {
+	t.spans = append(t.spans, span{s: s})
+}
+
+// italic appends emphasised text.
+func (t *text) italic(s string) {
+	t.spans = append(t.spans, span{s: s, italic: true})
+}
+
+// format applies the markup of f to the spans.
+func (t *text) format(f Format) string {
+	var buf strings.Builder
+	for _, sp := range t.spans {
+		switch f {
+		case HTML:
+			if sp.italic {
+				buf.WriteString("<i>" + html.EscapeString(sp.s) + "</i>")
+			} else {
+				buf.WriteString(html.EscapeString(sp.s))
+			}
+		case Markdown:
+			if sp.italic && strings.TrimSpace(sp.s) != "" {
+				buf.WriteString("*" + markdownEscaper.Replace(sp.s) + "*")
+			} else {
+				buf.WriteString(markdownEscaper.Replace(sp.s))
+			}
+		default:
+			buf.WriteString(sp.s)
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`,
+)
+
+// record is an entry with decoded fields and parsed names.
+type record struct {
+	typ     string
+	key     string
+	fields  map[string]string
+	authors []bibtex.Name
+	editors []bibtex.Name
+}
+
+func newRecord(entry *bibtex.BibEntry) *record {
+	r := &record{
+		typ:    entry.Type,
+		key:    entry.CiteName,
+		fields: make(map[string]string, len(entry.Fields)),
+	}
+	for key, val := range entry.Fields {
+		key = strings.ToLower(key)
+		switch key {
+		case "author":
+			r.authors = decodeNames(val.String())
+		case "editor":
+			r.editors = decodeNames(val.String())
+		}
+		r.fields[key] = bibtex.DecodeTeX(val.String())
+	}
+	return r
+}
+
+// decodeNames parses a name list and decodes each name part.
+func decodeNames(s string) []bibtex.Name {
+	names := bibtex.ParseNames(s)
+	for i, n := range names {
+		names[i] = bibtex.Name{
+			First: bibtex.DecodeTeX(n.First),
+			Von:   bibtex.DecodeTeX(n.Von),
+			Last:  bibtex.DecodeTeX(n.Last),
+			Jr:    bibtex.DecodeTeX(n.Jr),
+		}
+	}
+	return names
+}
+
+// field returns the first non-empty field out of keys.
+func (r *record) field(keys ...string) string {
+	for _, key := range keys {
+		if v := r.fields[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// year returns the year of publication from the date or year field.
+func (r *record) year() string {
+	if date := r.fields["date"]; len(date) >= 4 {
+		return date[:4]
+	}
+	return r.fields["year"]
+}
+
+// title returns the title joined with any subtitle.
+func (r *record) title() string {
+	title := r.fields["title"]
+	if sub := r.fields["subtitle"]; sub != "" && title != "" {
+		title = strings.TrimRight(title, ".:") + ": " + sub
+	}
+	return title
+}
+
+// container returns the journal or book title the entry was published in.
+func (r *record) container() string {
+	return r.field("journaltitle", "journal", "booktitle", "maintitle")
+}
+
+// pages returns the page range with an en dash between the numbers.
+func (r *record) pages() string {
+	pages := r.fields["pages"]
+	if !strings.Contains(pages, "–") {
+		pages = strings.ReplaceAll(pages, "-", "–")
+	}
+	return pages
+}
+
+// doi returns the DOI as an https://doi.org/ URL.
+func (r *record) doi() string {
+	doi := r.fields["doi"]
+	if doi == "" || strings.HasPrefix(doi, "http") {
+		return doi
+	}
+	return "https://doi.org/" + doi
+}
+
+// publisher returns the publishing body of the entry.
+func (r *record) publisher() string {
+	return r.field("publisher", "institution", "school", "organization", "howpublished")
+}
+
+// sortKey orders entries by first author (or editor, or title) and year.
+func (r *record) sortKey() string {
+	names := r.authors
+	if len(names) == 0 {
+		names = r.editors
+	}
+	var key string
+	if len(names) > 0 {
+		key = bibtex.ASCIIFold(names[0].Last + " " + names[0].First)
+	} else {
+		key = bibtex.ASCIIFold(r.title())
+	}
+	return strings.ToLower(key) + "\x00" + r.year()
+}
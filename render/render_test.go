@@ -0,0 +1,85 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nickng/bibtex"
+)
+
+func knuth() *bibtex.BibEntry {
+	entry := bibtex.NewBibEntry("article", "knuth84")
+	entry.AddField("author", bibtex.NewBibConst("Knuth, Donald E."))
+	entry.AddField("title", bibtex.NewBibConst("Literate Programming"))
+	entry.AddField("journal", bibtex.NewBibConst("The Computer Journal"))
+	entry.AddField("year", bibtex.NewBibConst("1984"))
+	entry.AddField("volume", bibtex.NewBibConst("27"))
+	entry.AddField("number", bibtex.NewBibConst("2"))
+	entry.AddField("pages", bibtex.NewBibConst("97--111"))
+	return entry
+}
+
+func TestEntryStyles(t *testing.T) {
+	tests := []struct {
+		style *Style
+		want  string
+	}{
+		{APA, "Knuth, D. E. (1984). Literate Programming. The Computer Journal, 27(2), 97–111."},
+		{IEEE, "D. E. Knuth, “Literate Programming,” The Computer Journal, vol. 27, no. 2, pp. 97–111, 1984."},
+		{ACM, "Donald E. Knuth. 1984. Literate Programming. The Computer Journal 27, 2 (1984), 97–111."},
+	}
+	for _, tt := range tests {
+		if got := Entry(knuth(), WithStyle(tt.style)); got != tt.want {
+			t.Errorf("%s:\nwant %s\n got %s", tt.style.Name, tt.want, got)
+		}
+	}
+}
+
+func TestEntryFormats(t *testing.T) {
+	entry := knuth()
+	entry.AddField("author", bibtex.NewBibConst(`G{\"o}del, Kurt and Knuth, Donald E.`))
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{Markdown, "Gödel, K., & Knuth, D. E. (1984). Literate Programming. *The Computer Journal*, *27*(2), 97–111."},
+		{HTML, "Gödel, K., &amp; Knuth, D. E. (1984). Literate Programming. <i>The Computer Journal</i>, <i>27</i>(2), 97–111."},
+	}
+	for _, tt := range tests {
+		if got := Entry(entry, WithFormat(tt.format)); got != tt.want {
+			t.Errorf("format %d:\nwant %s\n got %s", tt.format, tt.want, got)
+		}
+	}
+}
+
+func TestBibliography(t *testing.T) {
+	b, err := os.ReadFile("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib, err := bibtex.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, style := range Styles {
+		for _, format := range []Format{Text, Markdown, HTML} {
+			out := Bibliography(bib, WithStyle(style), WithFormat(format))
+			if strings.Contains(out, `\`) && format != Markdown {
+				t.Errorf("%s: unexpected TeX in output", style.Name)
+			}
+			lines := strings.Count(out, "\n")
+			if format == HTML {
+				lines -= 2 // <ol> and </ol>
+			}
+			if lines != len(bib.Entries) {
+				t.Errorf("%s: expecting %d entries but got %d", style.Name, len(bib.Entries), lines)
+			}
+		}
+	}
+	out := Bibliography(bib, WithStyle(IEEE))
+	if !strings.HasPrefix(out, "[1] G. Westfahl") {
+		t.Errorf("IEEE bibliography should keep file order, got %.40q", out)
+	}
+}
@@ -0,0 +1,404 @@
+package render
+
+import (
+	"strings"
+
+	"github.com/nickng/bibtex"
+)
+
+// Style is a built-in citation style.
+type Style struct {
+	Name    string // Short name of the style, e.g. "apa".
+	Numeric bool   // Entries are labelled by number instead of sorted by author.
+
+	entry func(t *text, r *record)
+}
+
+var (
+	// APA is an author-year style after the APA 7th edition.
+	APA = &Style{Name: "apa", entry: apaEntry}
+	// IEEE is a numeric style after the IEEE reference guide.
+	IEEE = &Style{Name: "ieee", Numeric: true, entry: ieeeEntry}
+	// ACM is a numeric style after the ACM reference format.
+	ACM = &Style{Name: "acm", Numeric: true, entry: acmEntry}
+)
+
+// Styles lists the built-in styles by name.
+var Styles = map[string]*Style{
+	APA.Name:  APA,
+	IEEE.Name: IEEE,
+	ACM.Name:  ACM,
+}
+
+// apaEntry renders r as, for example:
+//
+//	Knuth, D. E. (1984). Literate programming. The Computer Journal, 27(2), 97–111.
+func apaEntry(t *text, r *record) {
+	editorsFirst := len(r.authors) == 0 && len(r.editors) > 0
+	switch {
+	case len(r.authors) > 0:
+		t.plain(terminate(joinNames(r.authors, apaName, ", & ", ", & ", 20), ".") + " ")
+	case editorsFirst:
+		t.plain(joinNames(r.editors, apaName, ", & ", ", & ", 20) + " (" + plural(r.editors, "Ed.", "Eds.") + "). ")
+	}
+	year := r.year()
+	if year == "" {
+		year = "n.d."
+	}
+	t.plain("(" + year + "). ")
+
+	switch r.typ {
+	case "article", "periodical":
+		t.plain(terminate(r.title(), ".") + " ")
+		if journal := r.container(); journal != "" {
+			t.italic(journal)
+			if vol := r.fields["volume"]; vol != "" {
+				t.plain(", ")
+				t.italic(vol)
+			}
+			if num := r.field("number", "issue"); num != "" {
+				t.plain("(" + num + ")")
+			}
+			if pages := r.pages(); pages != "" {
+				t.plain(", " + pages)
+			}
+			t.plain(". ")
+		}
+	case "inproceedings", "incollection", "inbook", "inreference", "conference":
+		t.plain(terminate(r.title(), "."))
+		if container := r.container(); container != "" {
+			t.plain(" In ")
+			if len(r.editors) > 0 && !editorsFirst {
+				t.plain(joinNames(r.editors, initialsLast, " & ", ", & ", 20) + " (" + plural(r.editors, "Ed.", "Eds.") + "), ")
+			}
+			t.italic(container)
+		}
+		if pages := r.pages(); pages != "" {
+			t.plain(" (pp. " + pages + ")")
+		}
+		t.plain(". ")
+		if pub := r.publisher(); pub != "" {
+			t.plain(terminate(pub, ".") + " ")
+		}
+	default:
+		t.italic(r.title())
+		var details []string
+		if ed := r.fields["edition"]; ed != "" {
+			details = append(details, "("+ordinalEdition(ed)+" ed.)")
+		}
+		if thesis := thesisKind(r); thesis != "" {
+			details = append(details, "["+joinNonEmpty(", ", thesis, r.field("school", "institution"))+"]")
+		}
+		if len(details) > 0 {
+			t.plain(" " + strings.Join(details, " "))
+		}
+		t.plain(". ")
+		if pub := r.publisher(); pub != "" && thesisKind(r) == "" {
+			t.plain(terminate(pub, ".") + " ")
+		}
+	}
+	if doi := r.doi(); doi != "" {
+		t.plain(doi)
+	} else if url := r.fields["url"]; url != "" {
+		t.plain(url)
+	}
+}
+
+// ieeeEntry renders r as, for example:
+//
+//	D. E. Knuth, “Literate programming,” The Computer Journal, vol. 27, no. 2, pp. 97–111, 1984.
+func ieeeEntry(t *text, r *record) {
+	if len(r.authors) > 0 {
+		t.plain(joinNames(r.authors, initialsLast, " and ", ", and ", 6) + ", ")
+	} else if len(r.editors) > 0 {
+		t.plain(joinNames(r.editors, initialsLast, " and ", ", and ", 6) + ", " + plural(r.editors, "Ed.", "Eds.") + ", ")
+	}
+	quotedTitle := func() {
+		if title := r.title(); title != "" {
+			t.plain("“" + title + ",” ")
+		}
+	}
+	inContainer := func() {
+		if container := r.container(); container != "" {
+			t.plain("in ")
+			t.italic(container)
+		}
+	}
+	// details follows the container, or the title if there is no container.
+	details := func(s string) {
+		if r.container() == "" {
+			s = strings.TrimPrefix(s, ", ")
+		}
+		t.plain(s)
+	}
+	year := r.year()
+
+	switch r.typ {
+	case "article", "periodical":
+		quotedTitle()
+		t.italic(r.container())
+		details(prefixJoin(", ", "vol. "+r.fields["volume"], "no. "+r.field("number", "issue"), "pp. "+r.pages(), year) + ".")
+	case "inproceedings", "conference":
+		quotedTitle()
+		inContainer()
+		details(prefixJoin(", ", r.field("location", "address"), year, "pp. "+r.pages()) + ".")
+	case "incollection", "inbook", "inreference":
+		quotedTitle()
+		inContainer()
+		if len(r.editors) > 0 && len(r.authors) > 0 {
+			t.plain(", " + joinNames(r.editors, initialsLast, " and ", ", and ", 6) + ", " + plural(r.editors, "Ed.", "Eds."))
+		}
+		t.plain(". " + terminate(joinNonEmpty(", ", publication(r), year, prefixed("pp. ", r.pages())), "."))
+	case "phdthesis", "mastersthesis", "thesis", "techreport", "report", "misc", "online", "unpublished", "manual":
+		quotedTitle()
+		kind := thesisKind(r)
+		switch {
+		case kind == "Doctoral dissertation":
+			kind = "Ph.D. dissertation"
+		case kind == "Master's thesis":
+			kind = "M.S. thesis"
+		case r.typ == "techreport" || r.typ == "report":
+			kind = joinNonEmpty(" ", "Tech. Rep.", r.fields["number"])
+		}
+		t.plain(terminate(joinNonEmpty(", ", kind, r.field("school", "institution", "organization", "publisher", "howpublished"), r.field("location", "address"), year), "."))
+		if url := r.fields["url"]; url != "" && r.doi() == "" {
+			t.plain(" [Online]. Available: " + url)
+		}
+	default:
+		t.italic(r.title())
+		if ed := r.fields["edition"]; ed != "" {
+			t.plain(", " + ordinalEdition(ed) + " ed")
+		}
+		t.plain(". " + terminate(joinNonEmpty(", ", publication(r), year), "."))
+	}
+	if doi := r.fields["doi"]; doi != "" {
+		t.plain(" doi: " + strings.TrimPrefix(doi, "https://doi.org/") + ".")
+	}
+}
+
+// acmEntry renders r as, for example:
+//
+//	Donald E. Knuth. 1984. Literate programming. The Computer Journal 27, 2 (1984), 97–111.
+func acmEntry(t *text, r *record) {
+	if len(r.authors) > 0 {
+		t.plain(terminate(joinNames(r.authors, firstLast, " and ", ", and ", 0), ".") + " ")
+	} else if len(r.editors) > 0 {
+		t.plain(joinNames(r.editors, firstLast, " and ", ", and ", 0) + " (" + plural(r.editors, "Ed.", "Eds.") + "). ")
+	}
+	if year := r.year(); year != "" {
+		t.plain(year + ". ")
+	}
+
+	switch r.typ {
+	case "article", "periodical":
+		t.plain(terminate(r.title(), ".") + " ")
+		t.italic(r.container())
+		vol := joinNonEmpty(", ", r.fields["volume"], r.field("number", "issue"))
+		if vol != "" {
+			t.plain(" " + vol)
+		}
+		if year := r.year(); year != "" {
+			t.plain(" (" + year + ")")
+		}
+		t.plain(prefixJoin(", ", r.pages()) + ". ")
+	case "inproceedings", "incollection", "inbook", "inreference", "conference":
+		t.plain(terminate(r.title(), "."))
+		if container := r.container(); container != "" {
+			t.plain(" In ")
+			t.italic(container)
+			t.plain(".")
+		}
+		t.plain(" " + terminate(joinNonEmpty(", ", r.publisher(), r.field("location", "address"), r.pages()), ".") + " ")
+	default:
+		t.italic(r.title())
+		t.plain(". ")
+		if kind := thesisKind(r); kind == "Doctoral dissertation" {
+			t.plain("Ph. D. Dissertation. ")
+		} else if kind != "" {
+			t.plain("Master's thesis. ")
+		}
+		if pub := joinNonEmpty(", ", r.publisher(), r.field("location", "address")); pub != "" {
+			t.plain(terminate(pub, ".") + " ")
+		}
+	}
+	if doi := r.doi(); doi != "" {
+		t.plain(doi)
+	} else if url := r.fields["url"]; url != "" {
+		t.plain(url)
+	}
+}
+
+// publication returns "Location: Publisher" for book-like entries.
+func publication(r *record) string {
+	pub, loc := r.publisher(), r.field("location", "address")
+	if pub != "" && loc != "" {
+		return loc + ": " + pub
+	}
+	return pub + loc
+}
+
+// thesisKind returns the degree of a thesis entry, or "" for other entries.
+func thesisKind(r *record) string {
+	switch r.typ {
+	case "phdthesis":
+		return "Doctoral dissertation"
+	case "mastersthesis":
+		return "Master's thesis"
+	case "thesis":
+		switch strings.ToLower(r.fields["type"]) {
+		case "phdthesis", "phd thesis", "ph.d. thesis":
+			return "Doctoral dissertation"
+		case "mathesis", "mastersthesis", "master's thesis":
+			return "Master's thesis"
+		}
+		if r.fields["type"] != "" {
+			return r.fields["type"]
+		}
+		return "Thesis"
+	}
+	return ""
+}
+
+// ordinalEdition turns a numeric edition into an ordinal, e.g. 2 to 2nd.
+func ordinalEdition(ed string) string {
+	if ed == "" || strings.Trim(ed, "0123456789") != "" {
+		return ed
+	}
+	suffix := "th"
+	if len(ed) < 2 || ed[len(ed)-2] != '1' {
+		switch ed[len(ed)-1] {
+		case '1':
+			suffix = "st"
+		case '2':
+			suffix = "nd"
+		case '3':
+			suffix = "rd"
+		}
+	}
+	return ed + suffix
+}
+
+// apaName formats a name as "Last, F. M., Jr."
+func apaName(n bibtex.Name) string {
+	name := surname(n)
+	if initials := initials(n.First); initials != "" {
+		name += ", " + initials
+	}
+	if n.Jr != "" {
+		name += ", " + n.Jr
+	}
+	return name
+}
+
+// initialsLast formats a name as "F. M. Last, Jr."
+func initialsLast(n bibtex.Name) string {
+	name := joinNonEmpty(" ", initials(n.First), surname(n))
+	if n.Jr != "" {
+		name += ", " + n.Jr
+	}
+	return name
+}
+
+// firstLast formats a name as "First M. Last Jr."
+func firstLast(n bibtex.Name) string {
+	return joinNonEmpty(" ", n.First, surname(n), n.Jr)
+}
+
+// surname returns the von and last parts of a name.
+func surname(n bibtex.Name) string {
+	return joinNonEmpty(" ", n.Von, n.Last)
+}
+
+// initials abbreviates given names, e.g. "Jean-Paul Marie" to "J.-P. M."
+func initials(first string) string {
+	var parts []string
+	for _, word := range strings.Fields(first) {
+		var hyphenated []string
+		for _, part := range strings.Split(word, "-") {
+			if rs := []rune(part); len(rs) > 0 {
+				hyphenated = append(hyphenated, string(rs[0])+".")
+			}
+		}
+		parts = append(parts, strings.Join(hyphenated, "-"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// joinNames formats and joins names, using pair to join exactly two names
+// and last before the final name of a longer list. Lists truncated with
+// "others", or longer than max (if max > 0), end in "et al."
+func joinNames(names []bibtex.Name, format func(bibtex.Name) string, pair, last string, max int) string {
+	etAl := false
+	var formatted []string
+	for _, n := range names {
+		if n.IsOthers() {
+			etAl = true
+			break
+		}
+		formatted = append(formatted, format(n))
+	}
+	if max > 0 && len(formatted) > max {
+		formatted, etAl = formatted[:1], true
+	}
+	switch {
+	case len(formatted) == 0:
+		return ""
+	case etAl && len(formatted) == 1:
+		return formatted[0] + " et al."
+	case etAl:
+		return strings.Join(formatted, ", ") + ", et al."
+	case len(formatted) == 1:
+		return formatted[0]
+	case len(formatted) == 2:
+		return formatted[0] + pair + formatted[1]
+	}
+	return strings.Join(formatted[:len(formatted)-1], ", ") + last + formatted[len(formatted)-1]
+}
+
+// plural returns one or many depending on the number of names.
+func plural(names []bibtex.Name, one, many string) string {
+	if len(names) == 1 {
+		return one
+	}
+	return many
+}
+
+// terminate ends s with punct unless it already ends in punctuation.
+func terminate(s, punct string) string {
+	if s == "" || strings.HasSuffix(s, ".") || strings.HasSuffix(s, "?") || strings.HasSuffix(s, "!") {
+		return s
+	}
+	return s + punct
+}
+
+// joinNonEmpty joins the non-empty parts with sep.
+func joinNonEmpty(sep string, parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
+
+// prefixed returns prefix+s, or "" if s is empty.
+func prefixed(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + s
+}
+
+// prefixJoin joins the parts that have a value, each preceded by sep.
+// Parts of the form "label " with no value after the label are skipped.
+func prefixJoin(sep string, parts ...string) string {
+	var buf strings.Builder
+	for _, part := range parts {
+		if part == "" || strings.HasSuffix(part, " ") {
+			continue
+		}
+		buf.WriteString(sep + part)
+	}
+	return buf.String()
+}
@@ -3,19 +3,25 @@ package bibtex
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
 )
 
-var parseField bool
-
 // scanner is a lexical scanner
 type scanner struct {
 	commentMode  bool
 	outsideEntry bool
+	parseField   bool // Inside a field value.
 	r            *bufio.Reader
 	pos          tokenPos
+	maxSize      int   // Maximum bytes of an item, 0 for no limit.
+	maxDepth     int   // Maximum brace depth of a value, 0 for no limit.
+	size         int   // Bytes read of the current item.
+	lastSize     int   // Bytes of the last rune read.
+	offset       int64 // Bytes read from r.
+	err          error // Exceeded limit, after which read returns eof.
 }
 
 // newScanner returns a new instance of scanner.
@@ -26,10 +32,19 @@ func newScanner(r io.Reader) *scanner {
 // read reads the next rune from the buffered reader.
 // Returns the rune(0) if an error occurs (or io.eof is returned).
 func (s *scanner) read() rune {
-	ch, _, err := s.r.ReadRune()
+	if s.err != nil {
+		return eof
+	}
+	ch, size, err := s.r.ReadRune()
 	if err != nil {
 		return eof
 	}
+	s.lastSize = size
+	s.offset += int64(size)
+	if s.size += size; s.maxSize > 0 && s.size > s.maxSize {
+		s.err = fmt.Errorf("%w: item larger than %d bytes", ErrLimit, s.maxSize)
+		return eof
+	}
 	if ch == '\n' {
 		s.pos.Lines = append(s.pos.Lines, s.pos.Char)
 		s.pos.Char = 0
@@ -41,7 +56,10 @@ func (s *scanner) read() rune {
 
 // unread places the previously read rune back on the reader.
 func (s *scanner) unread() {
-	_ = s.r.UnreadRune()
+	if s.r.UnreadRune() == nil {
+		s.size -= s.lastSize
+		s.offset -= int64(s.lastSize)
+	}
 	if s.pos.Char == 0 {
 		s.pos.Char = s.pos.Lines[len(s.pos.Lines)-1]
 		s.pos.Lines = s.pos.Lines[:len(s.pos.Lines)-1]
@@ -56,6 +74,7 @@ func (s *scanner) Scan() (tok token, lit string, err error) {
 		// Ordinary comment scanning, but without generating a token
 		s.scanCommentBody()
 		s.outsideEntry = false
+		s.size = 0
 	}
 	ch := s.read()
 	if isWhitespace(ch) {
@@ -70,20 +89,21 @@ func (s *scanner) Scan() (tok token, lit string, err error) {
 	case eof:
 		return 0, "", nil
 	case '@':
+		s.size = 0
 		return tATSIGN, string(ch), nil
 	case ':':
 		return tCOLON, string(ch), nil
 	case ',':
-		parseField = false // reset parseField if reached end of field.
+		s.parseField = false // reset parseField if reached end of field.
 		return tCOMMA, string(ch), nil
 	case '=':
-		parseField = true // set parseField if = sign outside quoted or ident.
+		s.parseField = true // set parseField if = sign outside quoted or ident.
 		return tEQUAL, string(ch), nil
 	case '"':
 		tok, lit := s.scanQuoted()
 		return tok, lit, nil
 	case '{':
-		if parseField {
+		if s.parseField {
 			return s.scanBraced()
 		}
 		// If we're reading a comment, return everything after {
@@ -95,10 +115,10 @@ func (s *scanner) Scan() (tok token, lit string, err error) {
 		}
 		return tLBRACE, string(ch), nil
 	case '}':
-		if parseField { // reset parseField if reached end of entry.
-			parseField = false
-			s.outsideEntry = true
-		}
+		// A brace outside of a value ends the item, also after a trailing
+		// comma; reset parseField if reached end of entry.
+		s.parseField = false
+		s.outsideEntry = true
 		return tRBRACE, string(ch), nil
 	case '#':
 		return tPOUND, string(ch), nil
@@ -143,7 +163,7 @@ func (s *scanner) scanBare() (token, string) {
 		return tPREAMBLE, str
 	} else if strings.ToLower(str) == "string" {
 		return tSTRING, str
-	} else if _, err := strconv.Atoi(str); err == nil && parseField { // Special case for numeric
+	} else if _, err := strconv.Atoi(str); err == nil && s.parseField { // Special case for numeric
 		return tIDENT, str
 	}
 	return tBAREIDENT, str
@@ -162,7 +182,9 @@ func (s *scanner) scanBraced() (token, string, error) {
 			macro = true
 		} else if ch == '{' {
 			_, _ = buf.WriteRune(ch)
-			brace++
+			if brace++; !s.checkDepth(brace) {
+				break
+			}
 		} else if ch == '}' {
 			brace--
 			macro = false
@@ -186,6 +208,38 @@ func (s *scanner) scanBraced() (token, string, error) {
 	return tILLEGAL, buf.String(), nil
 }
 
+// checkDepth reports whether a brace depth is within the limit.
+func (s *scanner) checkDepth(depth int) bool {
+	if s.maxDepth > 0 && depth > s.maxDepth {
+		s.err = fmt.Errorf("%w: braces nested deeper than %d", ErrLimit, s.maxDepth)
+		return false
+	}
+	return true
+}
+
+// scanKey parses a cite key which may contain spaces, up to the next comma
+// or closing brace.
+func (s *scanner) scanKey() (token, string) {
+	var buf bytes.Buffer
+	for {
+		if ch := s.read(); ch == eof {
+			break
+		} else if ch == ',' || ch == '}' || ch == '@' {
+			s.unread()
+			break
+		} else if isWhitespace(ch) {
+			_, _ = buf.WriteRune(' ')
+		} else {
+			_, _ = buf.WriteRune(ch)
+		}
+	}
+	key := strings.Join(strings.Fields(buf.String()), " ")
+	if key == "" {
+		return tILLEGAL, key
+	}
+	return tBAREIDENT, key
+}
+
 // scanQuoted parses a quoted string, like "this".
 func (s *scanner) scanQuoted() (token, string) {
 	var buf bytes.Buffer
@@ -194,7 +248,9 @@ func (s *scanner) scanQuoted() (token, string) {
 		if ch := s.read(); ch == eof {
 			break
 		} else if ch == '{' {
-			brace++
+			if brace++; !s.checkDepth(brace + 1) {
+				break
+			}
 		} else if ch == '}' {
 			brace--
 		} else if ch == '"' {
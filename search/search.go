@@ -0,0 +1,402 @@
+// Package search is an in-memory full-text index over BibTeX entries.
+//
+// Field values are decoded from TeX and folded to lowercase ASCII before
+// tokenizing, so a search for "Godel" finds G{\"o}del. Results are ranked
+// with BM25 over a per-field boosted term frequency, so that a match in the
+// title counts more than one in the abstract.
+//
+//	idx := search.New()
+//	idx.AddAll(bib)
+//	for _, r := range idx.Search("godel incompl*", search.WithLimit(10)) {
+//		fmt.Println(r.Key, r.Score)
+//	}
+//
+// The index is updated incrementally with Add and Remove, and can be saved
+// to and loaded from disk with Save and Load.
+package search // import "github.com/nickng/bibtex/search"
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/nickng/bibtex"
+)
+
+// BM25 parameters.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// DefaultBoosts are the default per-field weights. Fields not listed have
+// weight 1, and the pseudo-field "key" is the cite key.
+var DefaultBoosts = map[string]float64{
+	"title":    3,
+	"author":   2,
+	"editor":   1.5,
+	"abstract": 0.5,
+	"file":     0,
+}
+
+// Index is an inverted index over entries, keyed by cite key.
+// It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	boosts   map[string]float64
+	docs     map[string]*document
+	postings map[string]map[string]float64 // Term -> cite key -> weighted tf.
+	length   float64                       // Total length of all documents.
+	terms    []string                      // Sorted terms, nil if outdated.
+}
+
+// document is the indexed form of an entry.
+type document struct {
+	Length float64            // Weighted number of tokens.
+	Terms  map[string]float64 // Weighted term frequencies.
+}
+
+// Option configures an Index.
+type Option func(idx *Index)
+
+// WithBoost sets the weight of a field; a weight of 0 excludes the field.
+func WithBoost(field string, weight float64) Option {
+	return func(idx *Index) {
+		idx.boosts[strings.ToLower(field)] = weight
+	}
+}
+
+// New returns an empty index.
+func New(options ...Option) *Index {
+	idx := &Index{
+		boosts:   make(map[string]float64, len(DefaultBoosts)),
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string]float64),
+	}
+	for field, weight := range DefaultBoosts {
+		idx.boosts[field] = weight
+	}
+	for _, option := range options {
+		option(idx)
+	}
+	return idx
+}
+
+// Len returns the number of indexed entries.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// AddAll indexes all entries of bib.
+func (idx *Index) AddAll(bib *bibtex.BibTex) {
+	for _, entry := range bib.Entries {
+		idx.Add(entry)
+	}
+}
+
+// Add indexes entry, replacing any entry with the same cite key.
+func (idx *Index) Add(entry *bibtex.BibEntry) {
+	doc := &document{Terms: make(map[string]float64)}
+	idx.addField(doc, "key", entry.CiteName)
+	for name, value := range entry.Fields {
+		idx.addField(doc, strings.ToLower(name), value.String())
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(entry.CiteName)
+	idx.docs[entry.CiteName] = doc
+	idx.length += doc.Length
+	idx.post(entry.CiteName, doc)
+}
+
+func (idx *Index) addField(doc *document, field, value string) {
+	weight, ok := idx.boosts[field]
+	if !ok {
+		weight = 1
+	}
+	if weight == 0 {
+		return
+	}
+	for _, tok := range Tokenize(value) {
+		doc.Terms[tok] += weight
+		doc.Length += weight
+	}
+}
+
+// post adds the terms of doc to the postings.
+func (idx *Index) post(key string, doc *document) {
+	for term, tf := range doc.Terms {
+		p, ok := idx.postings[term]
+		if !ok {
+			p = make(map[string]float64)
+			idx.postings[term] = p
+			idx.terms = nil
+		}
+		p[key] = tf
+	}
+}
+
+// Remove removes the entry with the given cite key from the index, and
+// returns false if it was not indexed.
+func (idx *Index) Remove(key string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.remove(key)
+}
+
+func (idx *Index) remove(key string) bool {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return false
+	}
+	for term := range doc.Terms {
+		delete(idx.postings[term], key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+			idx.terms = nil
+		}
+	}
+	idx.length -= doc.Length
+	delete(idx.docs, key)
+	return true
+}
+
+// Tokenize splits s into index terms: TeX is decoded, accents are removed,
+// letters are lowercased and the text is split at anything that is not a
+// letter or digit.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(bibtex.ASCIIFold(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Result is a matching entry and its relevance score.
+type Result struct {
+	Key   string
+	Score float64
+}
+
+// searchConfig controls the behaviour of Search.
+type searchConfig struct {
+	limit int
+}
+
+// SearchOption configures a search.
+type SearchOption func(config *searchConfig)
+
+// WithLimit limits the number of results (default unlimited).
+func WithLimit(n int) SearchOption {
+	return func(config *searchConfig) {
+		config.limit = n
+	}
+}
+
+// Search returns the entries matching all words of query, best match first.
+//
+// A word ending in * matches any term with that prefix, and a word ending
+// in ~ matches terms within a small edit distance (~N for at most N edits).
+// Prefix and fuzzy matches score less than exact ones.
+func (idx *Index) Search(query string, options ...SearchOption) []Result {
+	var config searchConfig
+	for _, option := range options {
+		option(&config)
+	}
+
+	idx.mu.Lock() // Search may rebuild the sorted terms.
+	defer idx.mu.Unlock()
+
+	var scores map[string]float64
+	for _, word := range queryWords(query) {
+		matches := idx.expand(word)
+		if len(matches) == 0 {
+			return nil
+		}
+		wordScores := make(map[string]float64)
+		for term, weight := range matches {
+			p := idx.postings[term]
+			idf := math.Log(1 + (float64(len(idx.docs))-float64(len(p))+0.5)/(float64(len(p))+0.5))
+			for key, tf := range p {
+				norm := tf + k1*(1-b+b*idx.docs[key].Length/idx.avgLength())
+				if s := weight * idf * tf * (k1 + 1) / norm; s > wordScores[key] {
+					wordScores[key] = s
+				}
+			}
+		}
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for key, s := range scores {
+			if ws, ok := wordScores[key]; ok {
+				scores[key] = s + ws
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for key, score := range scores {
+		results = append(results, Result{Key: key, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Key < results[j].Key
+	})
+	if config.limit > 0 && len(results) > config.limit {
+		results = results[:config.limit]
+	}
+	return results
+}
+
+func (idx *Index) avgLength() float64 {
+	if len(idx.docs) == 0 {
+		return 1
+	}
+	return idx.length / float64(len(idx.docs))
+}
+
+// expand returns the index terms matched by a query word, with the weight
+// of each match.
+func (idx *Index) expand(word string) map[string]float64 {
+	matches := make(map[string]float64)
+	switch {
+	case strings.HasSuffix(word, "*"):
+		prefix := strings.Join(Tokenize(strings.TrimSuffix(word, "*")), "")
+		if prefix == "" {
+			return nil
+		}
+		terms := idx.sortedTerms()
+		for i := sort.SearchStrings(terms, prefix); i < len(terms) && strings.HasPrefix(terms[i], prefix); i++ {
+			matches[terms[i]] = 1
+			if terms[i] != prefix {
+				matches[terms[i]] = 0.8
+			}
+		}
+	case strings.Contains(word, "~"):
+		i := strings.LastIndex(word, "~")
+		term := strings.Join(Tokenize(word[:i]), "")
+		maxEdits := 1
+		if len(term) > 5 {
+			maxEdits = 2
+		}
+		if n, err := strconv.Atoi(word[i+1:]); err == nil {
+			maxEdits = n
+		}
+		for t := range idx.postings {
+			if d := editDistance(term, t, maxEdits); d <= maxEdits {
+				matches[t] = 1 / float64(1+d)
+			}
+		}
+	default:
+		if _, ok := idx.postings[word]; ok {
+			matches[word] = 1
+		}
+	}
+	return matches
+}
+
+// queryWords splits a query into words: plain words are tokenized like
+// field values, and prefix and fuzzy words are kept as they are.
+func queryWords(query string) []string {
+	var words []string
+	for _, word := range strings.Fields(query) {
+		if strings.HasSuffix(word, "*") || strings.Contains(word, "~") {
+			words = append(words, word)
+			continue
+		}
+		words = append(words, Tokenize(word)...)
+	}
+	return words
+}
+
+func (idx *Index) sortedTerms() []string {
+	if idx.terms == nil {
+		idx.terms = make([]string, 0, len(idx.postings))
+		for term := range idx.postings {
+			idx.terms = append(idx.terms, term)
+		}
+		sort.Strings(idx.terms)
+	}
+	return idx.terms
+}
+
+// editDistance returns the edit distance between a and b, counting
+// insertions, deletions, substitutions and transpositions of adjacent
+// letters, or a value greater than limit if it exceeds limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+// snapshot is the serialized form of an Index.
+type snapshot struct {
+	Boosts map[string]float64
+	Docs   map[string]*document
+}
+
+// Save writes the index to w, to be read back with Load.
+func (idx *Index) Save(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(snapshot{Boosts: idx.boosts, Docs: idx.docs})
+}
+
+// Load reads an index written by Save.
+func Load(r io.Reader) (*Index, error) {
+	var snap snapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+	idx := New()
+	if snap.Boosts != nil {
+		idx.boosts = snap.Boosts
+	}
+	for key, doc := range snap.Docs {
+		if doc.Terms == nil {
+			doc.Terms = make(map[string]float64)
+		}
+		idx.docs[key] = doc
+		idx.length += doc.Length
+		idx.post(key, doc)
+	}
+	return idx, nil
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nickng/bibtex"
+)
+
+func testIndex(t *testing.T) *Index {
+	bib, err := bibtex.Parse(strings.NewReader(`
+@article{knuth84, author = {Knuth, Donald E.}, title = {Literate Programming}, year = 1984}
+@book{goedel31, author = {G{\"o}del, Kurt}, title = {{\"U}ber formal unentscheidbare S{\"a}tze}, year = 1931}
+@misc{hofstadter, author = {Hofstadter, Douglas}, title = {G{\"o}del, Escher, Bach}, abstract = {Programming and incompleteness}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := New()
+	idx.AddAll(bib)
+	return idx
+}
+
+func keys(results []Result) string {
+	var keys []string
+	for _, r := range results {
+		keys = append(keys, r.Key)
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestTokenize(t *testing.T) {
+	if want, got := "uber formal godel 2 groups", strings.Join(Tokenize(`{\"U}ber Formal, G\"{}odel 2-Groups`), " "); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := testIndex(t)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"Godel", "hofstadter goedel31"},      // Title ranks above author.
+		{"programming", "knuth84 hofstadter"}, // Title ranks above abstract.
+		{"gödel bach", "hofstadter"},
+		{"prog*", "knuth84 hofstadter"},
+		{"knuht~", "knuth84"},
+		{"knuht~0", ""},
+		{"unentscheid", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := keys(idx.Search(tt.query)); tt.want != got {
+			t.Errorf("%s: want %q but got %q", tt.query, tt.want, got)
+		}
+	}
+	if want, got := "hofstadter", keys(idx.Search("godel", WithLimit(1))); want != got {
+		t.Errorf("limit: want %q but got %q", want, got)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	idx := testIndex(t)
+	if !idx.Remove("goedel31") {
+		t.Fatal("expected goedel31 to be removed")
+	}
+	if idx.Remove("goedel31") {
+		t.Error("expected goedel31 to be removed only once")
+	}
+	if want, got := "hofstadter", keys(idx.Search("godel")); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+	entry := bibtex.NewBibEntry("article", "knuth84")
+	entry.AddField("title", bibtex.NewBibConst("The Art of Computer Programming"))
+	idx.Add(entry)
+	if want, got := 2, idx.Len(); want != got {
+		t.Errorf("expected %d entries but got %d", want, got)
+	}
+	if want, got := "", keys(idx.Search("literate")); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+	if want, got := "knuth84", keys(idx.Search("art")); want != got {
+		t.Errorf("want %q but got %q", want, got)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	idx := New()
+	f, err := os.Open("../example/biblatex-examples.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bib, err := bibtex.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.AddAll(bib)
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := idx.Len(), loaded.Len(); want != got {
+		t.Errorf("expected %d entries but got %d", want, got)
+	}
+	for _, query := range []string{"catalysis", "aksin", "higher dim*", "algebar~"} {
+		want, got := idx.Search(query), loaded.Search(query)
+		if len(want) == 0 {
+			t.Errorf("%s: expected results", query)
+		}
+		if keys(want) != keys(got) {
+			t.Errorf("%s: want %q but got %q", query, keys(want), keys(got))
+		}
+	}
+}
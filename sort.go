@@ -0,0 +1,181 @@
+package bibtex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sortArticles are skipped at the start of titles by the title sort key.
+var sortArticles = []string{"the ", "a ", "an "}
+
+// Sort sorts the entries of bib by the given sort keys, in order of
+// priority. Entries that compare equal by all keys keep their order.
+//
+// A sort key is a field name, prefixed by "-" for descending order (or "+"
+// for ascending order, the default). Some names sort specially:
+//
+//	key     the cite key
+//	type    the entry type
+//	author  the names of the authors (or editors, or the sortname field),
+//	        by last name, first name, von part and suffix, preceded by the
+//	        presort field if any, so "van Beethoven" sorts under B
+//	year    the date field, or the year and month fields
+//	date    same as year
+//	title   the sorttitle field or the title, ignoring a leading "The",
+//	        "A" or "An"
+//
+// Values are compared with TeX decoded, first with accents and case
+// ignored, then with accents, then with case. Values starting with digits
+// compare by that number first, so year 999 sorts before date 2000-01.
+// Entries without a value sort last in both orders.
+func (bib *BibTex) Sort(keys ...string) {
+	type sortKey struct {
+		name       string
+		descending bool
+	}
+	sortKeys := make([]sortKey, len(keys))
+	for i, key := range keys {
+		sortKeys[i].name = strings.ToLower(strings.TrimLeft(key, "+-"))
+		sortKeys[i].descending = strings.HasPrefix(key, "-")
+	}
+	values := make(map[*BibEntry][]sortValue, len(bib.Entries))
+	for _, entry := range bib.Entries {
+		v := make([]sortValue, len(sortKeys))
+		for i, key := range sortKeys {
+			v[i] = newSortValue(entry, key.name)
+		}
+		values[entry] = v
+	}
+	sort.SliceStable(bib.Entries, func(i, j int) bool {
+		vi, vj := values[bib.Entries[i]], values[bib.Entries[j]]
+		for k, key := range sortKeys {
+			switch {
+			case !vi[k].ok || !vj[k].ok:
+				if vi[k].ok != vj[k].ok {
+					return vi[k].ok
+				}
+				continue
+			}
+			c := vi[k].compare(vj[k])
+			if key.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// sortValue is the value of a sort key of an entry.
+type sortValue struct {
+	ok     bool
+	value  string // Decoded value.
+	lower  string // Lower case value.
+	folded string // Lower case ASCII value.
+}
+
+func newSortValue(entry *BibEntry, name string) sortValue {
+	var value string
+	var ok bool
+	switch name {
+	case "author":
+		value, ok = authorSortValue(entry)
+	case "year", "date":
+		value, ok = dateSortValue(entry)
+	case "title":
+		if value, ok = foldedField(entry, "sorttitle"); !ok {
+			value, ok = foldedField(entry, "title")
+			for _, article := range sortArticles {
+				if len(value) > len(article) && strings.EqualFold(value[:len(article)], article) {
+					value = value[len(article):]
+					break
+				}
+			}
+		}
+	default:
+		value, ok = queryField(entry, name)
+	}
+	value = strings.TrimSpace(value)
+	return sortValue{
+		ok:     ok && value != "",
+		value:  value,
+		lower:  strings.ToLower(value),
+		folded: strings.ToLower(ASCIIFold(value)),
+	}
+}
+
+// authorSortValue returns the names of the authors (or editors) of entry
+// for sorting.
+func authorSortValue(entry *BibEntry) (string, bool) {
+	presort, _ := foldedField(entry, "presort")
+	names, ok := rawField(entry, "sortname")
+	if !ok {
+		if names, ok = rawField(entry, "author"); !ok {
+			names, ok = rawField(entry, "editor")
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	parts := []string{presort}
+	for _, name := range ParseNames(names) {
+		// Separate names and name parts by a control character that sorts
+		// before any letter, so that "Smith" sorts before "Smithson".
+		parts = append(parts, strings.Join([]string{DecodeTeX(name.Last), DecodeTeX(name.First), DecodeTeX(name.Von), DecodeTeX(name.Jr)}, "\x01"))
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// dateSortValue returns the date of entry as yyyy-mm-dd (or a prefix).
+func dateSortValue(entry *BibEntry) (string, bool) {
+	if date, ok := foldedField(entry, "date"); ok {
+		return date, true
+	}
+	year, ok := foldedField(entry, "year")
+	if !ok {
+		return "", false
+	}
+	for key, value := range entry.Fields {
+		if strings.ToLower(key) == "month" {
+			if m := parseMonth(value); m > 0 {
+				return fmt.Sprintf("%s-%02d", year, m), true
+			}
+		}
+	}
+	return year, true
+}
+
+// compare compares sort values by their leading numbers if both start with
+// digits, then ignoring accents and case, then ignoring case, then as they
+// are.
+func (v sortValue) compare(w sortValue) int {
+	a, b := leadingDigits(v.value), leadingDigits(w.value)
+	if a != "" && b != "" {
+		x, y := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(x) != len(y) {
+			return len(x) - len(y)
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	if c := strings.Compare(v.folded, w.folded); c != 0 {
+		return c
+	}
+	if c := strings.Compare(v.lower, w.lower); c != 0 {
+		return c
+	}
+	return strings.Compare(w.value, v.value) // Lower case first.
+}
+
+// leadingDigits returns the digits at the start of s.
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
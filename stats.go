@@ -0,0 +1,227 @@
+package bibtex
+
+import (
+	"sort"
+	"strings"
+)
+
+// GroupKey returns the keys of the groups an entry belongs to, e.g. its
+// year or the names of its authors. An entry without keys is in no group.
+type GroupKey func(entry *BibEntry) []string
+
+// Group is a group of entries with the same key.
+type Group struct {
+	Key     string
+	Entries []*BibEntry
+}
+
+// ByField groups entries by the decoded value of a field (or the pseudo
+// field key, type or year, see CompileQuery).
+func ByField(name string) GroupKey {
+	name = strings.ToLower(name)
+	return func(entry *BibEntry) []string {
+		if value, ok := queryField(entry, name); ok && value != "" {
+			return []string{value}
+		}
+		return nil
+	}
+}
+
+var (
+	// ByYear groups entries by year.
+	ByYear = ByField("year")
+	// ByType groups entries by entry type.
+	ByType = ByField("type")
+)
+
+// venueFields are the fields naming the venue of an entry, in order of
+// preference.
+var venueFields = []string{"journaltitle", "journal", "booktitle", "eventtitle"}
+
+// ByVenue groups entries by the journal, or the title of the book or
+// proceedings, they appear in.
+func ByVenue(entry *BibEntry) []string {
+	for _, name := range venueFields {
+		if value, ok := foldedField(entry, name); ok && value != "" {
+			return []string{value}
+		}
+	}
+	return nil
+}
+
+// ByAuthor groups entries by each of their authors, as "Last, First".
+func ByAuthor(entry *BibEntry) []string {
+	names, _ := rawField(entry, "author")
+	var keys []string
+	for _, name := range ParseNames(names) {
+		if !name.IsOthers() {
+			keys = append(keys, authorKey(name))
+		}
+	}
+	return keys
+}
+
+// authorKey returns a name as "von Last, Jr, First", TeX decoded.
+func authorKey(name Name) string {
+	key := DecodeTeX(strings.TrimSpace(name.Von + " " + name.Last))
+	if name.Jr != "" {
+		key += ", " + DecodeTeX(name.Jr)
+	}
+	if name.First != "" {
+		key += ", " + DecodeTeX(name.First)
+	}
+	return key
+}
+
+// GroupBy groups the entries of bib by key, and returns the groups by
+// decreasing size, then by key. An entry with several keys (such as an entry
+// with several authors) is in several groups.
+func (bib *BibTex) GroupBy(key GroupKey) []Group {
+	index := make(map[string]int)
+	var groups []Group
+	for _, entry := range bib.Entries {
+		seen := make(map[string]bool)
+		for _, k := range key(entry) {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			i, ok := index[k]
+			if !ok {
+				i = len(groups)
+				index[k] = i
+				groups = append(groups, Group{Key: k})
+			}
+			groups[i].Entries = append(groups[i].Entries, entry)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].Entries) != len(groups[j].Entries) {
+			return len(groups[i].Entries) > len(groups[j].Entries)
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// Count is the number of entries with a key.
+type Count struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// Stats are aggregate statistics of a bibliography, as returned by
+// BibTex.Stats. Counts are sorted by decreasing count, then by key, except
+// Years which are sorted by year.
+type Stats struct {
+	Entries      int                `json:"entries"`
+	Years        []Count            `json:"years,omitempty"`
+	Types        []Count            `json:"types,omitempty"`
+	Venues       []Count            `json:"venues,omitempty"`
+	Authors      []Count            `json:"authors,omitempty"`
+	CoAuthors    []CoAuthorCount    `json:"coauthors,omitempty"`
+	Fields       []Count            `json:"fields,omitempty"` // Entries using each field (by lowercase name).
+	Completeness []TypeCompleteness `json:"completeness,omitempty"`
+}
+
+// CoAuthorCount is the number of entries two authors wrote together.
+type CoAuthorCount struct {
+	Authors [2]string `json:"authors"`
+	Count   int       `json:"count"`
+}
+
+// TypeCompleteness is how complete the fields of the entries of a type are.
+type TypeCompleteness struct {
+	Type    string              `json:"type"`
+	Entries int                 `json:"entries"`
+	Fields  []FieldCompleteness `json:"fields"`
+}
+
+// FieldCompleteness is the fraction of entries of a type with a non-empty
+// field.
+type FieldCompleteness struct {
+	Name     string  `json:"name"`
+	Fraction float64 `json:"fraction"`
+}
+
+// Stats returns the statistics of bib: the number of entries per year,
+// type, venue and author, the number of entries per pair of co-authors,
+// the number of entries using each field, and, for each entry type, the
+// fraction of entries with each field used by entries of the type.
+func (bib *BibTex) Stats() *Stats {
+	s := &Stats{
+		Entries: len(bib.Entries),
+		Years:   counts(bib.GroupBy(ByYear)),
+		Types:   counts(bib.GroupBy(ByType)),
+		Venues:  counts(bib.GroupBy(ByVenue)),
+		Authors: counts(bib.GroupBy(ByAuthor)),
+	}
+	sort.SliceStable(s.Years, func(i, j int) bool { return s.Years[i].Key < s.Years[j].Key })
+
+	pairs := make(map[[2]string]int)
+	for _, entry := range bib.Entries {
+		authors := uniqueStrings(ByAuthor(entry))
+		sort.Strings(authors)
+		for i := range authors {
+			for j := i + 1; j < len(authors); j++ {
+				pairs[[2]string{authors[i], authors[j]}]++
+			}
+		}
+	}
+	for pair, n := range pairs {
+		s.CoAuthors = append(s.CoAuthors, CoAuthorCount{Authors: pair, Count: n})
+	}
+	sort.Slice(s.CoAuthors, func(i, j int) bool {
+		a, b := s.CoAuthors[i], s.CoAuthors[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Authors[0] < b.Authors[0] || a.Authors[0] == b.Authors[0] && a.Authors[1] < b.Authors[1]
+	})
+
+	s.Fields = counts(bib.GroupBy(byFieldNames))
+	for _, group := range bib.GroupBy(ByType) {
+		c := TypeCompleteness{Type: group.Key, Entries: len(group.Entries)}
+		typeBib := &BibTex{Entries: group.Entries}
+		for _, field := range counts(typeBib.GroupBy(byFieldNames)) {
+			c.Fields = append(c.Fields, FieldCompleteness{
+				Name:     field.Key,
+				Fraction: float64(field.Count) / float64(len(group.Entries)),
+			})
+		}
+		s.Completeness = append(s.Completeness, c)
+	}
+	return s
+}
+
+// byFieldNames groups entries by the lowercase names of their non-empty
+// fields.
+func byFieldNames(entry *BibEntry) []string {
+	var names []string
+	for name, value := range entry.Fields {
+		if value.String() != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
+
+func counts(groups []Group) []Count {
+	c := make([]Count, len(groups))
+	for i, g := range groups {
+		c[i] = Count{Key: g.Key, Count: len(g.Entries)}
+	}
+	return c
+}
+
+func uniqueStrings(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	var unique []string
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
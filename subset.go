@@ -0,0 +1,94 @@
+package bibtex
+
+import "strings"
+
+// subsetReferenceFields are the fields whose referenced entries are needed
+// to typeset an entry, and are therefore included by Subset.
+var subsetReferenceFields = []string{"crossref", "xref", "xdata"}
+
+// Subset returns a bibliography with the entries of bib cited by keys, in
+// the order of bib, and the keys that are not in bib. The key "*" (as in
+// \nocite{*}) selects all entries.
+//
+// The subset is self-contained: it also has the entries referenced by the
+// crossref, xref and xdata fields of the selected entries, all @string
+// macros that their fields use (directly or through other macros), and all
+// preambles. Predefined macros, such as localized months, are those of
+// bib. Entries and macros are shared with bib, not copied.
+func (bib *BibTex) Subset(keys []string) (*BibTex, []string) {
+	byKey := entriesByKey(bib)
+	selected := make(map[string]bool)
+	var missing []string
+	var pending []string
+	for _, key := range keys {
+		if key == "*" {
+			for _, entry := range bib.Entries {
+				pending = append(pending, entry.CiteName)
+			}
+			continue
+		}
+		if byKey[key] == nil {
+			missing = append(missing, key)
+			continue
+		}
+		pending = append(pending, key)
+	}
+	for len(pending) > 0 {
+		key := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if selected[key] || byKey[key] == nil {
+			continue
+		}
+		selected[key] = true
+		for _, name := range subsetReferenceFields {
+			value, ok := rawField(byKey[key], name)
+			if !ok {
+				continue
+			}
+			for _, ref := range strings.Split(value, ",") {
+				pending = append(pending, strings.TrimSpace(ref))
+			}
+		}
+	}
+
+	subset := &BibTex{
+		Preambles:   append([]BibString{}, bib.Preambles...),
+		Entries:     []*BibEntry{},
+		StringVar:   make(map[string]*BibVar),
+		defaultVars: make(map[string]string, len(bib.defaultVars)),
+
+		hideDefaultVars: bib.hideDefaultVars,
+	}
+	for key, value := range bib.defaultVars {
+		subset.defaultVars[key] = value
+	}
+	for _, entry := range bib.Entries {
+		if selected[entry.CiteName] && byKey[entry.CiteName] == entry {
+			subset.AddEntry(entry)
+			for _, value := range entry.Fields {
+				addStringVars(subset, value)
+			}
+		}
+	}
+	for _, preamble := range bib.Preambles {
+		addStringVars(subset, preamble)
+	}
+	return subset, missing
+}
+
+// addStringVars adds the string variables used by s (and by their values)
+// to bib.
+func addStringVars(bib *BibTex, s BibString) {
+	switch s := s.(type) {
+	case *BibVar:
+		if _, ok := bib.StringVar[s.Key]; ok {
+			return
+		}
+		bib.StringVar[s.Key] = s
+		addStringVars(bib, s.Value)
+	case *BibComposite:
+		for _, part := range *s {
+			addStringVars(bib, part)
+		}
+	}
+}
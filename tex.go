@@ -0,0 +1,290 @@
+package bibtex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// texAccents maps a TeX accent command to the combining character it stands
+// for, used when no precomposed character is known.
+var texAccents = map[rune]rune{
+	'`': '̀', '\'': '́', '^': '̂', '~': '̃',
+	'=': '̄', 'u': '̆', '.': '̇', '"': '̈',
+	'r': '̊', 'H': '̋', 'v': '̌', 'd': '̣',
+	'c': '̧', 'k': '̨', 'b': '̱',
+}
+
+// texComposed maps an accent command and its base letter to the precomposed
+// Unicode character, e.g. {\"o} is ö.
+var texComposed = map[string]string{
+	"`":  "AÀaàEÈeèIÌiìOÒoòUÙuù",
+	"'":  "AÁaáEÉeéIÍiíOÓoóUÚuúYÝyýCĆcćNŃnńSŚsśZŹzźLĹlĺRŔrŕGǴgǵ",
+	"^":  "AÂaâEÊeêIÎiîOÔoôUÛuûCĈcĉGĜgĝHĤhĥJĴjĵSŜsŝWŴwŵYŶyŷ",
+	"~":  "AÃaãNÑnñOÕoõIĨiĩUŨuũ",
+	"=":  "AĀaāEĒeēIĪiīOŌoōUŪuū",
+	"u":  "AĂaăGĞgğUŬuŭEĔeĕIĬiĭOŎoŏ",
+	".":  "CĊcċEĖeėGĠgġIİZŻzż",
+	"\"": "AÄaäEËeëIÏiïOÖoöUÜuüYŸyÿ",
+	"r":  "AÅaåUŮuů",
+	"H":  "OŐoőUŰuű",
+	"v":  "CČcčDĎdďEĚeěNŇnňRŘrřSŠsšTŤtťZŽzž",
+	"c":  "CÇcçSŞsşTŢtţGĢgģKĶkķLĻlļNŅnņRŖrŗ",
+	"k":  "AĄaąEĘeęIĮiįUŲuų",
+	"d":  "AẠaạEẸeẹIỊiịOỌoọUỤuụ",
+}
+
+// texSymbols maps argument-less TeX commands to their Unicode text.
+var texSymbols = map[string]string{
+	"ss": "ß", "SS": "SS", "o": "ø", "O": "Ø", "aa": "å", "AA": "Å",
+	"ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ", "l": "ł", "L": "Ł",
+	"i": "ı", "j": "ȷ", "dh": "ð", "DH": "Ð", "th": "þ", "TH": "Þ",
+	"ng": "ŋ", "NG": "Ŋ", "dj": "đ", "DJ": "Đ",
+	"&": "&", "%": "%", "$": "$", "#": "#", "_": "_", "{": "{", "}": "}",
+	" ": " ", ",": " ", ";": " ", ":": " ", "!": "", "/": "", "-": "",
+	"\\": " ", "@": "",
+	"ldots": "…", "dots": "…", "textellipsis": "…",
+	"textendash": "–", "textemdash": "—", "textquoteleft": "‘",
+	"textquoteright": "’", "textquotedblleft": "“", "textquotedblright": "”",
+	"guillemotleft": "«", "guillemotright": "»", "textbackslash": "\\",
+	"S": "§", "P": "¶", "copyright": "©", "textcopyright": "©",
+	"textregistered": "®", "texttrademark": "™", "textdegree": "°",
+	"pounds": "£", "textsterling": "£", "euro": "€", "texteuro": "€",
+	"dag": "†", "ddag": "‡", "textbullet": "•", "textperiodcentered": "·",
+	"quad": " ", "qquad": " ", "enspace": " ", "thinspace": " ",
+	"TeX": "TeX", "LaTeX": "LaTeX", "BibTeX": "BibTeX", "slash": "/",
+	"hyphen": "-", "hyp": "-", "nobreakspace": " ",
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "iota": "ι",
+	"kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π",
+	"rho": "ρ", "sigma": "σ", "tau": "τ", "upsilon": "υ", "phi": "φ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω", "Gamma": "Γ",
+	"Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"times": "×", "pm": "±", "leq": "≤", "geq": "≥", "neq": "≠",
+	"infty": "∞", "to": "→", "rightarrow": "→", "leftarrow": "←",
+	"cdot": "·", "sim": "∼", "approx": "≈", "in": "∈",
+}
+
+// texASCII maps non-decomposable letters to their usual ASCII spelling.
+var texASCII = map[rune]string{
+	'ß': "ss", 'ø': "o", 'Ø': "O", 'æ': "ae", 'Æ': "AE", 'œ': "oe",
+	'Œ': "OE", 'ł': "l", 'Ł': "L", 'ı': "i", 'ȷ': "j", 'ð': "d", 'Ð': "D",
+	'þ': "th", 'Þ': "Th", 'ŋ': "ng", 'Ŋ': "NG", 'đ': "d", 'Đ': "D",
+	'–': "-", '—': "-", '‘': "'", '’': "'", '“': "\"", '”': "\"",
+	'«': "\"", '»': "\"", '…': "...", ' ': " ", ' ': " ",
+}
+
+// texFolded is the reverse of texComposed: precomposed letter to base letter.
+var texFolded = func() map[rune]rune {
+	folded := make(map[rune]rune)
+	for _, pairs := range texComposed {
+		runes := []rune(pairs)
+		for i := 0; i+1 < len(runes); i += 2 {
+			folded[runes[i+1]] = runes[i]
+		}
+	}
+	return folded
+}()
+
+// DecodeTeX converts a TeX-encoded field value into plain Unicode text.
+//
+// Accent commands (e.g. {\"o}, \'e, \c{c}) and common symbols (\ss, \&,
+// --, “) are replaced by their Unicode equivalents, grouping braces and math
+// shifts are dropped, formatting commands such as \emph{...} are replaced by
+// their argument, and runs of whitespace are collapsed to a single space.
+func DecodeTeX(s string) string {
+	d := texDecoder{src: []rune(s)}
+	d.decode()
+	return strings.Join(strings.Fields(d.buf.String()), " ")
+}
+
+// ASCIIFold returns s with TeX decoded and all accents and ligatures
+// replaced by plain ASCII letters, e.g. G{\"o}del becomes Godel.
+func ASCIIFold(s string) string {
+	var buf strings.Builder
+	for _, r := range DecodeTeX(s) {
+		switch {
+		case r < utf8.RuneSelf:
+			buf.WriteRune(r)
+		case texFolded[r] != 0:
+			buf.WriteRune(texFolded[r])
+		case texASCII[r] != "":
+			buf.WriteString(texASCII[r])
+		case unicode.Is(unicode.Mn, r):
+			// Drop combining marks left by unknown compositions.
+		case unicode.IsSpace(r):
+			buf.WriteRune(' ')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// texDecoder is a small recursive-descent converter from TeX to Unicode.
+type texDecoder struct {
+	src []rune
+	pos int
+	buf strings.Builder
+}
+
+func (d *texDecoder) peek(off int) rune {
+	if d.pos+off < len(d.src) {
+		return d.src[d.pos+off]
+	}
+	return eof
+}
+
+func (d *texDecoder) decode() {
+	for d.pos < len(d.src) {
+		ch := d.src[d.pos]
+		switch {
+		case ch == '\\':
+			d.pos++
+			d.command()
+		case ch == '{' || ch == '}' || ch == '$':
+			d.pos++
+		case ch == '~':
+			d.buf.WriteRune(' ')
+			d.pos++
+		case ch == '-' && d.peek(1) == '-' && d.peek(2) == '-':
+			d.buf.WriteRune('—')
+			d.pos += 3
+		case ch == '-' && d.peek(1) == '-':
+			d.buf.WriteRune('–')
+			d.pos += 2
+		case ch == '`' && d.peek(1) == '`':
+			d.buf.WriteRune('“')
+			d.pos += 2
+		case ch == '\'' && d.peek(1) == '\'':
+			d.buf.WriteRune('”')
+			d.pos += 2
+		default:
+			d.buf.WriteRune(ch)
+			d.pos++
+		}
+	}
+}
+
+// command decodes a control sequence; the backslash has been consumed.
+func (d *texDecoder) command() {
+	if d.pos >= len(d.src) {
+		return
+	}
+	name := d.commandName()
+	if mark, ok := texAccents[[]rune(name)[0]]; ok && utf8.RuneCountInString(name) == 1 {
+		d.accent(name, mark)
+		return
+	}
+	if sym, ok := texSymbols[name]; ok {
+		d.buf.WriteString(sym)
+		if isAlpha([]rune(name)[0]) {
+			d.skipSpaceAndEmptyGroup()
+		}
+		return
+	}
+	// Unknown commands (\emph, \textbf, \url, ...) keep their arguments,
+	// which are decoded by the main loop with their braces dropped.
+	if unicode.IsLetter([]rune(name)[0]) {
+		d.skipSpace()
+	}
+}
+
+// commandName reads a control word (letters) or a control symbol.
+func (d *texDecoder) commandName() string {
+	start := d.pos
+	if !unicode.IsLetter(d.src[d.pos]) || d.src[d.pos] > unicode.MaxASCII {
+		d.pos++
+		return string(d.src[start:d.pos])
+	}
+	for d.pos < len(d.src) && d.src[d.pos] <= unicode.MaxASCII && unicode.IsLetter(d.src[d.pos]) {
+		d.pos++
+	}
+	return string(d.src[start:d.pos])
+}
+
+// accent reads the argument of an accent command and writes the accented
+// letter.
+func (d *texDecoder) accent(cmd string, mark rune) {
+	d.skipSpace()
+	var arg string
+	if d.peek(0) == '{' {
+		end := d.matchBrace(d.pos)
+		arg = DecodeTeX(string(d.src[d.pos+1 : end]))
+		d.pos = end + 1
+	} else if d.peek(0) == '\\' {
+		d.pos++
+		name := d.commandName()
+		arg = texSymbols[name]
+		if arg == "" {
+			arg = name
+		}
+	} else if d.pos < len(d.src) {
+		arg = string(d.src[d.pos])
+		d.pos++
+	}
+	if arg == "" {
+		d.buf.WriteRune(mark)
+		return
+	}
+	base, size := utf8.DecodeRuneInString(arg)
+	if composed := texCompose(cmd, base); composed != 0 {
+		d.buf.WriteRune(composed)
+	} else {
+		d.buf.WriteRune(base)
+		d.buf.WriteRune(mark)
+	}
+	d.buf.WriteString(arg[size:])
+}
+
+// texCompose returns the precomposed form of base with accent cmd, or 0.
+func texCompose(cmd string, base rune) rune {
+	runes := []rune(texComposed[cmd])
+	for i := 0; i+1 < len(runes); i += 2 {
+		if runes[i] == base {
+			return runes[i+1]
+		}
+	}
+	switch base { // Dotless i/j under an accent, e.g. \'{\i}.
+	case 'ı':
+		return texCompose(cmd, 'i')
+	case 'ȷ':
+		return texCompose(cmd, 'j')
+	}
+	return 0
+}
+
+// matchBrace returns the index of the brace closing the one at open.
+func (d *texDecoder) matchBrace(open int) int {
+	depth := 0
+	for i := open; i < len(d.src); i++ {
+		switch d.src[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(d.src)
+}
+
+func (d *texDecoder) skipSpace() {
+	for d.pos < len(d.src) && isWhitespace(d.src[d.pos]) {
+		d.pos++
+	}
+}
+
+// skipSpaceAndEmptyGroup consumes the space or {} terminating a control word.
+func (d *texDecoder) skipSpaceAndEmptyGroup() {
+	if d.peek(0) == '{' && d.peek(1) == '}' {
+		d.pos += 2
+		return
+	}
+	d.skipSpace()
+}
@@ -0,0 +1,142 @@
+package bibtex
+
+import (
+	"errors"
+	"sort"
+)
+
+// SkipParts can be returned by a WalkFunc to skip the parts of a composite
+// string.
+var SkipParts = errors.New("skip parts")
+
+// Location is where a string is in a bibliography: a field value of an
+// entry, a preamble or the value of a @string macro.
+type Location struct {
+	Entry    *BibEntry // Entry of a field value, or nil.
+	Field    string    // Field name of a field value.
+	Macro    string    // Name of a @string macro.
+	Preamble int       // Position of a preamble, or -1.
+}
+
+// WalkFunc is called by Walk for each string node. If it returns
+// SkipParts for a composite string, its parts are not visited; any other
+// error stops the walk.
+type WalkFunc func(loc Location, s BibString) error
+
+// Walk calls fn for every string node of bib, in depth-first order: each
+// value, then the parts of composite values. Uses of string variables are
+// visited as *BibVar nodes, without their values, which are visited with
+// the @string macros. Macros are visited first (by name), then preambles,
+// then the fields of each entry (by name). Walk returns the first error of
+// fn other than SkipParts.
+func (bib *BibTex) Walk(fn WalkFunc) error {
+	for _, loc := range bib.locations() {
+		err := WalkString(loc.value(bib), func(s BibString) error {
+			return fn(loc, s)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewrite replaces every string node of bib by fn applied to it, visiting
+// nodes in the order of Walk but bottom-up: the parts of a composite string
+// are rewritten before the composite, which fn gets with the rewritten
+// parts. Returning s keeps the node.
+func (bib *BibTex) Rewrite(fn func(loc Location, s BibString) BibString) {
+	for _, loc := range bib.locations() {
+		value := RewriteString(loc.value(bib), func(s BibString) BibString {
+			return fn(loc, s)
+		})
+		loc.setValue(bib, value)
+	}
+}
+
+// locations returns the locations of all values of bib in walk order.
+func (bib *BibTex) locations() []Location {
+	var locs []Location
+	macros := make([]string, 0, len(bib.StringVar))
+	for key := range bib.StringVar {
+		macros = append(macros, key)
+	}
+	sort.Strings(macros)
+	for _, key := range macros {
+		locs = append(locs, Location{Macro: key, Preamble: -1})
+	}
+	for i := range bib.Preambles {
+		locs = append(locs, Location{Preamble: i})
+	}
+	for _, entry := range bib.Entries {
+		fields := make([]string, 0, len(entry.Fields))
+		for name := range entry.Fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		for _, name := range fields {
+			locs = append(locs, Location{Entry: entry, Field: name, Preamble: -1})
+		}
+	}
+	return locs
+}
+
+func (loc Location) value(bib *BibTex) BibString {
+	switch {
+	case loc.Entry != nil:
+		return loc.Entry.Fields[loc.Field]
+	case loc.Preamble >= 0:
+		return bib.Preambles[loc.Preamble]
+	}
+	return bib.StringVar[loc.Macro].Value
+}
+
+func (loc Location) setValue(bib *BibTex, value BibString) {
+	switch {
+	case loc.Entry != nil:
+		loc.Entry.Fields[loc.Field] = value
+	case loc.Preamble >= 0:
+		bib.Preambles[loc.Preamble] = value
+	default:
+		bib.StringVar[loc.Macro].Value = value
+	}
+}
+
+// WalkString calls fn for s and, unless fn returns SkipParts, for the parts
+// of s if it is a composite string, depth-first. It returns the first error
+// of fn other than SkipParts.
+func WalkString(s BibString, fn func(BibString) error) error {
+	err := fn(s)
+	if err == SkipParts {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if c, ok := s.(*BibComposite); ok {
+		for _, part := range *c {
+			if err := WalkString(part, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RewriteString returns s with every node replaced by fn applied to it,
+// bottom-up. A composite string with rewritten parts is copied, not changed
+// in place.
+func RewriteString(s BibString, fn func(BibString) BibString) BibString {
+	if c, ok := s.(*BibComposite); ok {
+		parts := make(BibComposite, len(*c))
+		changed := false
+		for i, part := range *c {
+			parts[i] = RewriteString(part, fn)
+			changed = changed || parts[i] != part
+		}
+		if changed {
+			s = &parts
+		}
+	}
+	return fn(s)
+}